@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	api "tess/internal"
+)
+
+// defaultBatchConcurrency is the default number of batch workers.
+const defaultBatchConcurrency = 4
+
+// batchOptions configures runBatch.
+type batchOptions struct {
+	Cycle       string // review cycle name, matched case-insensitively
+	CycleID     string // review cycle ID; wins over Cycle
+	Concurrency int    // number of reports produced at once
+	MaxReviews  int
+	Refresh     bool
+	CacheTTL    time.Duration
+	AllowEmpty  bool
+	// Strict fails a person who has several reviewee records in the cycle
+	// instead of using the most recent one.
+	Strict bool
+	// Combined writes one document with a section per person instead of a
+	// file each; TOC adds a table of contents to it.
+	Combined bool
+	TOC      bool
+}
+
+// batchResult is the outcome for one direct report.
+type batchResult struct {
+	User    api.User
+	Outcome reportOutcome
+	// Markdown is the rendered report in --combined mode, where it is
+	// stitched into one document instead of written on its own.
+	Markdown string
+	Skipped  string // reason the report was not written, if any
+	Err      error
+}
+
+// runBatch writes (and uploads) a report for every direct report in one
+// cycle. Fetching, conversion, and upload run on a pool of workers; all
+// progress lines go through a single printer goroutine so they never
+// interleave, and the final summary is in name order regardless of which
+// report finished first. It returns the process exit code.
+func runBatch(ctx context.Context, client *api.Client, plan outputPlan, opts batchOptions) int {
+	me, err := client.GetMe(ctx)
+	if err != nil {
+		return apiErrorCode("failed to fetch current user", err)
+	}
+	reports, err := client.ListUsersByURL(ctx, me.DirectReports.URL)
+	if err != nil {
+		return apiErrorCode("failed to fetch direct reports", err)
+	}
+	sort.Slice(reports, func(i, j int) bool { return strings.ToLower(reports[i].Name) < strings.ToLower(reports[j].Name) })
+	cycles, err := client.ListReviewCycles(ctx)
+	if err != nil {
+		return apiErrorCode("failed to fetch review cycles", err)
+	}
+	printWarnings(client)
+	var cycle api.ReviewCycle
+	found := false
+	for _, cy := range cycles {
+		if opts.CycleID != "" && cy.ID == opts.CycleID || opts.CycleID == "" && strings.EqualFold(strings.TrimSpace(cy.Name), strings.TrimSpace(opts.Cycle)) {
+			cycle, found = cy, true
+			break
+		}
+	}
+	switch {
+	case !found && opts.CycleID != "":
+		fmt.Fprintf(os.Stderr, "no review cycle with ID %q\n", opts.CycleID)
+		return 1
+	case !found:
+		fmt.Fprintf(os.Stderr, "no review cycle named %q\n", opts.Cycle)
+		return 1
+	}
+	if len(reports) == 0 {
+		fmt.Fprintln(os.Stderr, "no direct reports found")
+		return 0
+	}
+
+	// Membership comes from the cache when fresh; otherwise the cycle's
+	// reviewee list is fetched once and shared by every worker.
+	var cache *api.MembershipCache
+	if dir, err := api.DefaultCacheDir(); err == nil {
+		cache = api.LoadMembershipCache(dir, opts.CacheTTL, cycles)
+	}
+	var (
+		revieweesOnce sync.Once
+		reviewees     map[string][]api.Reviewee
+		revieweesErr  error
+	)
+	// membership returns userID's reviewee records in the cycle. As in the
+	// interactive flow, only single records are cached.
+	membership := func(c context.Context, userID string) ([]api.Reviewee, error) {
+		if cache != nil && !opts.Refresh {
+			if reviewsURL, member, ok := cache.Lookup(cycle.ID, userID); ok {
+				if !member {
+					return nil, nil
+				}
+				return []api.Reviewee{{Reviews: api.ListRef{URL: reviewsURL}}}, nil
+			}
+		}
+		revieweesOnce.Do(func() {
+			var list []api.Reviewee
+			if list, revieweesErr = client.ListRevieweesByURL(c, cycle.Reviewees.URL); revieweesErr == nil {
+				reviewees = make(map[string][]api.Reviewee, len(list))
+				for _, rv := range list {
+					reviewees[rv.User.ID] = append(reviewees[rv.User.ID], rv)
+				}
+			}
+		})
+		if revieweesErr != nil {
+			return nil, revieweesErr
+		}
+		records := reviewees[userID]
+		if cache != nil && len(records) <= 1 {
+			reviewsURL := ""
+			if len(records) == 1 {
+				reviewsURL = records[0].Reviews.URL
+			}
+			cache.Store(cycle.ID, userID, reviewsURL, len(records) == 1)
+		}
+		return records, nil
+	}
+
+	// Two people can share a first and last name; give later ones a
+	// distinct file and document name so workers never write the same path.
+	fileNames := make([]string, len(reports))
+	used := make(map[string]bool)
+	for i, u := range reports {
+		name := outputFileName(u.Name, cycle.Name)
+		if used[name] {
+			name = strings.TrimSuffix(name, ".md") + "_" + u.ID + ".md"
+		}
+		used[name] = true
+		fileNames[i] = name
+	}
+
+	lines := make(chan string)
+	printed := make(chan struct{})
+	go func() {
+		for line := range lines {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		close(printed)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Generating %d reports for %q with %d workers\n", len(reports), cycle.Name, opts.Concurrency)
+	results := make([]batchResult, len(reports))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				u := reports[i]
+				logf := func(format string, args ...any) { lines <- u.Name + ": " + fmt.Sprintf(format, args...) }
+				results[i] = batchReport(ctx, client, u, cycle, plan, fileNames[i], opts, membership, logf)
+			}
+		}()
+	}
+	for i := range reports {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(lines)
+	<-printed
+
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save cache: %v\n", err)
+		}
+	}
+	printWarnings(client)
+
+	var combined reportOutcome
+	var combinedErr error
+	if opts.Combined {
+		combined, combinedErr = publishCombined(ctx, cycle, plan, results, opts.TOC)
+	}
+
+	failed := 0
+	var authErr error
+	fmt.Println()
+	fmt.Printf("Batch summary for %s:\n", cycle.Name)
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			if authErr == nil && errors.Is(r.Err, api.ErrUnauthorized) {
+				authErr = r.Err
+			}
+			fmt.Printf("%s %s: %v\n", api.Glyphs.Fail, r.User.Name, r.Err)
+		case r.Skipped != "":
+			fmt.Printf("%s %s: skipped (%s)\n", api.Glyphs.Info, r.User.Name, r.Skipped)
+		case opts.Combined:
+			fmt.Printf("%s %s: included\n", api.Glyphs.OK, r.User.Name)
+		case r.Outcome.Uploaded && r.Outcome.URL != "":
+			fmt.Printf("%s %s: %s, uploaded %s\n", api.Glyphs.OK, r.User.Name, r.Outcome.File, r.Outcome.URL)
+		case r.Outcome.Uploaded:
+			fmt.Printf("%s %s: %s, uploaded (link unavailable)\n", api.Glyphs.OK, r.User.Name, r.Outcome.File)
+		default:
+			fmt.Printf("%s %s: %s\n", api.Glyphs.OK, r.User.Name, r.Outcome.File)
+		}
+	}
+	if opts.Combined {
+		switch {
+		case combinedErr != nil:
+			failed++
+			fmt.Printf("%s combined document: %v\n", api.Glyphs.Fail, combinedErr)
+		case combined.File == "":
+			fmt.Println("Nothing to combine; no file written.")
+		default:
+			fmt.Printf("Wrote %s\n", combined.File)
+			printUploaded(combined.Uploaded, combined.URL)
+		}
+	}
+	if authErr != nil {
+		return apiErrorCode("", authErr)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// apiErrorCode reports a failed API call and returns the exit code for it.
+func apiErrorCode(what string, err error) int {
+	return errorExitCode(fmt.Errorf("%s: %w", what, err))
+}
+
+// errorExitCode prints err and returns the exit code for it:
+// ExitUnauthorized, with an actionable message, when the API rejected the
+// key, and 1 otherwise.
+func errorExitCode(err error) int {
+	if !errors.Is(err, api.ErrUnauthorized) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if msg, ok := api.UnauthorizedMessage(err); ok {
+		fmt.Fprintln(os.Stderr, msg)
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return api.ExitUnauthorized
+}
+
+// batchReport fetches and produces the report for one user. logf sends a
+// progress line to the batch printer.
+func batchReport(ctx context.Context, client *api.Client, u api.User, cycle api.ReviewCycle, plan outputPlan, fileName string, opts batchOptions, membership func(context.Context, string) ([]api.Reviewee, error), logf func(string, ...any)) batchResult {
+	res := batchResult{User: u}
+	records, err := membership(ctx, u.ID)
+	if err != nil {
+		res.Err = fmt.Errorf("failed to fetch reviewees: %w", err)
+		return res
+	}
+	if len(records) == 0 {
+		res.Skipped = "not a reviewee in this cycle"
+		return res
+	}
+	rv := records[0]
+	if len(records) > 1 {
+		if opts.Strict {
+			res.Err = fmt.Errorf("%d reviewee records in this cycle (IDs: %s); not guessing with --strict", len(records), revieweeIDs(records))
+			return res
+		}
+		rv = api.MostRecentReviewee(records)
+		logf("warning: %d reviewee records in this cycle; using the most recent (%s)", len(records), rv.ID)
+	}
+	reviewsURL := rv.Reviews.URL
+	logf("fetching reviews")
+	reviews, err := client.ListReviewsByURL(ctx, reviewsURL, 0, opts.MaxReviews)
+	if err != nil {
+		res.Err = fmt.Errorf("failed to fetch reviews: %w", err)
+		return res
+	}
+	if len(reviews) == 0 && !opts.AllowEmpty {
+		res.Skipped = "no reviews"
+		return res
+	}
+	step := func(title string, fn func(context.Context) (any, error)) (any, error) {
+		logf("%s", strings.ToLower(strings.TrimSuffix(title, "...")))
+		return fn(ctx)
+	}
+	subj := reportSubject{User: u, Cycle: cycle, Reviews: reviews, Resolver: client}
+	if opts.Combined {
+		res.Markdown, _, res.Err = renderReport(ctx, subj, plan, step, func(msg string) { logf("%s", msg) })
+		return res
+	}
+	plan.FileName = fileName
+	plan.DocTitle = fmt.Sprintf("%s - %s", plan.DocTitle, strings.TrimSuffix(fileName, ".md"))
+	res.Outcome, res.Err = produceReport(ctx, subj, plan, step, func(msg string) { logf("%s", msg) })
+	if res.Err == nil {
+		logf("done")
+	}
+	return res
+}
+
+// publishCombined stitches the rendered reports in results (in order) into one
+// document with a top-level section per person, optionally preceded by a
+// table of contents, and publishes it. It returns a zero outcome when no
+// report was rendered.
+func publishCombined(ctx context.Context, cycle api.ReviewCycle, plan outputPlan, results []batchResult, toc bool) (reportOutcome, error) {
+	var sections []string
+	for _, r := range results {
+		if r.Err == nil && r.Skipped == "" && r.Markdown != "" {
+			sections = append(sections, demoteHeadings(r.Markdown))
+		}
+	}
+	if len(sections) == 0 {
+		return reportOutcome{}, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s (%s)\n\n", plan.DocTitle, cycle.Name)
+	if toc {
+		b.WriteString("## Contents\n\n")
+		seen := make(map[string]int)
+		for _, sec := range sections {
+			title, _, _ := strings.Cut(strings.TrimPrefix(sec, "## "), "\n")
+			fmt.Fprintf(&b, "- [%s](#%s)\n", title, headingAnchor(title, seen))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(strings.Join(sections, "\n"))
+
+	plan.FileName = outputFileName("Combined Reviews", cycle.Name)
+	plan.DocTitle = fmt.Sprintf("%s - %s", plan.DocTitle, cycle.Name)
+	step := func(title string, fn func(context.Context) (any, error)) (any, error) {
+		fmt.Fprintln(os.Stderr, title)
+		return fn(ctx)
+	}
+	return publishMarkdown(ctx, "", b.String(), plan, step, func(msg string) { fmt.Fprintln(os.Stderr, msg) })
+}
+
+// demoteHeadings moves every ATX heading in md down one level, so a report's
+// H1 title becomes an H2 section of a combined document. Quoted lines and
+// text inside code fences are left alone.
+func demoteHeadings(md string) string {
+	lines := strings.Split(md, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(line, "#") {
+			lines[i] = "#" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headingAnchor returns the GitHub-style identifier pandoc generates for a
+// heading with this text, numbering repeats the same way (-1, -2, ...).
+func headingAnchor(title string, seen map[string]int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	id := b.String()
+	if n := seen[id]; n > 0 {
+		seen[id] = n + 1
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	seen[id] = 1
+	return id
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	api "tess/internal"
+)
+
+// runDemo handles `tess demo`: it renders a report from built-in synthetic
+// data, so the output format and the pandoc pipeline can be tried without an
+// API key or any config.
+func runDemo(args []string) error {
+	fs := flag.NewFlagSet("demo", flag.ExitOnError)
+	format := fs.String("format", "docx", "Also convert the demo report with pandoc: docx, pdf, or md (Markdown only)")
+	fs.Parse(args)
+	*format = strings.ToLower(strings.TrimSpace(*format))
+	if *format != "md" && *format != "docx" && *format != "pdf" {
+		return fmt.Errorf("invalid --format %q (want md, docx, or pdf)", *format)
+	}
+
+	if *format == "pdf" && api.HasPandoc() == nil {
+		if err := api.CheckFormatTools(*format); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	subj := demoSubject()
+	md, err := buildMarkdown(ctx, subj.Resolver, subj.User.Name, subj.Cycle.Name, subj.Reviews, markdownOptions{Summary: true})
+	if err != nil {
+		return fmt.Errorf("build markdown failed: %w", err)
+	}
+	fname := outputFileName(subj.User.Name, subj.Cycle.Name)
+	if err := os.WriteFile(fname, []byte(md), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	fmt.Printf("Wrote %s\n", fname)
+	if *format == "md" {
+		return nil
+	}
+	if err := api.HasPandoc(); err != nil {
+		fmt.Fprintln(os.Stderr, "pandoc not found; skipping conversion. Install pandoc to try DOCX/PDF export.")
+		return nil
+	}
+	out := strings.TrimSuffix(fname, ".md") + "." + *format
+	if *format == "pdf" {
+		err = api.ConvertMarkdownToPDF(ctx, fname, out)
+	} else {
+		err = api.ConvertMarkdownToDOCX(ctx, fname, out, api.PandocOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("pandoc conversion failed: %w", err)
+	}
+	fmt.Printf("Wrote %s\n", out)
+	return nil
+}
+
+// demoSubject returns a synthetic report: one person, a handful of peers,
+// and rating, text, and multiple-choice questions with a self review.
+func demoSubject() reportSubject {
+	scaleMax := 5.0
+	questions := map[string]api.Question{
+		"q-impact":    {ID: "q-impact", Body: "What impact did they have this cycle?", Type: "text", Category: "Impact"},
+		"q-collab":    {ID: "q-collab", Body: "How well do they collaborate?", Type: "rating", Category: "Collaboration", ScaleMin: 1, ScaleMax: scaleMax},
+		"q-strengths": {ID: "q-strengths", Body: "Pick their top strengths", Type: "multiple_choice", Category: "Collaboration", Choices: []api.QuestionChoice{{ID: "c-comm", Label: "Communication"}, {ID: "c-craft", Label: "Craft"}, {ID: "c-mentor", Label: "Mentorship"}}},
+		"q-grow":      {ID: "q-grow", Body: "Where could they grow?", Type: "text", Category: "Growth"},
+	}
+	users := map[string]api.User{
+		"u-sam":    {ID: "u-sam", Name: "Sam Patel"},
+		"u-alex":   {ID: "u-alex", Name: "Alex Kim"},
+		"u-morgan": {ID: "u-morgan", Name: "Morgan Lee"},
+	}
+	subject := api.User{ID: "u-jordan", Name: "Jordan Rivera", Email: "jordan@example.com"}
+	text := func(s string) *api.ReviewResponse { return &api.ReviewResponse{Comment: &s} }
+	rating := func(v float64, s string) *api.ReviewResponse { return &api.ReviewResponse{Rating: &v, Comment: &s} }
+	review := func(id, typ, reviewer, rel, qid string, resp *api.ReviewResponse) api.Review {
+		r := api.Review{ID: id, ReviewType: typ, Reviewer: api.UserRef{ID: reviewer}, Relationship: rel, Question: api.QuestionRef{ID: qid}, Response: resp}
+		r.Reviewee.ID = subject.ID
+		return r
+	}
+	reviews := []api.Review{
+		review("r1", "peer", "u-sam", "peer", "q-impact", text("Jordan led the billing migration end to end and kept every team informed.\n\nThe rollout had zero customer-facing incidents.")),
+		review("r2", "peer", "u-alex", "direct_report", "q-impact", text("Unblocked me on the reporting API more than once.")),
+		review("r3", "peer", "u-sam", "peer", "q-collab", rating(5, "Always the first to offer help.")),
+		review("r4", "peer", "u-alex", "direct_report", "q-collab", rating(4, "Great partner; could loop design in earlier.")),
+		review("r5", "peer", "u-morgan", "manager", "q-collab", rating(4, "")),
+		review("r6", "peer", "u-morgan", "manager", "q-strengths", &api.ReviewResponse{Choices: []string{"c-comm", "c-mentor"}}),
+		review("r7", "peer", "u-morgan", "manager", "q-grow", text("Delegate more of the on-call load so the team builds depth.")),
+		review("r8", "self", subject.ID, "", "q-impact", text("Shipped the billing migration and mentored two new engineers.")),
+		review("r9", "self", subject.ID, "", "q-grow", text("I want to get better at writing design docs before I start building.")),
+	}
+	return reportSubject{
+		User:     subject,
+		Cycle:    api.ReviewCycle{ID: "cycle-demo", Name: "Demo Cycle"},
+		Reviews:  reviews,
+		Resolver: api.StaticResolver{Users: users, Questions: questions},
+	}
+}
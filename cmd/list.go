@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// listChrome is the number of View lines that are not list items (blank
+// line, title, blank line, and the footer's blank line and hint).
+const listChrome = 5
+
+// defaultPageSize is used for paging before the terminal size is known.
+const defaultPageSize = 10
+
+type listModel struct {
+	title  string
+	items  []string
+	cursor int
+	choice string
+	// quit is set when the user leaves with q or Ctrl+C rather than Enter.
+	quit bool
+	// height is the terminal height (0 until the first WindowSizeMsg);
+	// offset is the index of the first visible item.
+	height int
+	offset int
+	// digits accumulates a typed item number for quick-select.
+	digits string
+	// jumpMode is entered with "/": letters then jump to the next item
+	// starting with them instead of acting as j/k/g/q shortcuts.
+	jumpMode bool
+}
+
+func newListModel(title string, items []string) *listModel {
+	return &listModel{title: title, items: items}
+}
+func (m *listModel) Init() tea.Cmd { return nil }
+func (m *listModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		key := msg.String()
+		if key >= "0" && key <= "9" && len(key) == 1 {
+			m.quickSelect(key)
+			break
+		}
+		m.digits = ""
+		if m.jumpMode {
+			switch {
+			case key == "esc":
+				m.jumpMode = false
+				return m, nil
+			case msg.Type == tea.KeyRunes && len(msg.Runes) == 1:
+				m.jumpToLetter(msg.Runes[0])
+				m.scrollToCursor()
+				return m, nil
+			}
+		}
+		switch key {
+		case "/":
+			m.jumpMode = true
+		case "ctrl+c", "q":
+			m.quit = true
+			return m, tea.Quit
+		case "up", "k":
+			m.moveTo(m.cursor - 1)
+		case "down", "j":
+			m.moveTo(m.cursor + 1)
+		case "g", "home":
+			m.moveTo(0)
+		case "G", "end":
+			m.moveTo(len(m.items) - 1)
+		case "pgup", "ctrl+u":
+			m.moveTo(m.cursor - m.pageSize())
+		case "pgdown", "ctrl+d":
+			m.moveTo(m.cursor + m.pageSize())
+		case "enter":
+			if len(m.items) > 0 {
+				m.choice = m.items[m.cursor]
+			}
+			return m, tea.Quit
+		}
+	}
+	m.scrollToCursor()
+	return m, nil
+}
+
+// moveTo sets the cursor to i, clamped to the list bounds.
+func (m *listModel) moveTo(i int) {
+	m.cursor = max(0, min(i, len(m.items)-1))
+}
+
+// quickSelect appends d to the typed number and moves to that item (1-based).
+// A number past the end starts over from d.
+func (m *listModel) quickSelect(d string) {
+	m.digits += d
+	n, _ := strconv.Atoi(m.digits)
+	if n < 1 || n > len(m.items) {
+		m.digits = d
+		n, _ = strconv.Atoi(d)
+	}
+	if n >= 1 && n <= len(m.items) {
+		m.cursor = n - 1
+	}
+}
+
+// jumpToLetter moves to the next item after the cursor whose first letter is
+// r (case-insensitive), wrapping around.
+func (m *listModel) jumpToLetter(r rune) {
+	want := strings.ToLower(string(r))
+	for step := 1; step <= len(m.items); step++ {
+		i := (m.cursor + step) % len(m.items)
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(m.items[i])), want) {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+// pageSize is the number of items visible at once.
+func (m *listModel) pageSize() int {
+	if m.height <= listChrome {
+		return defaultPageSize
+	}
+	return m.height - listChrome
+}
+
+// scrollToCursor adjusts offset so the cursor stays within the visible page.
+func (m *listModel) scrollToCursor() {
+	if m.height == 0 {
+		return
+	}
+	page := m.pageSize()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+page {
+		m.offset = m.cursor - page + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.items)-page))
+}
+
+func (m *listModel) View() string {
+	var b strings.Builder
+	if m.title == "" {
+		m.title = "Select"
+	}
+	fmt.Fprintf(&b, "\n%s (↑/↓, Enter, q):\n\n", m.title)
+	end := len(m.items)
+	if m.height > 0 {
+		end = min(end, m.offset+m.pageSize())
+	}
+	width := len(fmt.Sprint(len(m.items)))
+	for i := m.offset; i < end; i++ {
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d. %s\n", cursor, width, i+1, m.items[i])
+	}
+	pos := fmt.Sprintf("%d/%d", min(m.cursor+1, len(m.items)), len(m.items))
+	if m.jumpMode {
+		fmt.Fprintf(&b, "\nJump: type a letter to go to the next match · Esc to leave · %s\n", pos)
+	} else {
+		fmt.Fprintf(&b, "\n0-9 go to number · / jump by letter · g/G top/bottom · PgUp/PgDn or Ctrl+U/D page · %s\n", pos)
+	}
+	return b.String()
+}
@@ -0,0 +1,1202 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	api "tess/internal"
+)
+
+// markdownOptions controls how buildMarkdown renders a report.
+type markdownOptions struct {
+	// Censor masks reviewer names, scores, and quote content.
+	Censor bool
+	// GroupBy is "question" (default), "category", or "relationship"
+	// (peer feedback only).
+	GroupBy string
+	// ShowQuestionType annotates each question heading with its type.
+	ShowQuestionType bool
+	// SortBy orders peer entries within a question: "name" (default) or
+	// "arrival" (API order).
+	SortBy string
+	// Compact folds reviewer names into their quotes and drops blank lines
+	// inside quotes, for shorter printed reports.
+	Compact bool
+	// MaxQuoteLength truncates quotes longer than this many characters;
+	// zero means unlimited.
+	MaxQuoteLength int
+	// RatingStyle renders numeric ratings as "number" (default), "stars",
+	// or "bar".
+	RatingStyle string
+	// OmitPeer and OmitSelf leave out the Peer Feedback or Self Review
+	// section; see resolveSections.
+	OmitPeer bool
+	OmitSelf bool
+	// ShowCounts appends the number of rendered responses to each peer
+	// question heading.
+	ShowCounts bool
+	// Summary adds a per-question table of average peer ratings.
+	Summary bool
+	// NormalizeScores adds a 0–100 column to the summary so questions on
+	// different scales can be compared.
+	NormalizeScores bool
+	// HighlightBelow bolds summary rows whose average rating is below it and
+	// lists those questions under "Focus areas"; zero means off.
+	HighlightBelow float64
+	// ScoresOnly replaces the report body with a reviewers × questions grid
+	// of peer ratings (see writeScoresTable); all prose is left out.
+	ScoresOnly bool
+	// ReviewWeights adds a weighted average column to the summary; see
+	// parseReviewWeights. Empty means no column.
+	ReviewWeights map[string]float64
+	// KeepDuplicates disables collapsing repeated reviews from the same
+	// reviewer for the same question.
+	KeepDuplicates bool
+	// CommentMarkdown is "interpret" (default: Markdown that reviewers type,
+	// like **bold** or lists, renders as formatting) or "escape" (it is shown
+	// literally). HTML in comments is handled separately; see CommentHTML.
+	CommentMarkdown string
+	// CommentHTML is how HTML in comments is handled: "strip" (default:
+	// tags removed), "unescape" (entities decoded, tags kept for an
+	// HTML-aware pipeline), or "markdown" (common tags converted to Markdown).
+	CommentHTML string
+	// SelfLabel attributes self-review quotes: "none" (default: bare
+	// quotes), "self" ("Self:"), or "name" (the reviewee's name).
+	SelfLabel string
+	// HideEmptySelf leaves out self-review answers with no content, as is
+	// always done for peer feedback; questions left with none are dropped.
+	HideEmptySelf bool
+	// Warn, if set, receives a message for each data problem found while
+	// rendering, such as a review without a question ID.
+	Warn func(string)
+	// ManagerNotes is Markdown inserted as a "Manager Summary" section after
+	// the title. It is never censored.
+	ManagerNotes string
+	// NewReviews, when non-nil, adds a "New since last run" section with the
+	// reviews whose IDs it contains (see newReviewIDs); DiffBase names the
+	// earlier run in that section, e.g. its export date.
+	NewReviews map[string]bool
+	DiffBase   string
+}
+
+// maxManagerNotes caps the size of --manager-notes content.
+const maxManagerNotes = 64 << 10
+
+// commentMarkdownModes lists the accepted --comment-markdown values.
+var commentMarkdownModes = []string{"interpret", "escape"}
+
+// commentHTMLModes lists the accepted --comment-html values.
+var commentHTMLModes = []string{"strip", "unescape", "markdown"}
+
+// ratingStyles lists the accepted --rating-style values.
+var ratingStyles = []string{"number", "stars", "bar"}
+
+// selfLabelModes lists the accepted --self-label values.
+var selfLabelModes = []string{"none", "self", "name"}
+
+// sortByModes lists the accepted --sort-by values.
+var sortByModes = []string{"name", "arrival"}
+
+// groupByModes lists the accepted --group-by values.
+var groupByModes = []string{"question", "category", "relationship"}
+
+// relationshipOrder is the display order of --group-by relationship headings.
+var relationshipOrder = []string{"Manager", "Direct reports", "Skip-level", "Peers", "Cross-functional", "Other"}
+
+// relationshipLabel maps a reviewer relationship from the API to one of
+// relationshipOrder; unknown or missing values become "Other".
+func relationshipLabel(raw string) string {
+	key := strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(strings.TrimSpace(raw)))
+	switch key {
+	case "manager", "direct_manager":
+		return "Manager"
+	case "direct_report", "direct_reports", "report":
+		return "Direct reports"
+	case "skip", "skip_level", "skip_level_manager", "skip_level_report":
+		return "Skip-level"
+	case "peer", "peers", "teammate":
+		return "Peers"
+	case "cross_functional", "crossfunctional", "cross_functional_peer":
+		return "Cross-functional"
+	default:
+		return "Other"
+	}
+}
+
+// uncategorizedLabel heads questions without a category in --group-by category.
+const uncategorizedLabel = "General"
+
+// unknownQuestionLabel heads reviews whose question ID is missing.
+const unknownQuestionLabel = "Uncategorized"
+
+func buildMarkdown(ctx context.Context, c api.Resolver, userName, cycleName string, reviews []api.Review, opts markdownOptions) (string, error) {
+	mask := func(s string) string {
+		if !opts.Censor {
+			return s
+		}
+		var b strings.Builder
+		for _, r := range s {
+			if unicode.IsSpace(r) {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune('▒')
+			}
+		}
+		return b.String()
+	}
+	peerByQ := make(map[string][]api.Review)
+	selfByQ := make(map[string][]api.Review)
+	qOrderPeer, qOrderSelf := make([]string, 0), make([]string, 0)
+	seenPeer, seenSelf := make(map[string]bool), make(map[string]bool)
+	if !opts.KeepDuplicates {
+		reviews = dedupeReviews(reviews)
+	}
+	for _, r := range reviews {
+		qid := r.Question.ID
+		if qid == "" && opts.Warn != nil {
+			who := cmp.Or(r.Reviewer.Name, r.Reviewer.ID, "an unknown reviewer")
+			opts.Warn(fmt.Sprintf("review %s from %s has no question ID; shown under %q", r.ID, who, unknownQuestionLabel))
+		}
+		switch strings.ToLower(r.ReviewType) {
+		case "self":
+			if opts.HideEmptySelf && !hasContent(r) {
+				continue
+			}
+			selfByQ[qid] = append(selfByQ[qid], r)
+			if !seenSelf[qid] {
+				qOrderSelf = append(qOrderSelf, qid)
+				seenSelf[qid] = true
+			}
+		default:
+			if r.Response == nil {
+				continue
+			}
+			if !hasContent(r) {
+				continue
+			}
+			peerByQ[qid] = append(peerByQ[qid], r)
+			if !seenPeer[qid] {
+				qOrderPeer = append(qOrderPeer, qid)
+				seenPeer[qid] = true
+			}
+		}
+	}
+	// Reviews without a question ID share one bucket, listed last so it
+	// doesn't look like part of the questionnaire.
+	qOrderPeer, qOrderSelf = unknownLast(qOrderPeer), unknownLast(qOrderSelf)
+
+	questions := make(map[string]*api.Question)
+	lookup := func(qid string) *api.Question {
+		if qid == "" {
+			return nil
+		}
+		if q, ok := questions[qid]; ok {
+			return q
+		}
+		q, err := c.GetQuestionByID(ctx, qid)
+		if err != nil {
+			q = nil
+		}
+		questions[qid] = q
+		return q
+	}
+	heading := func(qid string, clean func(string) string) string {
+		if qid == "" {
+			return unknownQuestionLabel
+		}
+		q := lookup(qid)
+		if q == nil {
+			return "Question"
+		}
+		qtext := strings.ReplaceAll(clean(strings.TrimSpace(q.Body)), "\n", " ")
+		if opts.ShowQuestionType && strings.TrimSpace(q.Type) != "" {
+			qtext += fmt.Sprintf(" _(%s)_", questionTypeLabel(q.Type))
+		}
+		return qtext
+	}
+
+	// comment cleans a reviewer's comment for quoting.
+	comment := func(s string) string {
+		switch s = strings.TrimSpace(s); opts.CommentHTML {
+		case "unescape":
+			s = strings.TrimSpace(strings.ReplaceAll(html.UnescapeString(s), "\r\n", "\n"))
+		case "markdown":
+			s = sanitizeText(htmlToMarkdown(s))
+		default:
+			s = sanitizeText(s)
+		}
+		if opts.CommentMarkdown == "escape" {
+			s = escapeMarkdown(s)
+		}
+		return s
+	}
+
+	var b strings.Builder
+	// writeQuestions emits a heading per question followed by body(qid). In
+	// category mode questions are grouped under H3 category headings (in
+	// order of first appearance) and the question headings drop to H4.
+	writeQuestions := func(order []string, title func(qid string) string, body func(qid string)) {
+		if opts.GroupBy != "category" {
+			for _, qid := range order {
+				fmt.Fprintf(&b, "### %s\n\n", title(qid))
+				body(qid)
+			}
+			return
+		}
+		var cats []string
+		byCat := make(map[string][]string)
+		for _, qid := range order {
+			cat := uncategorizedLabel
+			if q := lookup(qid); q != nil && strings.TrimSpace(string(q.Category)) != "" {
+				cat = sanitizeText(string(q.Category))
+			}
+			if _, ok := byCat[cat]; !ok {
+				cats = append(cats, cat)
+			}
+			byCat[cat] = append(byCat[cat], qid)
+		}
+		for _, cat := range cats {
+			fmt.Fprintf(&b, "### %s\n\n", cat)
+			for _, qid := range byCat[cat] {
+				fmt.Fprintf(&b, "#### %s\n\n", title(qid))
+				body(qid)
+			}
+		}
+	}
+
+	// writeEntry emits one response as a blockquote preceded by lead (if
+	// any). Compact mode folds the lead into the quote's first line and drops
+	// blank lines inside the quote; the blank line after each quote stays,
+	// since it is what keeps consecutive quotes apart.
+	writeEntry := func(lead, quote string) {
+		lines := strings.Split(quote, "\n")
+		if opts.Compact {
+			kept := lines[:0]
+			for _, line := range lines {
+				if strings.TrimSpace(line) != "" {
+					kept = append(kept, line)
+				}
+			}
+			lines = kept
+			if lead != "" && len(lines) > 0 {
+				lines[0] = lead + " " + lines[0]
+			}
+		} else if lead != "" {
+			fmt.Fprintf(&b, "%s\n\n", lead)
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+		b.WriteString("\n")
+	}
+
+	// reviewerName is the display name of r's reviewer, "Unknown" when it
+	// can't be resolved. Anonymized reviews already carry their code.
+	reviewerName := func(r api.Review) string {
+		if r.Reviewer.ID != "" {
+			if u, err := c.ResolveUser(ctx, r.Reviewer); err == nil && strings.TrimSpace(u.Name) != "" {
+				return u.Name
+			}
+		}
+		return "Unknown"
+	}
+
+	fmt.Fprintf(&b, "# %s (%s)\n\n", userName, cycleName)
+	if opts.ScoresOnly {
+		writeScoresTable(&b, qOrderPeer, peerByQ, func(qid string) string { return heading(qid, html.UnescapeString) }, reviewerName, mask)
+		return b.String(), nil
+	}
+	if notes := strings.TrimSpace(opts.ManagerNotes); notes != "" {
+		b.WriteString("## Manager Summary\n\n")
+		b.WriteString(notes)
+		b.WriteString("\n\n")
+	}
+	if opts.Summary && !opts.OmitPeer {
+		writeSummary(&b, qOrderPeer, peerByQ, lookup, func(qid string) string { return heading(qid, html.UnescapeString) }, mask, opts.NormalizeScores, opts.ReviewWeights, opts.HighlightBelow)
+	}
+	// Omitted sections keep their grouping code paths but render nothing.
+	if opts.OmitPeer {
+		qOrderPeer = nil
+	}
+	if opts.OmitSelf {
+		qOrderSelf = nil
+	}
+	// peerHeading is a peer question heading, with the number of entries
+	// shown beneath it when ShowCounts is set.
+	peerHeading := func(qid string, n int) string {
+		h := heading(qid, html.UnescapeString)
+		if opts.ShowCounts {
+			if n == 1 {
+				h += " (1 response)"
+			} else {
+				h += fmt.Sprintf(" (%d responses)", n)
+			}
+		}
+		return h
+	}
+	// scoreText returns the rating shown for resp: the API's label, else the
+	// number, as glyphs with --rating-style; "" when there is none.
+	scoreText := func(qid string, resp *api.ReviewResponse) string {
+		if resp == nil {
+			return ""
+		}
+		var score string
+		if resp.RatingString != nil && *resp.RatingString != "" {
+			score = *resp.RatingString
+		}
+		if score == "" && resp.Rating != nil {
+			score = fmt.Sprintf("%.2f", *resp.Rating)
+		}
+		if resp.Rating != nil && opts.RatingStyle != "" && opts.RatingStyle != "number" {
+			if q := lookup(qid); q != nil {
+				if g, ok := ratingGlyphs(*resp.Rating, q.ScaleMax, opts.RatingStyle); ok {
+					score = g
+				}
+			}
+		}
+		return mask(score)
+	}
+	// entryLead builds the line introducing an entry from the (masked)
+	// reviewer name and score, either of which may be empty.
+	entryLead := func(name, score string) string {
+		switch {
+		case name == "" && score == "":
+			return ""
+		case name == "":
+			return "Score: " + score
+		}
+		if opts.Compact {
+			name = "**" + name + "**"
+		}
+		if score != "" {
+			return fmt.Sprintf("%s (score: %s):", name, score)
+		}
+		return name + ":"
+	}
+	// responseQuote returns the quoted body of an entry: the comment, with
+	// any selected choices on a "(selected: ...)" line after it, or the
+	// choices alone when there is no comment.
+	responseQuote := func(qid string, resp *api.ReviewResponse) string {
+		var quote, choices string
+		if resp != nil && resp.Comment != nil && strings.TrimSpace(*resp.Comment) != "" {
+			quote = truncateQuote(comment(*resp.Comment), opts.MaxQuoteLength)
+		}
+		if resp != nil && len(resp.Choices) > 0 {
+			choices = sanitizeText(formatChoices(lookup(qid), resp.Choices))
+		}
+		switch {
+		case strings.TrimSpace(quote) != "" && strings.TrimSpace(choices) != "":
+			quote += "\n\n(selected: " + choices + ")"
+		case strings.TrimSpace(quote) == "":
+			quote = truncateQuote(choices, opts.MaxQuoteLength)
+		}
+		if strings.TrimSpace(quote) == "" {
+			quote = "(no comment)"
+		}
+		return mask(quote)
+	}
+	writePeers := func(qid string, entries []api.Review) {
+		names := make([]string, len(entries))
+		for i, r := range entries {
+			names[i] = reviewerName(r)
+		}
+		idx := make([]int, len(entries))
+		for i := range idx {
+			idx[i] = i
+		}
+		if opts.SortBy != "arrival" {
+			// Arrival order varies between runs; sort by name, then ID, so
+			// regenerated reports diff cleanly.
+			sort.SliceStable(idx, func(a, b int) bool {
+				na, nb := strings.ToLower(names[idx[a]]), strings.ToLower(names[idx[b]])
+				if na != nb {
+					return na < nb
+				}
+				return entries[idx[a]].Reviewer.ID < entries[idx[b]].Reviewer.ID
+			})
+		}
+		for _, i := range idx {
+			r := entries[i]
+			writeEntry(entryLead(mask(names[i]), scoreText(qid, r.Response)), responseQuote(qid, r.Response))
+		}
+	}
+	selfName := ""
+	switch opts.SelfLabel {
+	case "self":
+		selfName = "Self"
+	case "name":
+		selfName = mask(userName)
+	}
+	if opts.NewReviews != nil {
+		b.WriteString("## New since last run\n\n")
+		// Questions keep report order; self answers follow the peer entries
+		// under each question.
+		order := append([]string{}, qOrderPeer...)
+		for _, qid := range qOrderSelf {
+			if !slices.Contains(order, qid) {
+				order = append(order, qid)
+			}
+		}
+		newPeers, newSelf := make(map[string][]api.Review), make(map[string][]api.Review)
+		n := 0
+		for _, qid := range order {
+			for _, r := range peerByQ[qid] {
+				if opts.NewReviews[r.ID] {
+					newPeers[qid] = append(newPeers[qid], r)
+					n++
+				}
+			}
+			for _, r := range selfByQ[qid] {
+				if opts.NewReviews[r.ID] {
+					newSelf[qid] = append(newSelf[qid], r)
+					n++
+				}
+			}
+		}
+		switch n {
+		case 0:
+			fmt.Fprintf(&b, "No new responses since %s.\n\n", opts.DiffBase)
+		case 1:
+			fmt.Fprintf(&b, "1 new response since %s.\n\n", opts.DiffBase)
+		default:
+			fmt.Fprintf(&b, "%d new responses since %s.\n\n", n, opts.DiffBase)
+		}
+		for _, qid := range order {
+			if len(newPeers[qid])+len(newSelf[qid]) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "### %s\n\n", heading(qid, html.UnescapeString))
+			writePeers(qid, newPeers[qid])
+			for _, r := range newSelf[qid] {
+				writeEntry(entryLead(cmp.Or(selfName, "Self"), scoreText(qid, r.Response)), responseQuote(qid, r.Response))
+			}
+		}
+	}
+	if !opts.OmitPeer {
+		b.WriteString("## Peer Feedback\n\n")
+	}
+	if opts.GroupBy == "relationship" {
+		// Peer feedback nests under H3 relationship headings; questions
+		// keep their original order within each group.
+		byRel := make(map[string]map[string][]api.Review)
+		for _, qid := range qOrderPeer {
+			for _, r := range peerByQ[qid] {
+				rel := relationshipLabel(r.Relationship)
+				if byRel[rel] == nil {
+					byRel[rel] = make(map[string][]api.Review)
+				}
+				byRel[rel][qid] = append(byRel[rel][qid], r)
+			}
+		}
+		for _, rel := range relationshipOrder {
+			group, ok := byRel[rel]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&b, "### %s\n\n", rel)
+			for _, qid := range qOrderPeer {
+				if entries := group[qid]; len(entries) > 0 {
+					fmt.Fprintf(&b, "#### %s\n\n", peerHeading(qid, len(entries)))
+					writePeers(qid, entries)
+				}
+			}
+		}
+	} else {
+		writeQuestions(qOrderPeer, func(qid string) string { return peerHeading(qid, len(peerByQ[qid])) }, func(qid string) { writePeers(qid, peerByQ[qid]) })
+	}
+
+	if !opts.OmitSelf {
+		if !opts.OmitPeer {
+			b.WriteString("---\n\n")
+		}
+		b.WriteString("## Self Review\n\n")
+	}
+	writeQuestions(qOrderSelf, func(qid string) string { return heading(qid, sanitizeText) }, func(qid string) {
+		for _, r := range selfByQ[qid] {
+			writeEntry(entryLead(selfName, scoreText(qid, r.Response)), responseQuote(qid, r.Response))
+		}
+	})
+	return b.String(), nil
+}
+
+// unknownLast moves the empty question ID, if present, to the end of order.
+func unknownLast(order []string) []string {
+	for i, qid := range order {
+		if qid == "" {
+			return append(append(order[:i:i], order[i+1:]...), "")
+		}
+	}
+	return order
+}
+
+// legendEntry maps an anonymized reviewer code to the real reviewer.
+type legendEntry struct {
+	Code string
+	Name string
+	ID   string
+}
+
+// anonymizeReviews replaces each peer reviewer with a code ("Reviewer A",
+// "Reviewer B", ...) and returns the rewritten reviews plus the legend.
+// Codes are assigned in reviewer ID order, so they are stable between runs
+// and say nothing about names. Self reviews are left as they are.
+func anonymizeReviews(ctx context.Context, c api.Resolver, reviews []api.Review) ([]api.Review, []legendEntry) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, r := range reviews {
+		if strings.ToLower(r.ReviewType) != "self" && !seen[r.Reviewer.ID] {
+			seen[r.Reviewer.ID] = true
+			ids = append(ids, r.Reviewer.ID)
+		}
+	}
+	sort.Strings(ids)
+	codes := make(map[string]string, len(ids))
+	legend := make([]legendEntry, 0, len(ids))
+	for i, id := range ids {
+		e := legendEntry{Code: "Reviewer " + letterCode(i), Name: "Unknown", ID: id}
+		byID := api.UserRef{ID: id}
+		for _, r := range reviews {
+			if r.Reviewer.ID == id && strings.TrimSpace(r.Reviewer.Name) != "" {
+				byID = r.Reviewer
+				break
+			}
+		}
+		if id != "" {
+			if u, err := c.ResolveUser(ctx, byID); err == nil && strings.TrimSpace(u.Name) != "" {
+				e.Name = u.Name
+			}
+		}
+		codes[id] = e.Code
+		legend = append(legend, e)
+	}
+	out := make([]api.Review, len(reviews))
+	for i, r := range reviews {
+		if strings.ToLower(r.ReviewType) != "self" {
+			r.Reviewer = api.UserRef{ID: codes[r.Reviewer.ID], Name: codes[r.Reviewer.ID]}
+		}
+		out[i] = r
+	}
+	return out, legend
+}
+
+// letterCode returns spreadsheet-style letters for i: A..Z, AA, AB, ...
+func letterCode(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// writeLegend writes the anonymization legend to path, readable only by
+// the owner (existing files are narrowed to 0600 too).
+func writeLegend(path, userName, cycleName string, legend []legendEntry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("write legend: %w", err)
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return fmt.Errorf("write legend: %w", err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Reviewer legend: %s (%s)\n\n", userName, cycleName)
+	for _, e := range legend {
+		fmt.Fprintf(&b, "- %s → %s", e.Code, e.Name)
+		if e.ID != "" {
+			fmt.Fprintf(&b, " (%s)", e.ID)
+		}
+		b.WriteString("\n")
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("write legend: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write legend: %w", err)
+	}
+	return nil
+}
+
+// resolveSections turns the section flags into which sections to omit.
+// --self-only equals --no-peer and --peer-only equals --no-self; combinations
+// that contradict each other or leave nothing to render are errors.
+func resolveSections(selfOnly, peerOnly, noSelf, noPeer bool) (omitPeer, omitSelf bool, err error) {
+	switch {
+	case selfOnly && peerOnly:
+		return false, false, fmt.Errorf("--self-only and --peer-only can't be combined")
+	case selfOnly && noSelf:
+		return false, false, fmt.Errorf("--self-only and --no-self contradict each other")
+	case peerOnly && noPeer:
+		return false, false, fmt.Errorf("--peer-only and --no-peer contradict each other")
+	}
+	omitPeer = selfOnly || noPeer
+	omitSelf = peerOnly || noSelf
+	if omitPeer && omitSelf {
+		return false, false, fmt.Errorf("--no-self and --no-peer together leave nothing to report")
+	}
+	return omitPeer, omitSelf, nil
+}
+
+// sectionNames lists the sections a report includes, for the bundle manifest.
+func sectionNames(opts markdownOptions) []string {
+	var out []string
+	if !opts.OmitPeer {
+		out = append(out, "peer")
+	}
+	if !opts.OmitSelf {
+		out = append(out, "self")
+	}
+	return out
+}
+
+// hasContent reports whether r carries a comment, choices, or a rating.
+func hasContent(r api.Review) bool {
+	if r.Response == nil {
+		return false
+	}
+	return (r.Response.Comment != nil && strings.TrimSpace(*r.Response.Comment) != "") || len(r.Response.Choices) > 0 || r.Response.RatingString != nil || r.Response.Rating != nil
+}
+
+// newReviewIDs returns the IDs of reviews in current that have content
+// and either aren't in prior or had none there (a saved draft since
+// submitted). Matching is by review ID only; reviews without one are never
+// reported as new.
+func newReviewIDs(prior, current []api.Review) map[string]bool {
+	hadContent := make(map[string]bool, len(prior))
+	for _, r := range prior {
+		if r.ID != "" {
+			hadContent[r.ID] = hadContent[r.ID] || hasContent(r)
+		}
+	}
+	out := make(map[string]bool)
+	for _, r := range current {
+		if r.ID != "" && hasContent(r) && !hadContent[r.ID] {
+			out[r.ID] = true
+		}
+	}
+	return out
+}
+
+// dedupeReviews collapses multiple reviews of the same type from one reviewer
+// for one question (e.g. a draft and a final submission) into a single one:
+// a review with content beats an empty one, then the most recently
+// updated/submitted wins, then the later record. The winner takes the place
+// of the first occurrence. Reviews without a reviewer or question ID are left
+// alone.
+func dedupeReviews(reviews []api.Review) []api.Review {
+	latest := func(r api.Review) time.Time {
+		if r.UpdatedAt.After(r.SubmittedAt.Time) {
+			return r.UpdatedAt.Time
+		}
+		return r.SubmittedAt.Time
+	}
+	better := func(a, b api.Review) bool {
+		if ca, cb := hasContent(a), hasContent(b); ca != cb {
+			return ca
+		}
+		return !latest(b).After(latest(a))
+	}
+	out := make([]api.Review, 0, len(reviews))
+	pos := make(map[string]int)
+	for _, r := range reviews {
+		if r.Reviewer.ID == "" || r.Question.ID == "" {
+			out = append(out, r)
+			continue
+		}
+		key := strings.Join([]string{strings.ToLower(r.ReviewType), r.Reviewer.ID, r.Question.ID}, "\x00")
+		if i, ok := pos[key]; ok {
+			if better(r, out[i]) {
+				out[i] = r
+			}
+			continue
+		}
+		pos[key] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
+
+// writeSummary writes a "Score Summary" table of the average peer rating per
+// question. Individual scores in the sections below stay raw. With normalize,
+// each average is also mapped to 0–100 using the question's scale; questions
+// without scale info show "n/a" there and are left out of the overall figure.
+// With weights, a weighted average column follows the raw one. With
+// highlightBelow > 0, rows whose raw average is below it are bolded and
+// repeated in a "Focus areas" list after the table, lowest first.
+func writeSummary(b *strings.Builder, order []string, byQ map[string][]api.Review, lookup func(string) *api.Question, title func(string) string, mask func(string) string, normalize bool, weights map[string]float64, highlightBelow float64) {
+	type row struct {
+		title    string
+		n        int
+		avg      float64
+		weighted float64
+		// weightSum is zero when every rating was weighted 0.
+		weightSum float64
+		norm      float64
+		hasScale  bool
+	}
+	var rows []row
+	for _, qid := range order {
+		if qid == "" {
+			// Ratings from unidentified questions can't be averaged together.
+			continue
+		}
+		sum, n := 0.0, 0
+		wsum, wtotal := 0.0, 0.0
+		for _, r := range byQ[qid] {
+			if r.Response != nil && r.Response.Rating != nil {
+				sum += *r.Response.Rating
+				n++
+				w := reviewWeight(r, weights)
+				wsum += w * *r.Response.Rating
+				wtotal += w
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		rw := row{title: title(qid), n: n, avg: sum / float64(n), weightSum: wtotal}
+		if wtotal > 0 {
+			rw.weighted = wsum / wtotal
+		}
+		if q := lookup(qid); q != nil && q.ScaleMax > q.ScaleMin {
+			rw.norm = (rw.avg - q.ScaleMin) / (q.ScaleMax - q.ScaleMin) * 100
+			rw.hasScale = true
+		}
+		rows = append(rows, rw)
+	}
+	if len(rows) == 0 {
+		return
+	}
+	cell := func(s string) string { return strings.ReplaceAll(s, "|", "\\|") }
+	b.WriteString("## Score Summary\n\n")
+	header, align := "| Question | Ratings | Average |", "| --- | ---: | ---: |"
+	if normalize {
+		header = "| Question | Ratings | Average (raw) |"
+	}
+	if len(weights) > 0 {
+		header += " Weighted average |"
+		align += " ---: |"
+	}
+	if normalize {
+		header += " Normalized (0–100) |"
+		align += " ---: |"
+	}
+	b.WriteString(header + "\n" + align + "\n")
+	normSum, normN := 0.0, 0
+	var focus []row
+	for _, rw := range rows {
+		if highlightBelow > 0 && rw.avg < highlightBelow {
+			focus = append(focus, rw)
+			fmt.Fprintf(b, "| **%s** | %d | **%s** |", cell(rw.title), rw.n, mask(fmt.Sprintf("%.2f", rw.avg)))
+		} else {
+			fmt.Fprintf(b, "| %s | %d | %s |", cell(rw.title), rw.n, mask(fmt.Sprintf("%.2f", rw.avg)))
+		}
+		if len(weights) > 0 {
+			weighted := "n/a"
+			if rw.weightSum > 0 {
+				weighted = mask(fmt.Sprintf("%.2f", rw.weighted))
+			}
+			fmt.Fprintf(b, " %s |", weighted)
+		}
+		if normalize {
+			norm := "n/a"
+			if rw.hasScale {
+				norm = mask(fmt.Sprintf("%.0f", rw.norm))
+				normSum += rw.norm
+				normN++
+			}
+			fmt.Fprintf(b, " %s |", norm)
+		}
+		b.WriteString("\n")
+	}
+	if normalize && normN > 0 {
+		pad := "| | |"
+		if len(weights) > 0 {
+			pad = "| | | |"
+		}
+		fmt.Fprintf(b, "| **Overall (normalized)** %s %s |\n", pad, mask(fmt.Sprintf("%.0f", normSum/float64(normN))))
+	}
+	b.WriteString("\n")
+	if len(focus) == 0 {
+		return
+	}
+	sort.SliceStable(focus, func(i, j int) bool { return focus[i].avg < focus[j].avg })
+	fmt.Fprintf(b, "### Focus areas\n\nQuestions averaging below %s:\n\n", strconv.FormatFloat(highlightBelow, 'f', -1, 64))
+	for _, rw := range focus {
+		fmt.Fprintf(b, "- %s (average %s)\n", rw.title, mask(fmt.Sprintf("%.2f", rw.avg)))
+	}
+	b.WriteString("\n")
+}
+
+// writeScoresTable writes a "Scores" grid with a row per peer reviewer and a
+// column per question that has numeric ratings, plus each reviewer's average
+// and an "Average" row of per-question averages (as in writeSummary).
+// Missing scores are blank cells. Reviewers are sorted by name, as in the
+// report; a reviewer who rated a question more than once shows their mean.
+func writeScoresTable(b *strings.Builder, order []string, byQ map[string][]api.Review, title func(string) string, name func(api.Review) string, mask func(string) string) {
+	type tally struct {
+		sum float64
+		n   int
+	}
+	type reviewer struct {
+		id, name string
+		scores   map[string]*tally
+	}
+	var qids []string
+	var reviewers []*reviewer
+	byID := make(map[string]*reviewer)
+	for _, qid := range order {
+		if qid == "" {
+			continue
+		}
+		rated := false
+		for _, r := range byQ[qid] {
+			if r.Response == nil || r.Response.Rating == nil {
+				continue
+			}
+			rated = true
+			key := r.Reviewer.ID
+			if key == "" {
+				key = "\x00" + r.ID
+			}
+			rv, ok := byID[key]
+			if !ok {
+				rv = &reviewer{id: r.Reviewer.ID, name: name(r), scores: make(map[string]*tally)}
+				byID[key] = rv
+				reviewers = append(reviewers, rv)
+			}
+			t := rv.scores[qid]
+			if t == nil {
+				t = &tally{}
+				rv.scores[qid] = t
+			}
+			t.sum += *r.Response.Rating
+			t.n++
+		}
+		if rated {
+			qids = append(qids, qid)
+		}
+	}
+	if len(qids) == 0 {
+		b.WriteString("_No numeric ratings._\n")
+		return
+	}
+	sort.SliceStable(reviewers, func(i, j int) bool {
+		ni, nj := strings.ToLower(reviewers[i].name), strings.ToLower(reviewers[j].name)
+		if ni != nj {
+			return ni < nj
+		}
+		return reviewers[i].id < reviewers[j].id
+	})
+	cell := func(s string) string { return strings.ReplaceAll(s, "|", "\\|") }
+	score := func(v float64) string { return mask(fmt.Sprintf("%.2f", v)) }
+	b.WriteString("## Scores\n\n| Reviewer |")
+	for _, qid := range qids {
+		fmt.Fprintf(b, " %s |", cell(title(qid)))
+	}
+	b.WriteString(" Average |\n| --- |" + strings.Repeat(" ---: |", len(qids)+1) + "\n")
+	cols := make([]tally, len(qids))
+	for _, rv := range reviewers {
+		fmt.Fprintf(b, "| %s |", cell(mask(rv.name)))
+		var row tally
+		for i, qid := range qids {
+			t := rv.scores[qid]
+			if t == nil {
+				b.WriteString(" |")
+				continue
+			}
+			avg := t.sum / float64(t.n)
+			fmt.Fprintf(b, " %s |", score(avg))
+			row.sum += avg
+			row.n++
+			cols[i].sum += t.sum
+			cols[i].n += t.n
+		}
+		fmt.Fprintf(b, " %s |\n", score(row.sum/float64(row.n)))
+	}
+	b.WriteString("| **Average** |")
+	var all tally
+	for _, t := range cols {
+		fmt.Fprintf(b, " %s |", score(t.sum/float64(t.n)))
+		all.sum += t.sum
+		all.n += t.n
+	}
+	fmt.Fprintf(b, " %s |\n", score(all.sum/float64(all.n)))
+}
+
+// parseReviewWeights parses review_weights, a comma-separated list of
+// key=weight pairs such as "manager=2,peer=1". Keys are matched against a
+// review's relationship, then its review type (see reviewWeight), and are
+// case-insensitive. Weights must be non-negative numbers.
+func parseReviewWeights(s string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = weightKey(key)
+		w, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if !ok || key == "" || err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return nil, fmt.Errorf("invalid review_weights entry %q (want key=weight, e.g. manager=2, with a non-negative weight)", strings.TrimSpace(pair))
+		}
+		weights[key] = w
+	}
+	return weights, nil
+}
+
+// weightKey normalizes a relationship, review type, or review_weights key.
+func weightKey(s string) string {
+	return strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// reviewWeight returns the weight for r: its relationship's, else its
+// review type's, else 1.
+func reviewWeight(r api.Review, weights map[string]float64) float64 {
+	if w, ok := weights[weightKey(r.Relationship)]; ok && r.Relationship != "" {
+		return w
+	}
+	if w, ok := weights[weightKey(r.ReviewType)]; ok && r.ReviewType != "" {
+		return w
+	}
+	return 1
+}
+
+// ratingGlyphs renders rating on a 1..scaleMax scale as stars (★★★★☆ 4/5) or a
+// ten-cell bar (████████░░ 4/5). It reports false when the scale is unknown,
+// either value isn't a whole number, or the rating is out of range, so the
+// caller can fall back to the numeric score.
+func ratingGlyphs(rating, scaleMax float64, style string) (string, bool) {
+	if scaleMax <= 0 || scaleMax > 20 || rating < 0 || rating > scaleMax || rating != math.Trunc(rating) || scaleMax != math.Trunc(scaleMax) {
+		return "", false
+	}
+	frac := fmt.Sprintf("%g/%g", rating, scaleMax)
+	switch style {
+	case "stars":
+		n := int(rating)
+		return strings.Repeat("★", n) + strings.Repeat("☆", int(scaleMax)-n) + " " + frac, true
+	case "bar":
+		const cells = 10
+		filled := int(math.Round(rating / scaleMax * cells))
+		return strings.Repeat("█", filled) + strings.Repeat("░", cells-filled) + " " + frac, true
+	}
+	return "", false
+}
+
+// truncateQuote shortens s to at most limit characters, cutting at the last
+// word boundary and marking the cut. limit <= 0 leaves s unchanged.
+func truncateQuote(s string, limit int) string {
+	runes := []rune(s)
+	if limit <= 0 || len(runes) <= limit {
+		return s
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) }) + "… (truncated)"
+}
+
+// encodeText prepares report text for writing to disk: optionally converting
+// LF line endings to CRLF and prefixing a UTF-8 byte order mark, for Windows
+// tools that expect them.
+func encodeText(s string, crlf, bom bool) []byte {
+	if crlf {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+	}
+	if bom {
+		s = "\ufeff" + s
+	}
+	return []byte(s)
+}
+
+// readManagerNotes loads manager notes from path, or from r when path is "-".
+// Line endings are normalized, control characters dropped, and content over
+// maxManagerNotes rejected.
+func readManagerNotes(path string, r io.Reader) (string, error) {
+	if path != "-" {
+		f, ferr := os.Open(path)
+		if ferr != nil {
+			return "", fmt.Errorf("read manager notes: %w", ferr)
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxManagerNotes+1))
+	if err != nil {
+		return "", fmt.Errorf("read manager notes: %w", err)
+	}
+	if len(b) > maxManagerNotes {
+		return "", fmt.Errorf("manager notes exceed %d KiB", maxManagerNotes>>10)
+	}
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, s)
+	return strings.TrimSpace(s), nil
+}
+
+// unresolvedChoice stands in for a selected choice ID with no matching
+// choice definition.
+const unresolvedChoice = "(unresolved choice)"
+
+// choiceIDRe matches values that look like opaque IDs rather than choice
+// text: UUIDs and long hex or digit strings. Labels mixing letters and
+// digits ("Python3", "Q4-2024", "Level10") are common, so they don't count.
+var choiceIDRe = regexp.MustCompile(`(?i)^(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]{16,}|\d{6,})$`)
+
+// looksLikeChoiceID reports whether a selected value is an ID rather than a
+// label.
+func looksLikeChoiceID(v string) bool {
+	return choiceIDRe.MatchString(strings.TrimSpace(v))
+}
+
+// formatChoices renders selected choices by their labels, adding the weight
+// when the question defines one. Values without a matching definition (or
+// when q is nil) are shown as-is, except ID-like values, which would be
+// meaningless to a reader and show as "(unresolved choice)".
+func formatChoices(q *api.Question, selected []string) string {
+	parts := make([]string, 0, len(selected))
+	for _, v := range selected {
+		ch, ok := api.QuestionChoice{}, false
+		if q != nil {
+			ch, ok = q.Choice(v)
+		}
+		if !ok || strings.TrimSpace(ch.Label) == "" {
+			if looksLikeChoiceID(v) {
+				v = unresolvedChoice
+			}
+			parts = append(parts, v)
+			continue
+		}
+		if ch.Weight != nil {
+			parts = append(parts, fmt.Sprintf("%s (weight: %s)", ch.Label, strconv.FormatFloat(*ch.Weight, 'f', -1, 64)))
+		} else {
+			parts = append(parts, ch.Label)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// questionTypeLabel turns an API question type like "multiple_choice" into
+// "multiple choice".
+func questionTypeLabel(t string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(t)), "_", " ")
+}
+
+// markdownPunct is the ASCII punctuation CommonMark allows to be
+// backslash-escaped.
+const markdownPunct = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// escapeMarkdown backslash-escapes Markdown syntax in s so it renders
+// literally: inline markup characters anywhere, and list markers at the start
+// of a line.
+func escapeMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		for _, r := range line {
+			if strings.ContainsRune("\\`*_[]<>#|~", r) {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		line = b.String()
+		rest := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(rest)]
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		switch {
+		case strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") || strings.HasPrefix(rest, "="):
+			line = indent + "\\" + rest
+		case digits > 0 && digits < len(rest) && (rest[digits] == '.' || rest[digits] == ')'):
+			line = indent + rest[:digits] + "\\" + rest[digits:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// htmlToMarkdown rewrites the HTML that rich-text comments commonly contain
+// (paragraphs, line breaks, bold, italics, code, links, and list items) as
+// Markdown. Other tags are left for sanitizeText to strip; ordered lists
+// become bullet lists.
+func htmlToMarkdown(s string) string {
+	s = htmlLinkRe.ReplaceAllString(s, "[$2]($1)")
+	for _, r := range htmlMarkdownRules {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+var (
+	htmlLinkRe        = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	htmlMarkdownRules = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		{regexp.MustCompile(`(?i)</?(strong|b)>`), "**"},
+		{regexp.MustCompile(`(?i)</?(em|i)>`), "*"},
+		{regexp.MustCompile(`(?i)</?code>`), "`"},
+		{regexp.MustCompile(`(?i)<br\s*/?>`), "\n"},
+		{regexp.MustCompile(`(?i)<li[^>]*>\s*`), "\n- "},
+		{regexp.MustCompile(`(?i)</li>`), ""},
+		{regexp.MustCompile(`(?i)</(ul|ol)>|<(ul|ol)[^>]*>`), "\n\n"},
+		{regexp.MustCompile(`(?i)</p>`), "\n\n"},
+	}
+)
+
+func sanitizeText(s string) string {
+	if s == "" {
+		return s
+	}
+	s = html.UnescapeString(s)
+	repls := []struct{ old, new string }{{"<br>", "\n"}, {"<br/>", "\n"}, {"<br />", "\n"}, {"</p>", "\n"}, {"<p>", ""}, {"</li>", "\n"}}
+	for _, r := range repls {
+		s = strings.ReplaceAll(s, r.old, r.new)
+	}
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch r {
+		case '<':
+			inTag = true
+		case '>':
+			if inTag {
+				inTag = false
+			}
+		default:
+			if !inTag {
+				b.WriteRune(r)
+			}
+		}
+	}
+	raw := strings.Split(b.String(), "\n")
+	compact := make([]string, 0, len(raw))
+	prevBlank := false
+	for _, line := range raw {
+		l := strings.TrimRight(line, " 	")
+		isBlank := strings.TrimSpace(l) == ""
+		if isBlank && prevBlank {
+			continue
+		}
+		compact = append(compact, l)
+		prevBlank = isBlank
+	}
+	return strings.TrimSpace(strings.Join(compact, "\n"))
+}
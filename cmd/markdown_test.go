@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	api "tess/internal"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden compares got with testdata/name, or rewrites the file with
+// -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (rerun with -update to accept):\n%s", path, got)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// peerReview is a peer review of question qid by reviewer with a comment.
+func peerReview(id string, reviewer api.UserRef, qid, comment string) api.Review {
+	return api.Review{ID: id, ReviewType: "peer", Reviewer: reviewer, Question: api.QuestionRef{ID: qid}, Response: &api.ReviewResponse{Comment: ptr(comment)}}
+}
+
+// testResolver knows one question, q1, and no users beyond the names
+// embedded in the reviews.
+var testResolver = api.StaticResolver{Questions: map[string]api.Question{"q1": {ID: "q1", Body: "What went well?"}}}
+
+func render(t *testing.T, reviews []api.Review, opts markdownOptions) string {
+	t.Helper()
+	md, err := buildMarkdown(context.Background(), testResolver, "Ada", "Q4", reviews, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestFormatChoices(t *testing.T) {
+	weight := 2.0
+	q := &api.Question{Choices: []api.QuestionChoice{
+		{ID: "3f2b8c1e-9a4d-4e6f-8b2a-1c3d5e7f9a0b", Label: "Strongly agree", Weight: &weight},
+		{ID: "opt_2", Label: "Python3"},
+	}}
+	for _, tc := range []struct {
+		name     string
+		q        *api.Question
+		selected []string
+		want     string
+	}{
+		{"resolved by ID", q, []string{"3f2b8c1e-9a4d-4e6f-8b2a-1c3d5e7f9a0b"}, "Strongly agree (weight: 2)"},
+		{"resolved by label", q, []string{"python3"}, "Python3"},
+		{"labels with digits", nil, []string{"Python3", "Q4-2024", "Level10", "opt_8f2k1"}, "Python3, Q4-2024, Level10, opt_8f2k1"},
+		{"short values", nil, []string{"A", "3", "Yes"}, "A, 3, Yes"},
+		{"unresolved UUID", q, []string{"0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"}, unresolvedChoice},
+		{"long hex and digits", nil, []string{"5f2a9c0e7d1b3a4c", "1234567"}, unresolvedChoice + ", " + unresolvedChoice},
+		{"mixed", q, []string{"opt_2", "Level10", "987654321"}, "Python3, Level10, " + unresolvedChoice},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatChoices(tc.q, tc.selected); got != tc.want {
+				t.Errorf("formatChoices(%q) = %q, want %q", tc.selected, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPeerOrderIsStable(t *testing.T) {
+	reviews := []api.Review{
+		peerReview("1", api.UserRef{ID: "u3", Name: "carol"}, "q1", "Third by name."),
+		peerReview("2", api.UserRef{ID: "u9", Name: "Bob"}, "q1", "Bob with the larger ID."),
+		peerReview("3", api.UserRef{ID: "u1", Name: "Alice"}, "q1", "First by name."),
+		peerReview("4", api.UserRef{ID: "u2", Name: "Bob"}, "q1", "Bob with the smaller ID."),
+		peerReview("5", api.UserRef{ID: "u7"}, "q1", "Reviewer not found."),
+	}
+	want := render(t, reviews, markdownOptions{})
+	checkGolden(t, "peer_order.md", want)
+
+	// Every arrival order renders the same report.
+	perm := []int{0, 1, 2, 3, 4}
+	for range 20 {
+		// Step through permutations by rotating and swapping.
+		perm = append(perm[1:], perm[0])
+		perm[1], perm[3] = perm[3], perm[1]
+		shuffled := make([]api.Review, len(reviews))
+		for i, j := range perm {
+			shuffled[i] = reviews[j]
+		}
+		if got := render(t, shuffled, markdownOptions{}); got != want {
+			t.Fatalf("order %v rendered differently:\n%s", perm, got)
+		}
+	}
+
+	// --sort-by arrival keeps API order instead.
+	arrival := render(t, slices.Clone(reviews), markdownOptions{SortBy: "arrival"})
+	if arrival == want {
+		t.Error("arrival order matched the sorted order")
+	}
+}
+
+// quoteLines returns the blockquote lines of md, without the "> " prefix.
+func quoteLines(md string) []string {
+	var out []string
+	for _, line := range strings.Split(md, "\n") {
+		if rest, ok := strings.CutPrefix(line, ">"); ok {
+			out = append(out, strings.TrimPrefix(rest, " "))
+		}
+	}
+	return out
+}
+
+func TestCommentModes(t *testing.T) {
+	const mixed = "<p>Great **work** on <b>the API</b> &amp; docs</p><ul><li>1. fast</li><li>_clear_</li></ul>"
+	for _, tc := range []struct {
+		html, markdown string
+		want           []string
+	}{
+		{"strip", "interpret", []string{"Great **work** on the API & docs", "1. fast", "_clear_"}},
+		{"strip", "escape", []string{`Great \*\*work\*\* on the API & docs`, `1\. fast`, `\_clear\_`}},
+		{"unescape", "interpret", []string{"<p>Great **work** on <b>the API</b> & docs</p><ul><li>1. fast</li><li>_clear_</li></ul>"}},
+		{"unescape", "escape", []string{`\<p\>Great \*\*work\*\* on \<b\>the API\</b\> & docs\</p\>\<ul\>\<li\>1. fast\</li\>\<li\>\_clear\_\</li\>\</ul\>`}},
+		{"markdown", "interpret", []string{"Great **work** on **the API** & docs", "", "- 1. fast", "- _clear_"}},
+	} {
+		t.Run(tc.html+"/"+tc.markdown, func(t *testing.T) {
+			md := render(t, []api.Review{peerReview("1", api.UserRef{ID: "u1", Name: "Bo"}, "q1", mixed)}, markdownOptions{CommentHTML: tc.html, CommentMarkdown: tc.markdown})
+			if got := quoteLines(md); !slices.Equal(got, tc.want) {
+				t.Errorf("quote = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"plain text, nothing to do.", "plain text, nothing to do."},
+		{"*bold* and _under_ and `code`", `\*bold\* and \_under\_ and \` + "`" + `code\` + "`"},
+		{"- item\n+ item\n  - nested", "\\- item\n\\+ item\n  \\- nested"},
+		{"1. first\n2) second\n3 apples", "1\\. first\n2\\) second\n3 apples"},
+		{"# not a heading\n<b>tag</b> | pipe ~strike~", `\# not a heading` + "\n" + `\<b\>tag\</b\> \| pipe \~strike\~`},
+		{"a-b 1.5 x+y", "a-b 1.5 x+y"},
+		{`back\slash [link](x)`, `back\\slash \[link\](x)`},
+	} {
+		if got := escapeMarkdown(tc.in); got != tc.want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"<strong>a</strong> <B>b</B> <em>c</em> <i>d</i>", "**a** **b** *c* *d*"},
+		{`<a href="https://example.com/x?y=1">the doc</a>`, "[the doc](https://example.com/x?y=1)"},
+		{"one<br>two<br/>three<br />four", "one\ntwo\nthree\nfour"},
+		{"<code>go test</code>", "`go test`"},
+		{"<ol><li>a</li><li>b</li></ol>", "\n\n\n- a\n- b\n\n"},
+		{"<p>para</p><span>left for sanitizeText</span>", "<p>para\n\n<span>left for sanitizeText</span>"},
+	} {
+		if got := htmlToMarkdown(tc.in); got != tc.want {
+			t.Errorf("htmlToMarkdown(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeText(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"", ""},
+		{"Tom &amp; Jerry", "Tom & Jerry"},
+		{"<p>one</p><p>two</p>", "one\ntwo"},
+		{"<ul><li>a</li><li>b</li></ul>", "a\nb"},
+		{"line<br>\n\n\n\nafter", "line\n\nafter"},
+		{"  <span class=\"x\">text</span>  ", "text"},
+	} {
+		if got := sanitizeText(tc.in); got != tc.want {
+			t.Errorf("sanitizeText(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReviewsWithoutQuestionID(t *testing.T) {
+	reviews := []api.Review{
+		peerReview("1", api.UserRef{ID: "u1", Name: "Alice"}, "", "Lost its question."),
+		peerReview("2", api.UserRef{ID: "u2", Name: "Bob"}, "q1", "Answered q1."),
+		peerReview("3", api.UserRef{ID: "u3"}, "", "Also lost."),
+	}
+	self := api.Review{ID: "4", ReviewType: "self", Question: api.QuestionRef{}, Response: &api.ReviewResponse{Comment: ptr("Self, no question.")}}
+	reviews = append(reviews, self)
+
+	var warnings []string
+	md := render(t, reviews, markdownOptions{Warn: func(msg string) { warnings = append(warnings, msg) }})
+
+	wantWarnings := []string{
+		`review 1 from Alice has no question ID; shown under "Uncategorized"`,
+		`review 3 from u3 has no question ID; shown under "Uncategorized"`,
+		`review 4 from an unknown reviewer has no question ID; shown under "Uncategorized"`,
+	}
+	if !slices.Equal(warnings, wantWarnings) {
+		t.Errorf("warnings =\n%q\nwant\n%q", warnings, wantWarnings)
+	}
+	// The bucket comes after the real questions, even though its reviews
+	// arrived first, and holds only the reviews without an ID.
+	peer, selfSection, _ := strings.Cut(md, "## Self Review")
+	q1, unknown := strings.Index(peer, "### What went well?"), strings.Index(peer, "### Uncategorized")
+	if q1 < 0 || unknown < q1 {
+		t.Fatalf("want the Uncategorized heading after the question:\n%s", md)
+	}
+	if got := quoteLines(peer[unknown:]); !slices.Equal(got, []string{"Lost its question.", "Also lost."}) {
+		t.Errorf("Uncategorized quotes = %q", got)
+	}
+	if got := quoteLines(peer[q1:unknown]); !slices.Equal(got, []string{"Answered q1."}) {
+		t.Errorf("question quotes = %q", got)
+	}
+	if !strings.Contains(selfSection, "### Uncategorized\n\n> Self, no question.") {
+		t.Errorf("self section = %q, want the answer under Uncategorized", selfSection)
+	}
+}
+
+func TestUnknownLast(t *testing.T) {
+	for _, tc := range []struct{ in, want []string }{
+		{nil, nil},
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"", "a", "b"}, []string{"a", "b", ""}},
+		{[]string{"a", "", "b"}, []string{"a", "b", ""}},
+	} {
+		if got := unknownLast(slices.Clone(tc.in)); !slices.Equal(got, tc.want) {
+			t.Errorf("unknownLast(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestResponseFieldCombinations(t *testing.T) {
+	rating, ratingLabel := 4.0, "Exceeds"
+	comment := "Shipped the migration early."
+	choices := []string{"Ownership", "Speed"}
+	for _, tc := range []struct {
+		name     string
+		resp     api.ReviewResponse
+		wantLead string
+		want     []string
+	}{
+		{"rating", api.ReviewResponse{Rating: &rating}, "Bo (score: 4.00):", []string{"(no comment)"}},
+		{"rating label", api.ReviewResponse{Rating: &rating, RatingString: &ratingLabel}, "Bo (score: Exceeds):", []string{"(no comment)"}},
+		{"comment", api.ReviewResponse{Comment: &comment}, "Bo:", []string{comment}},
+		{"choices", api.ReviewResponse{Choices: choices}, "Bo:", []string{"Ownership, Speed"}},
+		{"rating and comment", api.ReviewResponse{Rating: &rating, Comment: &comment}, "Bo (score: 4.00):", []string{comment}},
+		{"rating and choices", api.ReviewResponse{Rating: &rating, Choices: choices}, "Bo (score: 4.00):", []string{"Ownership, Speed"}},
+		{"comment and choices", api.ReviewResponse{Comment: &comment, Choices: choices}, "Bo:", []string{comment, "", "(selected: Ownership, Speed)"}},
+		{"all three", api.ReviewResponse{Rating: &rating, Comment: &comment, Choices: choices}, "Bo (score: 4.00):", []string{comment, "", "(selected: Ownership, Speed)"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := tc.resp
+			r := api.Review{ID: "1", ReviewType: "peer", Reviewer: api.UserRef{ID: "u1", Name: "Bo"}, Question: api.QuestionRef{ID: "q1"}, Response: &resp}
+			md := render(t, []api.Review{r}, markdownOptions{})
+			if !strings.Contains(md, "\n"+tc.wantLead+"\n\n>") {
+				t.Errorf("want lead line %q before the quote:\n%s", tc.wantLead, md)
+			}
+			if got := quoteLines(md); !slices.Equal(got, tc.want) {
+				t.Errorf("quote = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// A self review with a rating and no name keeps the score on its own line.
+	self := api.Review{ID: "2", ReviewType: "self", Question: api.QuestionRef{ID: "q1"}, Response: &api.ReviewResponse{Rating: &rating, Comment: &comment}}
+	if md := render(t, []api.Review{self}, markdownOptions{}); !strings.Contains(md, "Score: 4.00\n\n> "+comment) {
+		t.Errorf("self review:\n%s", md)
+	}
+}
+
+func TestDedupeReviews(t *testing.T) {
+	at := func(day int) api.Timestamp { return api.Timestamp{Time: time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC)} }
+	alice := api.UserRef{ID: "u1", Name: "Alice"}
+	draft := peerReview("draft", alice, "q1", "Draft.")
+	draft.SubmittedAt = at(1)
+	final := peerReview("final", alice, "q1", "Final.")
+	final.SubmittedAt = at(2)
+	edited := peerReview("edited", alice, "q1", "Edited later.")
+	edited.SubmittedAt, edited.UpdatedAt = at(1), at(5)
+	empty := api.Review{ID: "empty", ReviewType: "peer", Reviewer: alice, Question: api.QuestionRef{ID: "q1"}, Response: &api.ReviewResponse{}, SubmittedAt: at(9)}
+	undated1, undated2 := peerReview("undated1", alice, "q1", "One."), peerReview("undated2", alice, "q1", "Two.")
+	otherQ := peerReview("otherQ", alice, "q2", "Different question.")
+	selfSame := api.Review{ID: "self", ReviewType: "self", Reviewer: alice, Question: api.QuestionRef{ID: "q1"}, Response: &api.ReviewResponse{Comment: ptr("Self.")}}
+	noReviewer1 := peerReview("anon1", api.UserRef{}, "q1", "Anonymous.")
+	noReviewer2 := peerReview("anon2", api.UserRef{}, "q1", "Anonymous too.")
+
+	for _, tc := range []struct {
+		name string
+		in   []api.Review
+		want []string
+	}{
+		{"later submission wins", []api.Review{draft, final}, []string{"final"}},
+		{"order doesn't matter", []api.Review{final, draft}, []string{"final"}},
+		{"update time counts", []api.Review{final, edited}, []string{"edited"}},
+		{"content beats a newer empty review", []api.Review{draft, empty}, []string{"draft"}},
+		{"undated keeps the later record", []api.Review{undated1, undated2}, []string{"undated2"}},
+		{"winner keeps the first position", []api.Review{draft, otherQ, final}, []string{"final", "otherQ"}},
+		{"review types stay apart", []api.Review{draft, selfSame}, []string{"draft", "self"}},
+		{"missing reviewer is left alone", []api.Review{noReviewer1, noReviewer2}, []string{"anon1", "anon2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, r := range dedupeReviews(tc.in) {
+				got = append(got, r.ID)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("kept %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	md := render(t, []api.Review{draft, final}, markdownOptions{KeepDuplicates: true})
+	if got := quoteLines(md); !slices.Equal(got, []string{"Draft.", "Final."}) {
+		t.Errorf("KeepDuplicates quotes = %q, want both", got)
+	}
+}
+
+func TestRatingGlyphs(t *testing.T) {
+	for _, tc := range []struct {
+		rating, scaleMax float64
+		style, want      string
+		ok               bool
+	}{
+		{4, 5, "stars", "★★★★☆ 4/5", true},
+		{3, 10, "bar", "███░░░░░░░ 3/10", true},
+		{0, 5, "stars", "☆☆☆☆☆ 0/5", true},
+		{3.5, 5, "stars", "", false},
+		{6, 5, "stars", "", false},
+		{4, 0, "bar", "", false},
+		{4, 5, "number", "", false},
+	} {
+		got, ok := ratingGlyphs(tc.rating, tc.scaleMax, tc.style)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ratingGlyphs(%g, %g, %s) = %q, %t; want %q, %t", tc.rating, tc.scaleMax, tc.style, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestTruncateQuote(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"short", 0, "short"},
+		{"short", 10, "short"},
+		{"Great work, really great.", 12, "Great work… (truncated)"},
+		{"abcdefghij", 4, "abcd… (truncated)"},
+	} {
+		if got := truncateQuote(tc.s, tc.limit); got != tc.want {
+			t.Errorf("truncateQuote(%q, %d) = %q, want %q", tc.s, tc.limit, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	api "tess/internal"
+)
+
+// runPrewarm handles `tess prewarm`: it fetches and caches the direct
+// reports and the cycle list, then records every report's membership in
+// every cycle in the membership cache, so later interactive and batch runs
+// skip those fetches. Each cycle's reviewee list is fetched once. It returns
+// the process exit code.
+func runPrewarm(args []string) int {
+	fs := flag.NewFlagSet("prewarm", flag.ExitOnError)
+	cfgFlag := fs.String("config", "", "Path to config TOML (default: ~/.tess/config.toml)")
+	fs.Parse(args)
+	cfgPath := *cfgFlag
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = api.DefaultConfigPath(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error determining working directory: %v\n", err)
+		return 1
+	}
+	cfg, err := api.LoadEffectiveConfig(cfgPath, cwd, nil)
+	printConfigWarning(cfg)
+	if err == nil {
+		err = cfg.RequireAPIKey()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	dir, err := api.DefaultCacheDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nothing to prewarm: %v\n", err)
+		return 1
+	}
+	client, err := api.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init api client: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	me, err := client.GetMe(ctx)
+	if err != nil {
+		return apiErrorCode("failed to fetch current user", err)
+	}
+	reports, err := client.ListUsersByURL(ctx, me.DirectReports.URL)
+	if err != nil {
+		return apiErrorCode("failed to fetch direct reports", err)
+	}
+	cycles, err := client.ListReviewCycles(ctx)
+	if err != nil {
+		return apiErrorCode("failed to fetch review cycles", err)
+	}
+	printWarnings(client)
+	fmt.Fprintf(os.Stderr, "Checking %d direct reports across %d review cycles...\n", len(reports), len(cycles))
+
+	lists := api.LoadListCache(dir, api.DefaultCacheTTL)
+	lists.Store(*me, reports, cycles)
+	cache := api.LoadMembershipCache(dir, api.DefaultCacheTTL, cycles)
+	memberships, failed := 0, 0
+	for _, cy := range cycles {
+		list, err := client.ListRevieweesByURL(ctx, cy.Reviewees.URL)
+		if errors.Is(err, api.ErrUnauthorized) {
+			return apiErrorCode("failed to fetch reviewees", err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not check cycle %q (%s): %v\n", cy.Name, cy.ID, err)
+			failed++
+			continue
+		}
+		records := make(map[string][]api.Reviewee, len(list))
+		for _, rv := range list {
+			records[rv.User.ID] = append(records[rv.User.ID], rv)
+		}
+		// As in the interactive flow, repeat enrollments aren't cached.
+		for _, u := range reports {
+			recs := records[u.ID]
+			if len(recs) > 1 {
+				continue
+			}
+			reviewsURL := ""
+			if len(recs) == 1 {
+				reviewsURL = recs[0].Reviews.URL
+			}
+			cache.Store(cy.ID, u.ID, reviewsURL, len(recs) == 1)
+			memberships++
+		}
+	}
+	printWarnings(client)
+	if err := errors.Join(lists.Save(), cache.Save()); err != nil {
+		fmt.Fprintf(os.Stderr, "could not save cache: %v\n", err)
+		return 1
+	}
+	entries := len(reports) + len(cycles) + memberships
+	fmt.Printf("Cached %d entries (%d direct reports, %d cycles, %d memberships from %d of %d cycles) in %s\n", entries, len(reports), len(cycles), memberships, len(cycles)-failed, len(cycles), time.Since(start).Round(100*time.Millisecond))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	api "tess/internal"
+)
+
+// questionInfo is one row of `tess questions` output.
+type questionInfo struct {
+	ID       string `json:"id"`
+	Type     string `json:"type,omitempty"`
+	Category string `json:"category,omitempty"`
+	Body     string `json:"body"`
+	// Responses is how many of the cycle's reviews answer the question.
+	Responses int    `json:"responses"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runQuestions handles `tess questions`: it lists the distinct questions
+// answered in a review cycle, found by reading every reviewee's reviews and
+// resolving each question ID once. Review lists and question lookups run
+// on --concurrency workers. Questions print in the order they first appear.
+// It returns the process exit code.
+func runQuestions(args []string) int {
+	fs := flag.NewFlagSet("questions", flag.ExitOnError)
+	cfgFlag := fs.String("config", "", "Path to config TOML (default: ~/.tess/config.toml)")
+	cycleID := fs.String("cycle-id", "", "Lattice ID of the review cycle (required)")
+	asJSON := fs.Bool("json", false, "Print the questions as a JSON array")
+	concurrency := fs.Int("concurrency", defaultBatchConcurrency, "How many review lists and questions to fetch at once")
+	fs.Parse(args)
+	*cycleID = strings.TrimSpace(*cycleID)
+	if *cycleID == "" {
+		fmt.Fprintln(os.Stderr, "tess questions requires --cycle-id")
+		return 1
+	}
+	if *concurrency < 1 {
+		fmt.Fprintf(os.Stderr, "invalid --concurrency %d (want at least 1)\n", *concurrency)
+		return 1
+	}
+	cfgPath := *cfgFlag
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = api.DefaultConfigPath(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error determining working directory: %v\n", err)
+		return 1
+	}
+	cfg, err := api.LoadEffectiveConfig(cfgPath, cwd, nil)
+	printConfigWarning(cfg)
+	if err == nil {
+		err = cfg.RequireAPIKey()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	client, err := api.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init api client: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	cycles, err := client.ListReviewCycles(ctx)
+	if err != nil {
+		return apiErrorCode("failed to fetch review cycles", err)
+	}
+	var cycle *api.ReviewCycle
+	for i := range cycles {
+		if cycles[i].ID == *cycleID {
+			cycle = &cycles[i]
+			break
+		}
+	}
+	if cycle == nil {
+		fmt.Fprintf(os.Stderr, "no review cycle with ID %q\n", *cycleID)
+		return 1
+	}
+	reviewees, err := client.ListRevieweesByURL(ctx, cycle.Reviewees.URL)
+	if err != nil {
+		return apiErrorCode("failed to fetch reviewees", err)
+	}
+	fmt.Fprintf(os.Stderr, "Reading reviews of %d reviewees in %q...\n", len(reviewees), cycle.Name)
+
+	// Each reviewee's question IDs are kept in its own slot so the merged
+	// order doesn't depend on which worker finished first.
+	perReviewee := make([][]string, len(reviewees))
+	failed := 0
+	var mu sync.Mutex
+	var authErr error
+	forEachConcurrently(len(reviewees), *concurrency, func(i int) {
+		rv := reviewees[i]
+		reviews, err := client.ListReviewsByURL(ctx, rv.Reviews.URL, 0, 0)
+		if err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, api.ErrUnauthorized) {
+				authErr = err
+				return
+			}
+			fmt.Fprintf(os.Stderr, "warning: could not read reviews for %s: %v\n", cmp.Or(rv.User.Name, rv.User.ID), err)
+			failed++
+			return
+		}
+		ids := make([]string, 0, len(reviews))
+		for _, r := range reviews {
+			if id := strings.TrimSpace(r.Question.ID); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		perReviewee[i] = ids
+	})
+	if authErr != nil {
+		return apiErrorCode("failed to fetch reviews", authErr)
+	}
+
+	var questions []questionInfo
+	index := make(map[string]int)
+	for _, ids := range perReviewee {
+		for _, id := range ids {
+			if i, ok := index[id]; ok {
+				questions[i].Responses++
+				continue
+			}
+			index[id] = len(questions)
+			questions = append(questions, questionInfo{ID: id, Responses: 1})
+		}
+	}
+	forEachConcurrently(len(questions), *concurrency, func(i int) {
+		q, err := client.GetQuestionByID(ctx, questions[i].ID)
+		if err != nil {
+			questions[i].Error = err.Error()
+			return
+		}
+		questions[i].Type, questions[i].Category, questions[i].Body = q.Type, string(q.Category), q.Body
+	})
+	printWarnings(client)
+
+	if *asJSON {
+		if questions == nil {
+			questions = []questionInfo{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(questions); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		for _, q := range questions {
+			typ := q.Type
+			if typ == "" {
+				typ = "-"
+			}
+			body := strings.Join(strings.Fields(q.Body), " ")
+			if q.Error != "" {
+				body = "(lookup failed: " + q.Error + ")"
+			}
+			fmt.Printf("%s\t%s\t%s\n", q.ID, typ, body)
+		}
+	}
+	lookupErrs := 0
+	for _, q := range questions {
+		if q.Error != "" {
+			lookupErrs++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d distinct questions in %q\n", len(questions), cycle.Name)
+	if failed > 0 || lookupErrs > 0 {
+		fmt.Fprintf(os.Stderr, "incomplete: %d review lists and %d questions could not be fetched\n", failed, lookupErrs)
+		return 1
+	}
+	return 0
+}
+
+// forEachConcurrently calls fn(i) for every i in [0, n) on up to workers
+// goroutines and waits for all of them.
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	api "tess/internal"
+)
+
+// defaultDocTitle is the uploaded Drive document title: fixed for clarity
+// across cycles.
+const defaultDocTitle = "Peer & Self Reviews"
+
+// outputPlan holds the settings for turning a reportSubject into files and
+// uploads. Batch workers share one read-only copy.
+type outputPlan struct {
+	Config   api.EffectiveConfig
+	Markdown markdownOptions
+	Pandoc   api.PandocOptions
+	CRLF     bool
+	BOM      bool
+	// DocTitle is the Drive document title, without extension.
+	DocTitle string
+	// Anonymize replaces peer reviewer names with codes; the mapping is
+	// returned in reportOutcome.Legend.
+	Anonymize bool
+	// FrontMatter lists the keys of a YAML front matter block prepended to
+	// the local Markdown file (see frontMatterKeys); empty means none.
+	FrontMatter []string
+	// FileName overrides the local Markdown file name (default:
+	// outputFileName for the user and cycle).
+	FileName string
+	// ReviewerBadges puts an avatar or initials badge next to each peer
+	// reviewer in the HTML upload; produceReport fills Badges from it.
+	ReviewerBadges bool
+	Badges         map[string]string
+	// Uploader stores the converted report (and bundle) when a Drive folder
+	// is configured; see --uploader.
+	Uploader api.Uploader
+}
+
+// reportOutcome records what produceReport wrote and uploaded.
+type reportOutcome struct {
+	File          string
+	ConvertedPath string
+	URL           string
+	Uploaded      bool
+	// Legend maps reviewer codes to names when the plan anonymizes.
+	Legend []legendEntry
+	// Tools notes each external tool step and its effect, or why it was
+	// skipped, for the end-of-run summary (see toolsLine).
+	Tools []string
+}
+
+// stepFunc runs one named step of producing a report. The interactive flow
+// shows a spinner for each step; batch workers log the title instead.
+type stepFunc func(title string, fn func(context.Context) (any, error)) (any, error)
+
+// produceReport renders subj to Markdown and writes it, then converts and
+// uploads it when a Drive folder is configured. note receives non-fatal
+// notices, such as a skipped upload.
+func produceReport(ctx context.Context, subj reportSubject, plan outputPlan, step stepFunc, note func(string)) (reportOutcome, error) {
+	md, legend, err := renderReport(ctx, subj, plan, step, note)
+	if err != nil {
+		return reportOutcome{}, err
+	}
+	if plan.FileName == "" {
+		plan.FileName = outputFileName(subj.User.Name, subj.Cycle.Name)
+	}
+	if plan.ReviewerBadges {
+		plan.Badges = reviewerBadges(ctx, subj, legend)
+	}
+	out, err := publishMarkdown(ctx, frontMatter(subj, plan, time.Now()), md, plan, step, note)
+	out.Legend = legend
+	return out, err
+}
+
+// renderReport builds the Markdown for subj, and the reviewer legend when the
+// plan anonymizes. Data warnings are collected
+// during the step and passed to note afterwards, so they don't interleave
+// with a spinner.
+func renderReport(ctx context.Context, subj reportSubject, plan outputPlan, step stepFunc, note func(string)) (string, []legendEntry, error) {
+	var warnings []string
+	var legend []legendEntry
+	opts := plan.Markdown
+	opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+	mdAny, err := step("Generating markdown...", func(c context.Context) (any, error) {
+		reviews := subj.Reviews
+		if plan.Anonymize {
+			reviews, legend = anonymizeReviews(c, subj.Resolver, reviews)
+		}
+		return buildMarkdown(c, subj.Resolver, subj.User.Name, subj.Cycle.Name, reviews, opts)
+	})
+	for _, w := range warnings {
+		note("warning: " + w)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("build markdown failed: %w", err)
+	}
+	return mdAny.(string), legend, nil
+}
+
+// publishMarkdown writes front matter fm (if any) and md to plan.FileName,
+// then converts and uploads it when a Drive folder is configured. Pandoc is
+// given md alone, so the document still starts with its H1 title.
+func publishMarkdown(ctx context.Context, fm, md string, plan outputPlan, step stepFunc, note func(string)) (reportOutcome, error) {
+	out := reportOutcome{File: plan.FileName}
+	if err := os.WriteFile(out.File, encodeText(fm+md, plan.CRLF, plan.BOM), 0644); err != nil {
+		return out, fmt.Errorf("failed to write file: %w", err)
+	}
+	source := out.File
+
+	cfg := plan.Config
+	if strings.TrimSpace(cfg.RcloneFolderID) == "" {
+		return out, nil
+	}
+	via := plan.Uploader.Name()
+	fmtStr := uploadFormat(cfg)
+	if fmtStr == "html" {
+		// Tess renders the HTML itself, so pandoc isn't needed.
+		htmlPath := filepath.Join(api.TempDir(), plan.DocTitle+".html")
+		if err := os.WriteFile(htmlPath, []byte(buildHTMLDocument(plan.DocTitle, md, plan.Badges)), 0644); err != nil {
+			return out, fmt.Errorf("failed to write HTML: %w", err)
+		}
+		out.ConvertedPath = htmlPath
+		uploadAny, err := step("Uploading via "+via+"...", func(c context.Context) (any, error) {
+			return plan.uploadFile(c, htmlPath, plan.DocTitle, "html")
+		})
+		out.URL, out.Uploaded, err = uploadedLink(uploadAny, err)
+		if err != nil {
+			return out, fmt.Errorf("%s upload failed: %w", via, err)
+		}
+		out.Tools = append(out.Tools, uploadTool(plan.Uploader, "", out.URL))
+		return out, nil
+	}
+	if err := api.HasPandoc(); err != nil {
+		note("pandoc not found; skipping " + plan.Uploader.Destination() + " upload via " + via + ". Install pandoc to enable document export.")
+		out.Tools = append(out.Tools, "pandoc not found (upload skipped)")
+		return out, nil
+	}
+	if fm != "" {
+		source = filepath.Join(api.TempDir(), plan.DocTitle+".md")
+		if err := os.WriteFile(source, []byte(md), 0644); err != nil {
+			return out, fmt.Errorf("failed to write conversion input: %w", err)
+		}
+		defer os.Remove(source)
+	}
+	var (
+		uploadAny any
+		err       error
+	)
+	if fmtStr == "pdf" {
+		pdfPath := filepath.Join(api.TempDir(), plan.DocTitle+".pdf")
+		// Force a specific engine if provided; tectonic is preferred for LaTeX flow and sans font support.
+		engine := strings.TrimSpace(cfg.PDFEngine)
+		if _, err := step("Converting to PDF...", func(c context.Context) (any, error) {
+			return nil, api.ConvertMarkdownToPDFWithEngine(c, source, pdfPath, engine, plan.Pandoc)
+		}); errors.Is(err, api.ErrNoPDFEngine) {
+			return out, err
+		} else if err != nil {
+			return out, fmt.Errorf("pandoc conversion failed: %w", err)
+		}
+		out.ConvertedPath = pdfPath
+		out.Tools = append(out.Tools, "pandoc "+api.Glyphs.Arrow+" PDF")
+		// Upload as a regular PDF file (no import)
+		uploadAny, err = step("Uploading PDF via "+via+"...", func(c context.Context) (any, error) {
+			return plan.uploadFile(c, pdfPath, plan.DocTitle+".pdf", "")
+		})
+	} else {
+		docxPath := filepath.Join(api.TempDir(), plan.DocTitle+".docx")
+		if _, err := step("Converting to DOCX...", func(c context.Context) (any, error) {
+			return nil, api.ConvertMarkdownToDOCX(c, source, docxPath, plan.Pandoc)
+		}); err != nil {
+			return out, fmt.Errorf("pandoc conversion failed: %w", err)
+		}
+		out.ConvertedPath = docxPath
+		out.Tools = append(out.Tools, "pandoc "+api.Glyphs.Arrow+" DOCX")
+		uploadAny, err = step("Uploading via "+via+"...", func(c context.Context) (any, error) {
+			return plan.uploadFile(c, docxPath, plan.DocTitle, "docx")
+		})
+	}
+	out.URL, out.Uploaded, err = uploadedLink(uploadAny, err)
+	if err != nil {
+		return out, fmt.Errorf("%s upload failed: %w", via, err)
+	}
+	out.Tools = append(out.Tools, uploadTool(plan.Uploader, "", out.URL))
+	return out, nil
+}
+
+// uploadFile sends path to the plan's uploader as name and returns a link.
+// A non-empty importFormat ("docx" or "html") asks for a native document.
+func (p outputPlan) uploadFile(ctx context.Context, path, name, importFormat string) (string, error) {
+	res, err := p.Uploader.Upload(ctx, path, api.UploadOptions{Name: name, ImportFormat: importFormat})
+	return res.Link, err
+}
+
+// uploadTool describes an upload of what (empty for the report itself) by
+// u for the tools summary, e.g. "rclone → s3 (link)".
+func uploadTool(u api.Uploader, what, link string) string {
+	s := u.Name() + " " + api.Glyphs.Arrow + " " + u.Destination()
+	if what != "" {
+		s += " (" + what + ")"
+	}
+	if link == "" {
+		return s + " (no link)"
+	}
+	return s + " (link)"
+}
+
+// toolsLine summarizes the external tools a run used, e.g. "Tools: pandoc →
+// DOCX, rclone → Drive (link)", or "" when none ran.
+func toolsLine(tools []string) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	return "Tools: " + strings.Join(tools, ", ")
+}
+
+// reviewerBadges maps each peer reviewer's rendered name to an inline HTML
+// badge: their avatar when the API provides one, otherwise their initials.
+// Anonymized reports get the code's letter instead, never the avatar.
+func reviewerBadges(ctx context.Context, subj reportSubject, legend []legendEntry) map[string]string {
+	badges := make(map[string]string)
+	if legend != nil {
+		for _, e := range legend {
+			badges[e.Code] = initialsBadge(strings.TrimPrefix(e.Code, "Reviewer "))
+		}
+		return badges
+	}
+	for _, r := range subj.Reviews {
+		if strings.ToLower(r.ReviewType) == "self" || r.Reviewer.ID == "" {
+			continue
+		}
+		u, err := subj.Resolver.ResolveUser(ctx, r.Reviewer)
+		if err != nil || strings.TrimSpace(u.Name) == "" {
+			continue
+		}
+		if _, ok := badges[u.Name]; ok {
+			continue
+		}
+		if avatar := strings.TrimSpace(u.AvatarURL); avatar != "" {
+			badges[u.Name] = fmt.Sprintf(`<img src="%s" alt="" width="20" height="20">`, html.EscapeString(avatar))
+		} else {
+			badges[u.Name] = initialsBadge(initials(u.Name))
+		}
+	}
+	return badges
+}
+
+// initialsBadge renders text as a small grey badge.
+func initialsBadge(text string) string {
+	return fmt.Sprintf(`<span style="background:#d9d9d9;color:#333333;font-weight:bold;padding:1px 4px">%s</span>`, html.EscapeString(text))
+}
+
+// initials returns the upper-cased first letters of the first and last
+// words of name.
+func initials(name string) string {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ""
+	}
+	first := func(w string) string { return strings.ToUpper(string([]rune(w)[:1])) }
+	if len(words) == 1 {
+		return first(words[0])
+	}
+	return first(words[0]) + first(words[len(words)-1])
+}
+
+// frontMatterKeys lists the accepted --front-matter-keys, in output order.
+var frontMatterKeys = []string{"user", "email", "cycle", "date", "reviewer_count", "avg_score"}
+
+// frontMatter returns a YAML front matter block with the plan's keys for
+// subj, or "" when the plan has none. reviewer_count counts distinct peer
+// reviewers; avg_score is the mean numeric peer rating (null when there are
+// none, and left out with --censor). Values are JSON-quoted, which YAML
+// accepts.
+func frontMatter(subj reportSubject, plan outputPlan, now time.Time) string {
+	if len(plan.FrontMatter) == 0 {
+		return ""
+	}
+	reviewers := make(map[string]bool)
+	var sum float64
+	var n int
+	for _, r := range subj.Reviews {
+		if strings.ToLower(r.ReviewType) == "self" {
+			continue
+		}
+		reviewers[r.Reviewer.ID] = true
+		if r.Response != nil && r.Response.Rating != nil {
+			sum += *r.Response.Rating
+			n++
+		}
+	}
+	quote := func(v string) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, key := range frontMatterKeys {
+		if !slices.Contains(plan.FrontMatter, key) {
+			continue
+		}
+		switch key {
+		case "user":
+			fmt.Fprintf(&b, "user: %s\n", quote(subj.User.Name))
+		case "email":
+			fmt.Fprintf(&b, "email: %s\n", quote(subj.User.Email))
+		case "cycle":
+			fmt.Fprintf(&b, "cycle: %s\n", quote(subj.Cycle.Name))
+		case "date":
+			fmt.Fprintf(&b, "date: %s\n", now.Format("2006-01-02"))
+		case "reviewer_count":
+			fmt.Fprintf(&b, "reviewer_count: %d\n", len(reviewers))
+		case "avg_score":
+			switch {
+			case plan.Markdown.Censor:
+			case n == 0:
+				b.WriteString("avg_score: null\n")
+			default:
+				fmt.Fprintf(&b, "avg_score: %.2f\n", sum/float64(n))
+			}
+		}
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// uploadFormats lists the accepted upload formats.
+var uploadFormats = []string{"docx", "html", "pdf"}
+
+// uploadFormat returns the configured upload format, "docx", "html", or
+// "pdf"; anything else means docx.
+func uploadFormat(cfg api.EffectiveConfig) string {
+	if f := strings.ToLower(strings.TrimSpace(cfg.UploadFormat)); f == "pdf" || f == "html" {
+		return f
+	}
+	return "docx"
+}
+
+// checkUploadTools fails fast, before any API work, when an upload is
+// configured but the tools for the upload format are missing. The uploader
+// checks its own requirements in api.NewUploader.
+func checkUploadTools(cfg api.EffectiveConfig) error {
+	if strings.TrimSpace(cfg.RcloneFolderID) == "" {
+		return nil
+	}
+	if err := api.CheckFormatTools(uploadFormat(cfg)); err != nil {
+		return fmt.Errorf("%v (or unset rclone_folder_id to skip the upload)", err)
+	}
+	return nil
+}
+
+// uploadedLink interprets a CopyToAndLink result. An upload whose link is
+// unavailable still counts as uploaded.
+func uploadedLink(v any, err error) (link string, uploaded bool, _ error) {
+	if err != nil && !errors.Is(err, api.ErrLinkUnavailable) {
+		return "", false, err
+	}
+	link, _ = v.(string)
+	return strings.TrimSpace(link), true, nil
+}
+
+// statusOut receives the closing status lines ("Wrote ...", "Uploaded ...")
+// and the TUI. --stdout moves it to stderr so stdout carries only the report.
+var statusOut io.Writer = os.Stdout
+
+// printUploaded reports a finished upload, making clear when it succeeded
+// without a shareable link.
+func printUploaded(uploaded bool, link string) {
+	switch {
+	case !uploaded:
+	case link != "":
+		fmt.Fprintf(statusOut, "Uploaded %s\n", link)
+	default:
+		fmt.Fprintln(statusOut, "Uploaded (link unavailable: sharing may be disabled)")
+	}
+}
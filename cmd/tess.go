@@ -1,17 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"html"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 
 	bubspinner "github.com/charmbracelet/bubbles/spinner"
@@ -19,76 +23,6 @@ import (
 	api "tess/internal"
 )
 
-type fileConfig struct {
-	APIKey           string
-	RcloneRemote     string
-	TemplateHubID    string
-	TemplateCoverID  string
-	TemplateReviewID string
-}
-
-func defaultConfigPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(home, ".tess", "config.toml"), nil
-}
-
-func loadConfigFromTOML(path string) (fileConfig, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return fileConfig{}, fmt.Errorf("config file not found: %s", path)
-		}
-		return fileConfig{}, err
-	}
-	defer f.Close()
-	var cfg fileConfig
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if i := strings.Index(line, "#"); i >= 0 {
-			line = line[:i]
-		}
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "[") {
-			continue
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		val := strings.TrimSpace(parts[1])
-		val = strings.Trim(val, " \t")
-		if len(val) >= 2 {
-			if (val[0] == '"' && val[len(val)-1] == '"') || (val[0] == '\'' && val[len(val)-1] == '\'') {
-				val = val[1 : len(val)-1]
-			}
-		}
-		switch key {
-		case "api_key":
-			cfg.APIKey = val
-		case "rclone_remote":
-			cfg.RcloneRemote = strings.TrimSpace(val)
-		case "template_hub_id":
-			cfg.TemplateHubID = strings.TrimSpace(val)
-		case "template_cover_id":
-			cfg.TemplateCoverID = strings.TrimSpace(val)
-		case "template_review_id":
-			cfg.TemplateReviewID = strings.TrimSpace(val)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return fileConfig{}, err
-	}
-	if strings.TrimSpace(cfg.APIKey) == "" {
-		return fileConfig{}, fmt.Errorf("missing 'api_key' in config: %s", path)
-	}
-	return cfg, nil
-}
-
 func main() {
 	// Custom usage to include subcommands
 	flag.Usage = func() {
@@ -96,45 +30,189 @@ func main() {
 		fmt.Fprintf(out, "Tess — generate review summaries and optionally upload to Drive\n\n")
 		fmt.Fprintf(out, "Usage:\n")
 		fmt.Fprintf(out, "  tess [flags]\n")
-		fmt.Fprintf(out, "  tess setup\n")
-		fmt.Fprintf(out, "  tess doctor\n\n")
+		fmt.Fprintf(out, "  tess [--user-id ID] [--cycle-id ID] [flags]\n")
+		fmt.Fprintf(out, "  tess --batch --cycle NAME|--cycle-id ID [--concurrency N] [--combined [--toc]] [flags]\n")
+		fmt.Fprintf(out, "  tess setup [--non-interactive --api-key KEY [--rclone-remote NAME] [--folder-id ID]]\n")
+		fmt.Fprintf(out, "  tess doctor [--fail-on-warning] [--json] [--ascii]\n")
+		fmt.Fprintf(out, "  tess preset save NAME [--user-id ID] [--cycle-id ID] [--upload-format F] [--rclone-folder-id ID]\n\n")
 		fmt.Fprintf(out, "Subcommands:\n")
 		fmt.Fprintf(out, "  setup   First-time configuration wizard (writes ~/.tess/config.toml)\n")
 		fmt.Fprintf(out, "  doctor  Environment and API diagnostics\n")
+		fmt.Fprintf(out, "  capabilities  Report available formats, PDF engines, pandoc, rclone, and remotes (--json for tools)\n")
+		fmt.Fprintf(out, "  config  Manage the config file (restore, show [--json])\n")
+		fmt.Fprintf(out, "  preset  Save or list report presets for --preset (save, list)\n")
+		fmt.Fprintf(out, "  prewarm Cache every direct report's cycle membership so later runs start fast\n")
+		fmt.Fprintf(out, "  questions  List the questions answered in a cycle (--cycle-id ID [--json])\n")
+		fmt.Fprintf(out, "  demo    Write a sample report from built-in data (no API key needed)\n")
 		fmt.Fprintf(out, "  version Print the current version\n\n")
 		fmt.Fprintf(out, "Flags:\n")
-		flag.PrintDefaults()
+		printVisibleDefaults(out)
 	}
 
 	// Define flags first so --help shows them even without parsing
+	reviewsURL := flag.String("reviews-url", "", "") // hidden; see hiddenFlags
 	cfgFlag := flag.String("config", "", "Path to config TOML (default: ~/.tess/config.toml)")
-	rcloneRemote := flag.String("rclone-remote", "drive", "rclone remote name to upload to (default: drive)")
-	rcloneFolderID := flag.String("rclone-folder-id", "", "Google Drive folder ID; if set, upload via rclone to this folder")
-	uploadFormat := flag.String("upload-format", "docx", "Upload format when using rclone: docx (Google Doc import) or pdf")
-	pdfEngine := flag.String("pdf-engine", "", "Preferred PDF engine for pandoc (e.g., tectonic, xelatex). Leave empty for auto.")
+	flag.String("preset", "", "Load user, cycle, upload format, and folder from a preset saved with `tess preset save`; flags and env vars still win")
+	rcloneConcurrency := flag.Int("rclone-concurrency", api.DefaultRcloneConcurrency, "Maximum rclone processes running at once (separate from --concurrency)")
+	rcloneConfigPassEnv := flag.String("rclone-config-pass-env", "", "Name of an environment variable holding the password for an encrypted rclone config")
+	verifyUpload := flag.Bool("verify-upload", false, "After each upload, list the destination and fail unless the file is there (one extra rclone call)")
+	printCommands := flag.Bool("print-commands", false, "Print each pandoc and rclone command line to stderr before running it (secrets redacted)")
+	strict := flag.Bool("strict", false, "Fail when the reviewee appears more than once in a cycle instead of using the most recent record")
+	checkUpdates := flag.Bool("check-updates", false, "Ask GitHub for the latest Tess release and print a notice at the end if it is newer (off by default; a failed check is ignored)")
+	quiet := flag.Bool("quiet", false, "Don't print the selected user and cycle to stderr before fetching, or the tools summary at the end")
+	ascii := flag.Bool("ascii", false, "Use plain ASCII status markers ([OK]/[WARN]/[FAIL]) instead of ✓/!/✗ (automatic when TERM is dumb, linux, vt100, ...)")
+	flag.String("api-key-file", "", "Read the Lattice API key from this file (overrides api_key in config; TESS_API_KEY still wins)")
+	flag.String("rclone-remote", "drive", "rclone remote name to upload to (default: drive)")
+	flag.String("rclone-folder-id", "", "Google Drive folder ID; if set, upload via rclone to this folder")
+	flag.String("uploader", "rclone", "How reports reach the Drive folder: rclone or drive-api (Google Drive API with a stored OAuth token)")
+	driveAPIFlag := flag.Bool("drive-api", false, "Shorthand for --uploader drive-api")
+	flag.String("drive-token-file", "", "With --drive-api, the OAuth token JSON to use (default: ~/.tess/drive_token.json)")
+	flag.String("upload-format", "docx", "Upload format when using rclone: docx (Google Doc import), html (Google Doc import, no pandoc needed), or pdf")
+	flag.String("rclone-extra-args", "", "Extra arguments appended to every rclone call (quoted like a shell, e.g. \"--drive-impersonate me@example.com\")")
+	flag.String("auth-header", "Authorization", "HTTP header that carries the API key, for gateways that expect e.g. X-Api-Key")
+	flag.String("api-retries", "3", "Times to retry a Lattice API request that gets a 429 or 5xx response (0 = no retries)")
+	flag.String("review-weights", "", "Weights for the --summary weighted average by reviewer relationship or review type, e.g. \"manager=2,peer=1\" (unlisted count 1)")
+	flag.String("auth-value-template", "", "Shape of the auth header value, with {key} for the API key (e.g. \"Token {key}\"); default adds Bearer")
+	flag.String("shared-drive-id", "", "Shared Drive (Team Drive) ID when the target folder lives on a Shared Drive")
+	flag.String("service-account-file", "", "Google service account JSON for headless Drive uploads (passed to rclone)")
+	flag.String("tmp-dir", "", "Directory for intermediate DOCX/PDF and pandoc helper files (default: the system temp dir)")
+	flag.String("pdf-engine", "", "Preferred PDF engine for pandoc (e.g., tectonic, xelatex). Leave empty for auto.")
+	flag.String("markdown-flavor", api.DefaultMarkdownFlavor, "Pandoc Markdown input format: gfm, markdown, commonmark_x, ... (extensions like markdown+footnotes allowed)")
+	var pandocVars repeatedFlag
+	flag.Var(&pandocVars, "pandoc-var", "Extra pandoc template variable as key=value, passed as -V (repeatable)")
+	flag.Var(&pandocVars, "V", "Shorthand for --pandoc-var")
+	var luaFilters repeatedFlag
+	flag.Var(&luaFilters, "lua-filter", "Pandoc Lua filter to apply to DOCX/PDF conversions (repeatable; needs pandoc with Lua support)")
+	pandocTimeout := flag.Duration("pandoc-timeout", api.DefaultPandocTimeout, "Kill a pandoc conversion that runs longer than this (0 = no limit)")
+	rcloneTimeout := flag.Duration("rclone-timeout", api.DefaultRcloneTimeout, "Kill an rclone call that runs longer than this (0 = no limit)")
 	copyTemplates := flag.Bool("copy-templates", false, "Copy template docs into the Drive folder after export")
+	templateConflict := flag.String("template-conflict", "duplicate", "With --copy-templates, when the folder already has a file with a template's name: duplicate, skip, or rename (move the old one aside)")
+	renameExisting := flag.Bool("rename-existing", false, "Shorthand for --template-conflict rename")
+	refresh := flag.Bool("refresh", false, "Ignore cached cycle membership and prewarmed lists and refetch from the API")
+	cacheTTL := flag.Duration("cache-ttl", api.DefaultCacheTTL, "How long cached cycle membership and prewarmed lists stay valid")
+	limitCycles := flag.Int("limit-cycles", 0, "Only scan the N most recent review cycles when filtering (0 = all)")
+	sortCycles := flag.String("sort-cycles", "alpha", "Cycle list order: alpha, or recent (newest first; undated cycles last, alphabetically)")
+	maxReviews := flag.Int("max-reviews", 0, "Maximum number of reviews to fetch for the cycle (0 = all)")
+	exportJSON := flag.String("export-json", "", "Also write the raw report data as versioned JSON to this path")
+	bundle := flag.String("bundle", "", "Also write a zip with the Markdown, any converted DOCX/PDF, the JSON export, and a manifest")
+	uploadBundle := flag.Bool("upload-bundle", false, "Upload the --bundle zip to the Drive folder as well")
+	fromFile := flag.String("from-file", "", "Build the report from a JSON export instead of the Lattice API")
+	diffAgainst := flag.String("diff-against", "", "Add a \"New since last run\" section listing reviews not in this earlier --export-json file")
+	lineEndings := flag.String("line-endings", "lf", "Line endings for the written Markdown file: lf or crlf")
+	bom := flag.Bool("bom", false, "Prefix the written Markdown file with a UTF-8 byte order mark")
+	allowEmpty := flag.Bool("allow-empty", false, "Write (and upload) the report even when the cycle has no reviews")
+	anonymize := flag.Bool("anonymize", false, "Replace peer reviewer names with codes (Reviewer A, B, ...); requires --legend-file")
+	legendFile := flag.String("legend-file", "", "With --anonymize, write the code → reviewer mapping here (mode 0600)")
+	reviewerBadgesFlag := flag.Bool("reviewer-badges", false, "With --upload-format html, show each peer reviewer's avatar (or initials) next to their feedback")
 	censorFlag := flag.Bool("censor", false, "Censor reviewer names, scores, and quotes in the output")
-	templateHubID := flag.String("template-hub-id", "1HU2Jm_JLaLOLPR6V6HjPI4VzwzZRw_OCOvsT3rC_8G0", "Google Doc file ID for the Hub template")
-	templateCoverID := flag.String("template-cover-id", "1vX9gElaEXkQYReZTEb1151x1JnYDSw64eObiWjS7Sp4", "Google Doc file ID for the Cover template")
-	templateReviewID := flag.String("template-review-id", "1OLd7jgwsoKSFiTsiWtOjw9k_c9BfNhx0XRFdMYDaLP0", "Google Doc file ID for the Review template")
+	groupBy := flag.String("group-by", "question", "Group report sections by: question, category (competency), or relationship (peer feedback by reviewer relationship)")
+	sortBy := flag.String("sort-by", "name", "Order peer feedback within a question by: name (reviewer name, then ID) or arrival (API order)")
+	managerNotes := flag.String("manager-notes", "", "Insert this Markdown file as a \"Manager Summary\" section after the title")
+	managerNotesStdin := flag.Bool("manager-notes-stdin", false, "Read the Manager Summary Markdown from stdin")
+	compact := flag.Bool("compact", false, "Tighter Markdown: reviewer name on the quote's first line, no blank lines inside quotes")
+	maxQuoteLength := flag.Int("max-quote-length", 0, "Truncate quotes longer than N characters on a word boundary (0 = unlimited)")
+	keepDuplicates := flag.Bool("keep-duplicates", false, "Keep every review when a reviewer answered the same question more than once (default: keep the latest)")
+	ratingStyle := flag.String("rating-style", "number", "Render numeric ratings as: number, stars (★★★★☆), or bar (████████░░), using the question's scale")
+	stdoutFlag := flag.Bool("stdout", false, "Also print the Markdown report to stdout, moving status lines and the TUI to stderr so the output can be piped")
+	selfOnly := flag.Bool("self-only", false, "Only include the Self Review section (same as --no-peer)")
+	peerOnly := flag.Bool("peer-only", false, "Only include the Peer Feedback section (same as --no-self)")
+	noSelf := flag.Bool("no-self", false, "Leave out the Self Review section")
+	noPeer := flag.Bool("no-peer", false, "Leave out the Peer Feedback section")
+	summary := flag.Bool("summary", false, "Add a Score Summary table with the average peer rating per question")
+	highlightBelow := flag.Float64("highlight-below", 0, "With --summary, bold questions whose average rating is below N and list them under \"Focus areas\"")
+	scoresOnly := flag.Bool("scores-only", false, "Write only a reviewers × questions table of numeric peer ratings with averages, for calibration grids (no prose)")
+	normalizeScores := flag.Bool("normalize-scores", false, "With --summary, also show averages normalized to 0–100 using each question's scale")
+	batch := flag.Bool("batch", false, "Write a report for every direct report in --cycle without prompting")
+	batchCycle := flag.String("cycle", "", "Review cycle name for --batch (case-insensitive)")
+	userID := flag.String("user-id", "", "Lattice user ID of the reviewee; skips the user list")
+	cycleID := flag.String("cycle-id", "", "Review cycle ID; skips the cycle list (and wins over --cycle in --batch)")
+	concurrency := flag.Int("concurrency", defaultBatchConcurrency, "With --batch, how many reports to fetch, convert, and upload at once")
+	combined := flag.Bool("combined", false, "With --batch, write one document with a section per person instead of a file each")
+	toc := flag.Bool("toc", false, "With --combined, add a table of contents linking to each person's section")
+	commentHTML := flag.String("comment-html", "strip", "HTML in review comments: strip (remove tags), unescape (decode entities, keep tags), or markdown (convert bold, links, lists, ... to Markdown)")
+	commentMarkdown := flag.String("comment-markdown", "interpret", "Markdown typed in review comments: interpret (render **bold**, lists, ...) or escape (show it literally)")
+	showCounts := flag.Bool("show-counts", false, "Append the number of responses shown to each peer question heading, e.g. \"(3 responses)\"")
+	frontMatterFlag := flag.Bool("front-matter", false, "Prepend a YAML front matter block with report metadata to the Markdown file")
+	frontMatterKeysFlag := flag.String("front-matter-keys", strings.Join(frontMatterKeys, ","), "Comma-separated front matter keys: "+strings.Join(frontMatterKeys, ", "))
+	hideEmptySelf := flag.Bool("hide-empty-self", false, "Leave out self-review questions the reviewee didn't answer (default: show them as \"(no comment)\")")
+	selfLabel := flag.String("self-label", "none", "Label self-review quotes: none, self (\"Self:\"), or name (the reviewee's name)")
+	questionTypes := flag.Bool("question-types", false, "Annotate question headings with the question type (text, rating, ...)")
+	templatesFlag := flag.String("templates", "", "Override several template IDs at once, e.g. \"hub=ID,cover=ID,review=ID\"; keys left out keep their configured IDs")
+	flag.String("template-hub-id", api.DefaultTemplateHubID, "Google Doc file ID for the Hub template")
+	flag.String("template-cover-id", api.DefaultTemplateCoverID, "Google Doc file ID for the Cover template")
+	flag.String("template-review-id", api.DefaultTemplateReviewID, "Google Doc file ID for the Review template")
 
 	// Subcommand dispatch (before parsing flags)
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "setup":
-			if err := api.RunSetup(context.Background()); err != nil {
+			fs := flag.NewFlagSet("setup", flag.ExitOnError)
+			var opts api.SetupOptions
+			fs.BoolVar(&opts.NonInteractive, "non-interactive", false, "Write config from flags without prompting")
+			fs.StringVar(&opts.APIKey, "api-key", "", "Lattice API key (required with --non-interactive unless already configured)")
+			fs.StringVar(&opts.RcloneRemote, "rclone-remote", "", "rclone remote name (default: drive)")
+			fs.StringVar(&opts.FolderID, "folder-id", "", "Default Google Drive folder ID (rclone_folder_id)")
+			fs.StringVar(&opts.ConfigPath, "config", "", "Path to config TOML to write (default: ~/.tess/config.toml)")
+			setupASCII := fs.Bool("ascii", false, "Use plain ASCII status markers")
+			fs.Parse(os.Args[2:])
+			api.UseASCII(*setupASCII || api.ASCIITerminal())
+			if err := api.RunSetup(context.Background(), opts); err != nil {
 				fmt.Fprintf(os.Stderr, "setup error: %v\n", err)
 				os.Exit(1)
 			}
 			return
 		case "doctor":
-			code := api.RunDoctor(context.Background())
+			fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+			var opts api.DoctorOptions
+			fs.BoolVar(&opts.FailOnWarning, "fail-on-warning", false, "Exit non-zero if any check warns or fails (for CI)")
+			fs.BoolVar(&opts.JSON, "json", false, "Print the results as JSON")
+			fs.StringVar(&opts.ConfigPath, "config", "", "Path to config TOML (default: ~/.tess/config.toml)")
+			doctorASCII := fs.Bool("ascii", false, "Use plain ASCII status markers ([OK]/[WARN]/[FAIL])")
+			fs.Parse(os.Args[2:])
+			api.UseASCII(*doctorASCII || api.ASCIITerminal())
+			code := api.RunDoctor(context.Background(), opts)
 			if code != 0 {
 				os.Exit(code)
 			}
 			return
+		case "capabilities":
+			fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+			asJSON := fs.Bool("json", false, "Print the capabilities as JSON")
+			capsASCII := fs.Bool("ascii", false, "Use plain ASCII status markers")
+			fs.Parse(os.Args[2:])
+			api.UseASCII(*capsASCII || api.ASCIITerminal())
+			if err := api.WriteCapabilities(os.Stdout, api.DetectCapabilities(context.Background()), *asJSON); err != nil {
+				fmt.Fprintf(os.Stderr, "capabilities error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "config":
+			if err := runConfigCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "preset":
+			if err := runPresetCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "preset error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "prewarm":
+			os.Exit(runPrewarm(os.Args[2:]))
+		case "questions":
+			os.Exit(runQuestions(os.Args[2:]))
+		case "demo":
+			if err := runDemo(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "demo error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "version":
 			fmt.Println(api.Version)
+			if len(os.Args) > 2 && strings.TrimLeft(os.Args[2], "-") == "check-updates" {
+				startUpdateCheck(true)()
+			}
 			return
 		case "help":
 			flag.Usage()
@@ -142,437 +220,1201 @@ func main() {
 		}
 	}
 	flag.Parse()
+	api.UseASCII(*ascii || api.ASCIITerminal())
+	if *stdoutFlag {
+		statusOut = os.Stderr
+	}
+	updateNotice := startUpdateCheck(*checkUpdates)
 	var cfgPath string
 	if *cfgFlag != "" {
 		cfgPath = *cfgFlag
 	} else {
 		var err error
-		cfgPath, err = defaultConfigPath()
+		cfgPath, err = api.DefaultConfigPath()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error determining default config path: %v\n", err)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	cfg, err := loadConfigFromTOML(cfgPath)
+	cwd, err := os.Getwd()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		fmt.Fprintf(os.Stderr, "error determining working directory: %v\n", err)
 		os.Exit(1)
 	}
-	apiKey := cfg.APIKey
-
-	client, err := api.NewClient(apiKey)
+	// Resolve every setting: flag > env > project .tess.toml > home config > default.
+	setFlags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = f.Value.String() })
+	// --drive-api is shorthand for --uploader drive-api.
+	if *driveAPIFlag {
+		if v, ok := setFlags["uploader"]; ok && v != "drive-api" {
+			fmt.Fprintf(os.Stderr, "--drive-api conflicts with --uploader %s\n", v)
+			os.Exit(1)
+		}
+		setFlags["uploader"] = "drive-api"
+	}
+	// --templates is shorthand for the individual --template-*-id flags.
+	templateIDs, err := parseTemplatesFlag(*templatesFlag)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to init api client: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
-
-	ctx := context.Background()
-	meAny, err := runWithSpinner(ctx, "Loading current user...", func(c context.Context) (any, error) { return client.GetMe(c) })
+	for name, id := range templateIDs {
+		if _, ok := setFlags[name]; ok {
+			fmt.Fprintf(os.Stderr, "--templates and --%s both set that template; use one\n", name)
+			os.Exit(1)
+		}
+		setFlags[name] = id
+	}
+	cfg, err := api.LoadEffectiveConfig(cfgPath, cwd, setFlags)
 	if err != nil {
-		log.Fatalf("failed to fetch current user: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
-	me := meAny.(*api.User)
-
-	reportsAny, err := runWithSpinner(ctx, "Loading direct reports...", func(c context.Context) (any, error) { return client.ListUsersByURL(c, me.DirectReports.URL) })
+	printConfigWarning(cfg)
+	if *rcloneConcurrency < 1 {
+		fmt.Fprintf(os.Stderr, "invalid --rclone-concurrency %d (want at least 1)\n", *rcloneConcurrency)
+		os.Exit(1)
+	}
+	rcloneOpts, err := api.RcloneOptionsFromConfig(cfg)
 	if err != nil {
-		log.Fatalf("failed to fetch direct reports: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
-	reports := reportsAny.([]api.User)
-
-	sort.Slice(reports, func(i, j int) bool { return strings.ToLower(reports[i].Name) < strings.ToLower(reports[j].Name) })
-	names := make([]string, 0, len(reports))
-	for _, u := range reports {
-		names = append(names, u.Name)
+	if *printCommands {
+		api.PrintCommands(os.Stderr)
 	}
-	m := newListModel("Select a user", names)
-	if _, err := tea.NewProgram(m).Run(); err != nil {
-		log.Fatalf("tui error: %v", err)
+	if name := strings.TrimSpace(*rcloneConfigPassEnv); name != "" {
+		if err := api.UseRcloneConfigPassFrom(name); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
-	if m.choice == "" || len(reports) == 0 {
-		return
+	rcloneOpts.Timeout = *rcloneTimeout
+	rcloneOpts.Concurrency = *rcloneConcurrency
+	rcloneOpts.VerifyUploads = *verifyUpload
+	api.ConfigureRclone(rcloneOpts)
+	if err := api.ValidateMarkdownFlavor(cfg.MarkdownFlavor); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
-	selIdx := m.cursor
-	if selIdx < 0 || selIdx >= len(reports) {
-		return
+	for _, v := range pandocVars {
+		if err := api.ValidatePandocVar(v); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
-	selectedUserID := reports[selIdx].ID
-
-	fmt.Fprintln(os.Stderr)
-	cyclesAny, err := runWithSpinner(ctx, "Loading review cycles...", func(c context.Context) (any, error) { return client.ListReviewCycles(c) })
-	if err != nil {
-		log.Fatalf("failed to fetch review cycles: %v", err)
+	for _, f := range luaFilters {
+		if err := api.ValidateLuaFilter(f); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
-	cycles := cyclesAny.([]api.ReviewCycle)
-
-	type cycleEntry struct {
-		Name, ReviewsURL string
-		Cycle            api.ReviewCycle
+	if dir := strings.TrimSpace(cfg.TmpDir); dir != "" {
+		if err := api.ValidateTempDir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		api.SetTempDir(dir)
 	}
-	// Show a spinner while filtering cycles down to those that include the selected user
-	filteredAny, err := runWithSpinner(ctx, fmt.Sprintf("Filtering cycles for %s...", reports[selIdx].Name), func(c context.Context) (any, error) {
-		out := make([]cycleEntry, 0)
-		for _, cy := range cycles {
-			reviewees, err := client.ListRevieweesByURL(c, cy.Reviewees.URL)
-			if err != nil {
+	pandocOpts := api.PandocOptions{Flavor: cfg.MarkdownFlavor, Timeout: *pandocTimeout, Vars: pandocVars, LuaFilters: luaFilters}
+	if !slices.Contains(api.UploaderNames, strings.ToLower(strings.TrimSpace(cfg.Uploader))) {
+		fmt.Fprintf(os.Stderr, "invalid uploader %q (want one of: %s)\n", cfg.Uploader, strings.Join(api.UploaderNames, ", "))
+		os.Exit(1)
+	}
+	if err := checkUploadTools(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	var uploader api.Uploader
+	if strings.TrimSpace(cfg.RcloneFolderID) != "" {
+		if uploader, err = api.NewUploader(context.Background(), cfg.Uploader, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	mdOpts := markdownOptions{Censor: *censorFlag, GroupBy: strings.ToLower(strings.TrimSpace(*groupBy)), ShowQuestionType: *questionTypes, SortBy: strings.ToLower(strings.TrimSpace(*sortBy)), Compact: *compact, MaxQuoteLength: *maxQuoteLength, KeepDuplicates: *keepDuplicates, RatingStyle: strings.ToLower(strings.TrimSpace(*ratingStyle)), Summary: *summary, NormalizeScores: *normalizeScores, CommentMarkdown: strings.ToLower(strings.TrimSpace(*commentMarkdown)), CommentHTML: strings.ToLower(strings.TrimSpace(*commentHTML)), ShowCounts: *showCounts, SelfLabel: strings.ToLower(strings.TrimSpace(*selfLabel)), HideEmptySelf: *hideEmptySelf, ScoresOnly: *scoresOnly, HighlightBelow: *highlightBelow}
+	var fmKeys []string
+	if *frontMatterFlag {
+		for _, k := range strings.Split(*frontMatterKeysFlag, ",") {
+			k = strings.ToLower(strings.TrimSpace(k))
+			if k == "" {
 				continue
 			}
-			for _, rv := range reviewees {
-				if rv.User.ID == selectedUserID {
-					out = append(out, cycleEntry{Name: cy.Name, ReviewsURL: rv.Reviews.URL, Cycle: cy})
-					break
-				}
+			if !slices.Contains(frontMatterKeys, k) {
+				fmt.Fprintf(os.Stderr, "invalid --front-matter-keys entry %q (want any of: %s)\n", k, strings.Join(frontMatterKeys, ", "))
+				os.Exit(1)
 			}
+			fmKeys = append(fmKeys, k)
+		}
+		if len(fmKeys) == 0 {
+			fmt.Fprintln(os.Stderr, "--front-matter-keys is empty")
+			os.Exit(1)
 		}
-		return out, nil
-	})
-	if err != nil {
-		log.Fatalf("failed to filter review cycles: %v", err)
 	}
-	filtered := filteredAny.([]cycleEntry)
-	if len(filtered) == 0 {
-		fmt.Fprintln(os.Stderr, "no cycles found for selected user")
-		return
+	if !slices.Contains(selfLabelModes, mdOpts.SelfLabel) {
+		fmt.Fprintf(os.Stderr, "invalid --self-label %q (want one of: %s)\n", *selfLabel, strings.Join(selfLabelModes, ", "))
+		os.Exit(1)
 	}
-	sort.Slice(filtered, func(i, j int) bool { return strings.ToLower(filtered[i].Name) < strings.ToLower(filtered[j].Name) })
-
-	cycleNames := make([]string, len(filtered))
-	for i, ce := range filtered {
-		cycleNames[i] = ce.Name
+	if !slices.Contains(groupByModes, mdOpts.GroupBy) {
+		fmt.Fprintf(os.Stderr, "invalid --group-by %q (want one of: %s)\n", *groupBy, strings.Join(groupByModes, ", "))
+		os.Exit(1)
 	}
-	m2 := newListModel("Select a cycle", cycleNames)
-	if _, err := tea.NewProgram(m2).Run(); err != nil {
-		log.Fatalf("tui error: %v", err)
+	if !slices.Contains(sortByModes, mdOpts.SortBy) {
+		fmt.Fprintf(os.Stderr, "invalid --sort-by %q (want one of: %s)\n", *sortBy, strings.Join(sortByModes, ", "))
+		os.Exit(1)
 	}
-	if m2.choice == "" {
-		return
+	if !slices.Contains(commentMarkdownModes, mdOpts.CommentMarkdown) {
+		fmt.Fprintf(os.Stderr, "invalid --comment-markdown %q (want one of: %s)\n", *commentMarkdown, strings.Join(commentMarkdownModes, ", "))
+		os.Exit(1)
+	}
+	if !slices.Contains(commentHTMLModes, mdOpts.CommentHTML) {
+		fmt.Fprintf(os.Stderr, "invalid --comment-html %q (want one of: %s)\n", *commentHTML, strings.Join(commentHTMLModes, ", "))
+		os.Exit(1)
+	}
+	if mdOpts.CommentHTML == "markdown" && mdOpts.CommentMarkdown == "escape" {
+		fmt.Fprintln(os.Stderr, "--comment-html markdown can't be combined with --comment-markdown escape (the converted Markdown would be shown literally)")
+		os.Exit(1)
+	}
+	if mdOpts.NormalizeScores && !mdOpts.Summary {
+		fmt.Fprintln(os.Stderr, "--normalize-scores requires --summary")
+		os.Exit(1)
+	}
+	if mdOpts.HighlightBelow < 0 || math.IsNaN(mdOpts.HighlightBelow) || math.IsInf(mdOpts.HighlightBelow, 0) {
+		fmt.Fprintf(os.Stderr, "invalid --highlight-below %v (want a non-negative number; 0 disables)\n", *highlightBelow)
+		os.Exit(1)
+	}
+	if mdOpts.HighlightBelow > 0 && !mdOpts.Summary {
+		fmt.Fprintln(os.Stderr, "--highlight-below requires --summary")
+		os.Exit(1)
+	}
+	if mdOpts.ReviewWeights, err = parseReviewWeights(cfg.ReviewWeights); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if mdOpts.OmitPeer, mdOpts.OmitSelf, err = resolveSections(*selfOnly, *peerOnly, *noSelf, *noPeer); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if mdOpts.ScoresOnly && mdOpts.OmitPeer {
+		fmt.Fprintln(os.Stderr, "--scores-only shows peer ratings and can't be combined with --self-only or --no-peer")
+		os.Exit(1)
 	}
-	idx := m2.cursor
-	if idx < 0 || idx >= len(filtered) {
+	if !slices.Contains(ratingStyles, mdOpts.RatingStyle) {
+		fmt.Fprintf(os.Stderr, "invalid --rating-style %q (want one of: %s)\n", *ratingStyle, strings.Join(ratingStyles, ", "))
+		os.Exit(1)
+	}
+	*lineEndings = strings.ToLower(strings.TrimSpace(*lineEndings))
+	if *lineEndings != "lf" && *lineEndings != "crlf" {
+		fmt.Fprintf(os.Stderr, "invalid --line-endings %q (want lf or crlf)\n", *lineEndings)
+		os.Exit(1)
+	}
+	*templateConflict = strings.ToLower(strings.TrimSpace(*templateConflict))
+	if *renameExisting {
+		if *templateConflict != "duplicate" && *templateConflict != "rename" {
+			fmt.Fprintf(os.Stderr, "--rename-existing conflicts with --template-conflict %s\n", *templateConflict)
+			os.Exit(1)
+		}
+		*templateConflict = "rename"
+	}
+	*sortCycles = strings.ToLower(strings.TrimSpace(*sortCycles))
+	if !slices.Contains(cycleSortModes, *sortCycles) {
+		fmt.Fprintf(os.Stderr, "invalid --sort-cycles %q (want one of: %s)\n", *sortCycles, strings.Join(cycleSortModes, ", "))
+		os.Exit(1)
+	}
+	if !slices.Contains(templateConflictModes, *templateConflict) {
+		fmt.Fprintf(os.Stderr, "invalid --template-conflict %q (want one of: %s)\n", *templateConflict, strings.Join(templateConflictModes, ", "))
+		os.Exit(1)
+	}
+	if *anonymize != (strings.TrimSpace(*legendFile) != "") {
+		fmt.Fprintln(os.Stderr, "--anonymize and --legend-file must be used together")
+		os.Exit(1)
+	}
+	if *reviewerBadgesFlag && uploadFormat(cfg) != "html" {
+		fmt.Fprintln(os.Stderr, "--reviewer-badges requires --upload-format html")
+		os.Exit(1)
+	}
+	*userID, *cycleID = strings.TrimSpace(*userID), strings.TrimSpace(*cycleID)
+	*reviewsURL = strings.TrimSpace(*reviewsURL)
+	if strings.TrimSpace(*fromFile) == "" && *reviewsURL == "" {
+		// A preset fills in selections the flags leave empty.
+		if *userID == "" && !*batch {
+			*userID = cfg.Preset.UserID
+		}
+		if *cycleID == "" {
+			*cycleID = cfg.Preset.CycleID
+		}
+	}
+	if *reviewsURL != "" && (strings.TrimSpace(*fromFile) != "" || *userID != "" || *cycleID != "" || *batch) {
+		fmt.Fprintln(os.Stderr, "--reviews-url replaces selection and can't be combined with --from-file, --user-id, --cycle-id, or --batch")
+		os.Exit(1)
+	}
+	if strings.TrimSpace(*fromFile) != "" && (*userID != "" || *cycleID != "") {
+		fmt.Fprintln(os.Stderr, "--user-id and --cycle-id can't be combined with --from-file")
+		os.Exit(1)
+	}
+	if *batch {
+		switch {
+		case strings.TrimSpace(*batchCycle) == "" && *cycleID == "":
+			fmt.Fprintln(os.Stderr, "--batch requires --cycle or --cycle-id")
+			os.Exit(1)
+		case *userID != "":
+			fmt.Fprintln(os.Stderr, "--user-id selects one person and can't be combined with --batch")
+			os.Exit(1)
+		case *stdoutFlag:
+			fmt.Fprintln(os.Stderr, "--stdout prints a single report and can't be combined with --batch")
+			os.Exit(1)
+		case *concurrency < 1:
+			fmt.Fprintf(os.Stderr, "invalid --concurrency %d (want at least 1)\n", *concurrency)
+			os.Exit(1)
+		case strings.TrimSpace(*fromFile) != "", strings.TrimSpace(*exportJSON) != "", strings.TrimSpace(*bundle) != "", strings.TrimSpace(*managerNotes) != "", *managerNotesStdin, *copyTemplates, *anonymize, strings.TrimSpace(*diffAgainst) != "":
+			fmt.Fprintln(os.Stderr, "--batch can't be combined with --from-file, --export-json, --bundle, --manager-notes, --copy-templates, --anonymize, or --diff-against")
+			os.Exit(1)
+		}
+	} else if strings.TrimSpace(*batchCycle) != "" || *combined {
+		fmt.Fprintln(os.Stderr, "--cycle and --combined require --batch")
+		os.Exit(1)
+	}
+	// The earlier export is read now, so --diff-against and --export-json
+	// can name the same file and each run compares with the one before.
+	var prior *api.ReportExport
+	if path := strings.TrimSpace(*diffAgainst); path != "" {
+		if *scoresOnly {
+			fmt.Fprintln(os.Stderr, "--diff-against can't be combined with --scores-only")
+			os.Exit(1)
+		}
+		exp, err := api.ReadExport(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read --diff-against export: %v\n", err)
+			os.Exit(1)
+		}
+		prior = &exp
+	}
+	if *toc && !*combined {
+		fmt.Fprintln(os.Stderr, "--toc requires --combined")
+		os.Exit(1)
+	}
+	if *managerNotesStdin && strings.TrimSpace(*managerNotes) != "" {
+		fmt.Fprintln(os.Stderr, "use either --manager-notes or --manager-notes-stdin, not both")
+		os.Exit(1)
+	}
+	if notesPath := strings.TrimSpace(*managerNotes); notesPath != "" || *managerNotesStdin {
+		if *managerNotesStdin {
+			notesPath = "-"
+		}
+		notes, err := readManagerNotes(notesPath, os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		mdOpts.ManagerNotes = notes
+	}
+
+	ctx := context.Background()
+	plan := outputPlan{Config: cfg, Markdown: mdOpts, Pandoc: pandocOpts, CRLF: *lineEndings == "crlf", BOM: *bom, DocTitle: defaultDocTitle, Anonymize: *anonymize, FrontMatter: fmKeys, ReviewerBadges: *reviewerBadgesFlag, Uploader: uploader}
+	if *batch {
+		if err := cfg.RequireAPIKey(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		client, err := api.NewClientFromConfig(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to init api client: %v\n", err)
+			os.Exit(1)
+		}
+		code := runBatch(ctx, client, plan, batchOptions{Cycle: *batchCycle, CycleID: *cycleID, Concurrency: *concurrency, MaxReviews: *maxReviews, Refresh: *refresh, CacheTTL: *cacheTTL, AllowEmpty: *allowEmpty, Strict: *strict, Combined: *combined, TOC: *toc})
+		updateNotice()
+		os.Exit(code)
+	}
+	var subj reportSubject
+	var client *api.Client
+	if strings.TrimSpace(*fromFile) != "" {
+		exp, err := api.ReadExport(*fromFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read export: %v\n", err)
+			os.Exit(1)
+		}
+		subj = reportSubject{
+			User:     exp.User,
+			Cycle:    exp.Cycle,
+			Reviews:  exp.Reviews,
+			Resolver: api.StaticResolver{Users: exp.Users, Questions: exp.Questions},
+		}
+	} else {
+		if err := cfg.RequireAPIKey(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		client, err = api.NewClientFromConfig(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to init api client: %v\n", err)
+			os.Exit(1)
+		}
+		ok := true
+		if *reviewsURL != "" {
+			subj, err = subjectFromReviewsURL(ctx, client, *reviewsURL, *maxReviews)
+		} else {
+			subj, ok, err = selectReport(ctx, client, selectOptions{MaxReviews: *maxReviews, LimitCycles: *limitCycles, SortCycles: *sortCycles, Refresh: *refresh, CacheTTL: *cacheTTL, UserID: *userID, CycleID: *cycleID, Quiet: *quiet, Strict: *strict})
+		}
+		if err != nil {
+			os.Exit(errorExitCode(err))
+		}
+		if !ok {
+			return
+		}
+	}
+
+	if len(subj.Reviews) == 0 && !*allowEmpty {
+		fmt.Fprintf(os.Stderr, "No reviews found for %s in %q; nothing written or uploaded. Pass --allow-empty to generate the report anyway.\n", subj.User.Name, subj.Cycle.Name)
 		return
 	}
 
-	fmt.Fprintln(os.Stderr)
-	reviewsAny, err := runWithSpinner(ctx, "Fetching reviews for cycle: "+filtered[idx].Name+"...", func(c context.Context) (any, error) { return client.ListReviewsByURL(c, filtered[idx].ReviewsURL, 100) })
-	if err != nil {
-		log.Fatalf("failed to fetch reviews: %v", err)
+	if prior != nil {
+		if prior.User.ID != "" && subj.User.ID != "" && prior.User.ID != subj.User.ID {
+			fmt.Fprintf(os.Stderr, "--diff-against %s is a report for %s, not %s\n", *diffAgainst, prior.User.Name, subj.User.Name)
+			os.Exit(1)
+		}
+		plan.Markdown.NewReviews = newReviewIDs(prior.Reviews, subj.Reviews)
+		plan.Markdown.DiffBase = "the last run"
+		if t, err := time.Parse(time.RFC3339, prior.GeneratedAt); err == nil {
+			plan.Markdown.DiffBase = "the run of " + t.Local().Format("2006-01-02 15:04")
+		}
 	}
-	reviews := reviewsAny.([]api.Review)
 
-	selectedUserName := reports[selIdx].Name
-	mdAny, err := runWithSpinner(ctx, "Generating markdown...", func(c context.Context) (any, error) {
-		return buildMarkdown(c, client, selectedUserName, filtered[idx].Name, reviews, *censorFlag)
-	})
+	spin := func(title string, fn func(context.Context) (any, error)) (any, error) {
+		return runWithSpinner(ctx, title, fn)
+	}
+	outcome, err := produceReport(ctx, subj, plan, spin, func(msg string) { fmt.Fprintln(os.Stderr, msg) })
 	if err != nil {
-		log.Fatalf("build markdown failed: %v", err)
+		log.Fatal(err)
 	}
-	md := mdAny.(string)
-	fname := outputFileName(selectedUserName, filtered[idx].Name)
-	if err := os.WriteFile(fname, []byte(md), 0644); err != nil {
-		log.Fatalf("failed to write file: %v", err)
+	fname, convertedPath := outcome.File, outcome.ConvertedPath
+	if *anonymize {
+		if err := writeLegend(*legendFile, subj.User.Name, subj.Cycle.Name, outcome.Legend); err != nil {
+			log.Fatal(err)
+		}
 	}
-	uploadedURL := ""
-	if strings.TrimSpace(*rcloneFolderID) != "" {
-		if err := api.RcloneAvailable(); err != nil {
-			log.Fatalf("%v; install from https://rclone.org", err)
+	if strings.TrimSpace(*exportJSON) != "" {
+		exp := api.ReportExport{User: subj.User, Cycle: subj.Cycle, Reviews: subj.Reviews}
+		if client != nil {
+			exp.Users, exp.Questions = client.CachedLookups()
+		} else if sr, ok := subj.Resolver.(api.StaticResolver); ok {
+			exp.Users, exp.Questions = sr.Users, sr.Questions
 		}
-		// Normalize format
-		fmtStr := strings.ToLower(strings.TrimSpace(*uploadFormat))
-		if fmtStr != "pdf" && fmtStr != "docx" {
-			fmtStr = "docx"
+		if err := api.WriteExport(*exportJSON, exp); err != nil {
+			log.Fatalf("failed to write export: %v", err)
 		}
-		if err := api.HasPandoc(); err != nil {
-			fmt.Fprintln(os.Stderr, "pandoc not found; skipping Drive upload via rclone. Install pandoc to enable document export.")
-		} else {
-			// Uploaded Drive document title: fixed for clarity across cycles
-			docTitle := "Peer & Self Reviews"
-			// Determine remote: CLI flag overrides config when explicitly provided
-			remoteName := *rcloneRemote
-			explicitRemoteFlag := false
-			flag.Visit(func(f *flag.Flag) {
-				if f.Name == "rclone-remote" {
-					explicitRemoteFlag = true
-				}
-			})
-			if !explicitRemoteFlag && strings.TrimSpace(cfg.RcloneRemote) != "" {
-				remoteName = cfg.RcloneRemote
+	}
+
+	bundleURL, bundleUploaded := "", false
+	if bundlePath := strings.TrimSpace(*bundle); bundlePath != "" {
+		files := []api.BundleFile{{Name: filepath.Base(fname), Path: fname}}
+		if convertedPath != "" {
+			files = append(files, api.BundleFile{Name: filepath.Base(convertedPath), Path: convertedPath})
+		}
+		if strings.TrimSpace(*exportJSON) != "" {
+			files = append(files, api.BundleFile{Name: filepath.Base(*exportJSON), Path: *exportJSON})
+		}
+		manifest := api.BundleManifest{User: subj.User.Name, Cycle: subj.Cycle.Name, Sections: sectionNames(mdOpts)}
+		if err := api.WriteBundle(bundlePath, manifest, files); err != nil {
+			log.Fatalf("failed to write bundle: %v", err)
+		}
+		if *uploadBundle {
+			if strings.TrimSpace(cfg.RcloneFolderID) == "" {
+				log.Fatalf("--upload-bundle requires --rclone-folder-id to be set")
 			}
-			if fmtStr == "pdf" {
-				pdfPath := filepath.Join(os.TempDir(), docTitle+".pdf")
-				// Force a specific engine if provided; tectonic is preferred for LaTeX flow and sans font support.
-				engine := strings.TrimSpace(*pdfEngine)
-				_, err := runWithSpinner(ctx, "Converting to PDF...", func(c context.Context) (any, error) {
-					return nil, api.ConvertMarkdownToPDFWithEngine(c, fname, pdfPath, engine)
-				})
-				if err != nil {
-					log.Fatalf("pandoc conversion failed: %v", err)
-				}
-				// Upload as a regular PDF file (no import)
-				uploadAny, err := runWithSpinner(ctx, "Uploading PDF via rclone...", func(c context.Context) (any, error) {
-					return api.CopyToAndLink(c, remoteName, *rcloneFolderID, pdfPath, docTitle+".pdf", "")
-				})
-				if err != nil {
-					log.Fatalf("rclone upload failed: %v", err)
-				}
-				if ln, ok := uploadAny.(string); ok && strings.TrimSpace(ln) != "" {
-					uploadedURL = ln
-				}
-			} else {
-				docxPath := filepath.Join(os.TempDir(), docTitle+".docx")
-				_, err := runWithSpinner(ctx, "Converting to DOCX...", func(c context.Context) (any, error) { return nil, api.ConvertMarkdownToDOCX(c, fname, docxPath) })
-				if err != nil {
-					log.Fatalf("pandoc conversion failed: %v", err)
-				}
-				uploadAny, err := runWithSpinner(ctx, "Uploading via rclone...", func(c context.Context) (any, error) {
-					return api.CopyToAndLink(c, remoteName, *rcloneFolderID, docxPath, docTitle, "docx")
-				})
-				if err != nil {
-					log.Fatalf("rclone upload failed: %v", err)
-				}
-				if ln, ok := uploadAny.(string); ok && strings.TrimSpace(ln) != "" {
-					uploadedURL = ln
-				}
+			linkAny, err := runWithSpinner(ctx, "Uploading bundle via "+plan.Uploader.Name()+"...", func(c context.Context) (any, error) {
+				return plan.uploadFile(c, bundlePath, filepath.Base(bundlePath), "")
+			})
+			if bundleURL, bundleUploaded, err = uploadedLink(linkAny, err); err != nil {
+				log.Fatalf("%s bundle upload failed: %v", plan.Uploader.Name(), err)
 			}
 		}
 	}
 
-	fmt.Println()
-	fmt.Printf("Wrote %s\n", fname)
-	if strings.TrimSpace(uploadedURL) != "" {
-		fmt.Printf("Uploaded %s\n", uploadedURL)
+	if *stdoutFlag {
+		content, err := os.ReadFile(fname)
+		if err != nil {
+			log.Fatalf("failed to read report for --stdout: %v", err)
+		}
+		os.Stdout.Write(content)
+	}
+	fmt.Fprintln(statusOut)
+	fmt.Fprintf(statusOut, "Wrote %s\n", fname)
+	if strings.TrimSpace(*exportJSON) != "" {
+		fmt.Fprintf(statusOut, "Wrote %s\n", *exportJSON)
+	}
+	if strings.TrimSpace(*bundle) != "" {
+		fmt.Fprintf(statusOut, "Wrote %s\n", *bundle)
+	}
+	if *anonymize {
+		fmt.Fprintf(statusOut, "Wrote %s (reviewer legend; keep it private)\n", *legendFile)
+	}
+	printUploaded(outcome.Uploaded, outcome.URL)
+	printUploaded(bundleUploaded, bundleURL)
+	tools := outcome.Tools
+	if bundleUploaded {
+		tools = append(tools, uploadTool(plan.Uploader, "bundle", bundleURL))
 	}
 
 	// Optionally copy templates into the Drive folder
 	if *copyTemplates {
 		// Visual separation from upload summary
-		fmt.Println()
-		if strings.TrimSpace(*rcloneFolderID) == "" {
+		fmt.Fprintln(statusOut)
+		if strings.TrimSpace(cfg.RcloneFolderID) == "" {
 			fmt.Fprintln(os.Stderr, "--copy-templates requires --rclone-folder-id to be set")
 		} else if err := api.RcloneAvailable(); err != nil {
 			fmt.Fprintln(os.Stderr, "rclone not found; cannot copy templates")
+		} else if ru, ok := plan.Uploader.(api.RcloneUploader); ok && !ru.IsDrive() {
+			fmt.Fprintf(os.Stderr, "--copy-templates needs a Google Drive remote; %s is %s\n", ru.Remote, ru.Backend)
 		} else {
-			remoteName := *rcloneRemote
-			explicitRemoteFlag := false
-			flag.Visit(func(f *flag.Flag) {
-				if f.Name == "rclone-remote" {
-					explicitRemoteFlag = true
-				}
-			})
-			if !explicitRemoteFlag && strings.TrimSpace(cfg.RcloneRemote) != "" {
-				remoteName = cfg.RcloneRemote
-			}
-
-			// Resolve template IDs: CLI overrides config if provided
-			th := strings.TrimSpace(*templateHubID)
-			tc := strings.TrimSpace(*templateCoverID)
-			tr := strings.TrimSpace(*templateReviewID)
-			if !flagIsSet("template-hub-id") && strings.TrimSpace(cfg.TemplateHubID) != "" {
-				th = cfg.TemplateHubID
+			remoteName := cfg.RcloneRemote
+			// Per-reviewee overrides from config fall back to the global template IDs.
+			ts := cfg.TemplatesFor(subj.User.ID, subj.User.Email)
+			copies := []struct{ id, name string }{
+				{ts.HubID, "Hub"}, {ts.CoverID, "Cover"}, {ts.ReviewID, "Review"},
 			}
-			if !flagIsSet("template-cover-id") && strings.TrimSpace(cfg.TemplateCoverID) != "" {
-				tc = cfg.TemplateCoverID
+			// Pre-flight: confirm each template is reachable before copying anything.
+			type check struct {
+				name string
+				info api.DriveFileInfo
+				err  error
 			}
-			if !flagIsSet("template-review-id") && strings.TrimSpace(cfg.TemplateReviewID) != "" {
-				tr = cfg.TemplateReviewID
+			checksAny, _ := runWithSpinner(ctx, "Validating templates...", func(c context.Context) (any, error) {
+				out := make(map[string]check)
+				for _, cp := range copies {
+					if cp.id == "" {
+						continue
+					}
+					info, err := api.StatFileByID(c, remoteName, cp.id)
+					out[cp.id] = check{name: cp.name, info: info, err: err}
+				}
+				return out, nil
+			})
+			checks, _ := checksAny.(map[string]check)
+			invalid := make(map[string]bool)
+			for _, cp := range copies {
+				ck, ok := checks[cp.id]
+				if !ok {
+					continue
+				}
+				if ck.err != nil {
+					fmt.Fprintf(os.Stderr, "template %s (%s) not accessible; skipping: %v\n", cp.name, cp.id, ck.err)
+					invalid[cp.id] = true
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "template %s: %s\n", cp.name, ck.info.Name)
 			}
-
-			copies := []struct{ id, name string }{
-				{th, "Hub"}, {tc, "Cover"}, {tr, "Review"},
+			// Names already in the folder, for --template-conflict skip/rename.
+			existing := make(map[string]bool)
+			if *templateConflict != "duplicate" {
+				namesAny, err := runWithSpinner(ctx, "Checking folder for existing copies...", func(c context.Context) (any, error) {
+					return api.ListFolderFiles(c, remoteName, cfg.RcloneFolderID)
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "could not list the Drive folder; copying templates without checking for existing copies: %v\n", err)
+				} else {
+					for _, n := range namesAny.([]string) {
+						existing[n] = true
+					}
+				}
 			}
+			copied := 0
 			for _, cp := range copies {
-				if cp.id == "" {
+				if cp.id == "" || invalid[cp.id] {
 					continue
 				}
+				if name := checks[cp.id].info.Name; name != "" && existing[name] {
+					if *templateConflict == "skip" {
+						fmt.Fprintf(os.Stderr, "template %s: %s already exists; skipping\n", cp.name, name)
+						continue
+					}
+					aside := timestampedName(name, time.Now())
+					_, err := runWithSpinner(ctx, fmt.Sprintf("Renaming existing %s...", name), func(c context.Context) (any, error) {
+						return nil, api.RenameInFolder(c, remoteName, cfg.RcloneFolderID, name, aside)
+					})
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "could not rename existing %s; skipping template %s: %v\n", name, cp.name, err)
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "template %s: renamed existing copy to %s\n", cp.name, aside)
+				}
 				title := fmt.Sprintf("Copying template: %s...", cp.name)
 				_, err := runWithSpinner(ctx, title, func(c context.Context) (any, error) {
-					return nil, api.CopyByIDToFolder(c, remoteName, *rcloneFolderID, cp.id)
+					return nil, api.CopyByIDToFolder(c, remoteName, cfg.RcloneFolderID, cp.id)
 				})
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "failed to copy template %s: %v\n", cp.name, err)
 					continue
 				}
 				// We keep the original name; link retrieval is skipped since name is unchanged.
+				copied++
 			}
+			tools = append(tools, fmt.Sprintf("rclone %s Drive (%d templates copied)", api.Glyphs.Arrow, copied))
 		}
 	}
+	if line := toolsLine(tools); line != "" && !*quiet {
+		fmt.Fprintln(statusOut)
+		fmt.Fprintln(statusOut, line)
+	}
+	updateNotice()
 }
 
-// flagIsSet reports whether a flag with the given name was explicitly provided.
-func flagIsSet(name string) bool {
-	set := false
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == name {
-			set = true
+// startUpdateCheck begins an opt-in check for a newer release in the
+// background, so it overlaps the run. The returned func waits for it (the
+// check is time-bounded) and prints a notice to stderr when a newer release
+// exists; offline or failed checks print nothing.
+func startUpdateCheck(enabled bool) func() {
+	if !enabled {
+		return func() {}
+	}
+	done := make(chan *api.Release, 1)
+	go func() {
+		rel, err := api.CheckForUpdate(context.Background())
+		if err != nil {
+			rel = nil
 		}
-	})
-	return set
+		done <- rel
+	}()
+	return func() {
+		if rel := <-done; rel != nil {
+			fmt.Fprintf(os.Stderr, "\n%s A newer Tess is available: %s (you have %s) %s\n", api.Glyphs.Info, rel.Tag, api.Version, rel.URL)
+		}
+	}
 }
 
-type listModel struct {
-	title  string
-	items  []string
-	cursor int
-	choice string
+// chooseReviewee returns the reviews URL to use from user's reviewee records
+// in cycle. With several records it asks the user to pick when interactive;
+// otherwise it takes the most recent, or returns an error when strict. It
+// returns false if the user cancelled.
+func chooseReviewee(user api.User, cycle api.ReviewCycle, records []api.Reviewee, interactive, strict bool) (string, bool, error) {
+	if len(records) == 1 {
+		return records[0].Reviews.URL, true, nil
+	}
+	switch {
+	case strict:
+		return "", false, fmt.Errorf("%s has %d reviewee records in %q; refusing to guess with --strict (IDs: %s)", user.Name, len(records), cycle.Name, revieweeIDs(records))
+	case !interactive:
+		rv := api.MostRecentReviewee(records)
+		fmt.Fprintf(os.Stderr, "warning: %s has %d reviewee records in %q; using the most recent (%s)\n", user.Name, len(records), cycle.Name, rv.ID)
+		return rv.Reviews.URL, true, nil
+	}
+	labels := make([]string, len(records))
+	for i, rv := range records {
+		labels[i] = revieweeLabel(rv)
+	}
+	m := newListModel(fmt.Sprintf("%s is enrolled %d times in %s; select a record", user.Name, len(records), cycle.Name), labels)
+	if _, err := tea.NewProgram(m, tea.WithOutput(statusOut)).Run(); err != nil {
+		log.Fatalf("tui error: %v", err)
+	}
+	if m.quit {
+		fmt.Fprintln(os.Stderr, "Cancelled.")
+		return "", false, nil
+	}
+	if m.choice == "" || m.cursor < 0 || m.cursor >= len(records) {
+		return "", false, nil
+	}
+	return records[m.cursor].Reviews.URL, true, nil
 }
 
-func newListModel(title string, items []string) *listModel {
-	return &listModel{title: title, items: items}
+// revieweeLabel describes a reviewee record for the picker: its ID, status,
+// and dates when the API provides them.
+func revieweeLabel(rv api.Reviewee) string {
+	parts := []string{rv.ID}
+	if rv.Status != "" {
+		parts = append(parts, rv.Status)
+	}
+	if !rv.CreatedAt.IsZero() {
+		parts = append(parts, "created "+rv.CreatedAt.Format("2006-01-02"))
+	}
+	if !rv.UpdatedAt.IsZero() {
+		parts = append(parts, "updated "+rv.UpdatedAt.Format("2006-01-02"))
+	}
+	return strings.Join(parts, " — ")
 }
-func (m *listModel) Init() tea.Cmd { return nil }
-func (m *listModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
-		case "up", "k":
-			if m.cursor > 0 {
-				m.cursor--
-			}
-		case "down", "j":
-			if m.cursor < len(m.items)-1 {
-				m.cursor++
-			}
-		case "enter":
-			if len(m.items) > 0 {
-				m.choice = m.items[m.cursor]
-			}
-			return m, tea.Quit
+
+func revieweeIDs(records []api.Reviewee) string {
+	ids := make([]string, len(records))
+	for i, rv := range records {
+		ids[i] = rv.ID
+	}
+	return strings.Join(ids, ", ")
+}
+
+// templateConflictModes are the accepted --template-conflict values.
+var templateConflictModes = []string{"duplicate", "skip", "rename"}
+
+// templateFlagKeys maps --templates keys to the flags they stand for.
+var templateFlagKeys = map[string]string{"hub": "template-hub-id", "cover": "template-cover-id", "review": "template-review-id"}
+
+// parseTemplatesFlag parses --templates, a comma-separated list of key=ID
+// pairs with keys hub, cover, and review, into template flag names and IDs.
+// Each key may appear once; IDs are Drive file IDs (letters, digits, - and _).
+func parseTemplatesFlag(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, id, _ := strings.Cut(pair, "=")
+		key, id = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(id)
+		name, ok := templateFlagKeys[key]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid --templates key %q (want one of: cover, hub, review)", key)
+		case id == "" || strings.IndexFunc(id, func(r rune) bool { return !(r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) }) >= 0:
+			return nil, fmt.Errorf("invalid --templates %s ID %q (want a Drive file ID, e.g. %s=1AbC...)", key, id, key)
 		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("--templates sets %s more than once", key)
+		}
+		out[name] = id
 	}
-	return m, nil
+	return out, nil
 }
-func (m *listModel) View() string {
-	var b strings.Builder
-	if m.title == "" {
-		m.title = "Select"
+
+// cycleSortModes lists the accepted --sort-cycles values.
+var cycleSortModes = []string{"alpha", "recent"}
+
+// timestampedName inserts t before name's extension, e.g.
+// "Hub.docx" -> "Hub (2026-10-16 150405).docx".
+func timestampedName(name string, t time.Time) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(name, ext), t.Format("2006-01-02 150405"), ext)
+}
+
+// repeatedFlag collects every value of a flag that may be given more than once.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, ", ") }
+
+func (f *repeatedFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// reportSubject is everything needed to render one report.
+type reportSubject struct {
+	User     api.User
+	Cycle    api.ReviewCycle
+	Reviews  []api.Review
+	Resolver api.Resolver
+}
+
+// selectOptions tunes how selectReport scans and fetches data.
+type selectOptions struct {
+	MaxReviews  int           // cap on reviews fetched (0 = all)
+	LimitCycles int           // scan only the N most recent cycles (0 = all)
+	SortCycles  string        // cycle list order: "alpha" or "recent"
+	Refresh     bool          // bypass the membership cache
+	CacheTTL    time.Duration // membership cache lifetime
+	UserID      string        // reviewee to use instead of the user list
+	CycleID     string        // cycle to use instead of the cycle list
+	Quiet       bool          // skip the "Selected: ..." confirmation
+	Strict      bool          // fail instead of guessing among repeat reviewee records
+}
+
+// selectReport walks the user through picking a direct report and cycle, then
+// fetches that cycle's reviews. opts.UserID and opts.CycleID skip the
+// corresponding list. It returns false if nothing was selected, and an error
+// when a fetch fails, the chosen cycle doesn't include the user, or --strict
+// refuses to pick among repeat reviewee records. API errors are wrapped, so
+// errors.Is still finds api.ErrUnauthorized.
+func selectReport(ctx context.Context, client *api.Client, opts selectOptions) (reportSubject, bool, error) {
+	// Lists saved by `tess prewarm` stand in for the reports and cycles
+	// fetches until they expire.
+	var lists *api.ListCache
+	if dir, err := api.DefaultCacheDir(); err == nil && !opts.Refresh {
+		lists = api.LoadListCache(dir, opts.CacheTTL)
 	}
-	fmt.Fprintf(&b, "\n%s (↑/↓, Enter, q):\n\n", m.title)
-	for i, it := range m.items {
-		cursor := " "
-		if i == m.cursor {
-			cursor = ">"
+	var user api.User
+	if opts.UserID != "" {
+		userAny, err := runWithSpinner(ctx, "Loading user...", func(c context.Context) (any, error) { return client.GetUserByID(c, opts.UserID) })
+		if err != nil {
+			return reportSubject{}, false, fmt.Errorf("failed to fetch user %s: %w", opts.UserID, err)
+		}
+		user = *userAny.(*api.User)
+	} else {
+		u, ok, err := pickDirectReport(ctx, client, lists)
+		if !ok || err != nil {
+			return reportSubject{}, false, err
 		}
-		fmt.Fprintf(&b, "%s %s\n", cursor, it)
+		user = u
 	}
-	return b.String()
-}
 
-func buildMarkdown(ctx context.Context, c *api.Client, userName, cycleName string, reviews []api.Review, censor bool) (string, error) {
-	mask := func(s string) string {
-		if !censor {
-			return s
-		}
-		var b strings.Builder
-		for _, r := range s {
-			if unicode.IsSpace(r) {
-				b.WriteRune(r)
-			} else {
-				b.WriteRune('▒')
-			}
+	fmt.Fprintln(os.Stderr)
+	_, _, cycles, ok := lists.Lookup()
+	if !ok {
+		cyclesAny, err := runWithSpinner(ctx, "Loading review cycles...", func(c context.Context) (any, error) { return client.ListReviewCycles(c) })
+		if err != nil {
+			return reportSubject{}, false, fmt.Errorf("failed to fetch review cycles: %w", err)
 		}
-		return b.String()
+		cycles = cyclesAny.([]api.ReviewCycle)
+		printWarnings(client)
 	}
-	peerByQ := make(map[string][]api.Review)
-	selfByQ := make(map[string][]api.Review)
-	qOrderPeer, qOrderSelf := make([]string, 0), make([]string, 0)
-	seenPeer, seenSelf := make(map[string]bool), make(map[string]bool)
-	for _, r := range reviews {
-		qid := r.Question.ID
-		switch strings.ToLower(r.ReviewType) {
-		case "self":
-			selfByQ[qid] = append(selfByQ[qid], r)
-			if !seenSelf[qid] {
-				qOrderSelf = append(qOrderSelf, qid)
-				seenSelf[qid] = true
-			}
-		default:
-			if r.Response == nil {
-				continue
-			}
-			hasContent := (r.Response.Comment != nil && strings.TrimSpace(*r.Response.Comment) != "") || len(r.Response.Choices) > 0 || r.Response.RatingString != nil || r.Response.Rating != nil
-			if !hasContent {
-				continue
-			}
-			peerByQ[qid] = append(peerByQ[qid], r)
-			if !seenPeer[qid] {
-				qOrderPeer = append(qOrderPeer, qid)
-				seenPeer[qid] = true
+
+	// Cached membership lets repeated runs skip the per-cycle reviewee fetches.
+	var cache *api.MembershipCache
+	if dir, err := api.DefaultCacheDir(); err == nil {
+		cache = api.LoadMembershipCache(dir, opts.CacheTTL, cycles)
+	}
+	saveCache := func() {
+		if cache != nil {
+			if err := cache.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not save cache: %v\n", err)
 			}
 		}
 	}
-
-	var b strings.Builder
-	fmt.Fprintf(&b, "# %s (%s)\n\n", userName, cycleName)
-	b.WriteString("## Peer Feedback\n\n")
-	for _, qid := range qOrderPeer {
-		qtext := "Question"
-		if q, err := c.GetQuestionByID(ctx, qid); err == nil {
-			qtext = html.UnescapeString(strings.TrimSpace(q.Body))
-			qtext = strings.ReplaceAll(qtext, "\n", " ")
-		}
-		fmt.Fprintf(&b, "### %s\n\n", qtext)
-		for _, r := range peerByQ[qid] {
-			name := "Unknown"
-			if r.Reviewer.ID != "" {
-				if u, err := c.GetUserByID(ctx, r.Reviewer.ID); err == nil && strings.TrimSpace(u.Name) != "" {
-					name = u.Name
+	// membership returns user's reviewee records in cy (none when not a
+	// member), consulting the cache first. Only single records are cached,
+	// so repeat enrollments are noticed on every run.
+	membership := func(c context.Context, cy api.ReviewCycle) ([]api.Reviewee, error) {
+		if cache != nil && !opts.Refresh {
+			if reviewsURL, member, ok := cache.Lookup(cy.ID, user.ID); ok {
+				if !member {
+					return nil, nil
 				}
+				return []api.Reviewee{{Reviews: api.ListRef{URL: reviewsURL}}}, nil
 			}
-			var score string
-			if r.Response.RatingString != nil && *r.Response.RatingString != "" {
-				score = *r.Response.RatingString
+		}
+		records, err := client.FindReviewees(c, cy, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if cache != nil && len(records) <= 1 {
+			reviewsURL := ""
+			if len(records) == 1 {
+				reviewsURL = records[0].Reviews.URL
 			}
-			if score == "" && r.Response.Rating != nil {
-				score = fmt.Sprintf("%.2f", *r.Response.Rating)
+			cache.Store(cy.ID, user.ID, reviewsURL, len(records) == 1)
+		}
+		return records, nil
+	}
+	// isMember reports whether user is a reviewee in cy, consulting the cache
+	// first. It stops reading reviewee pages at the first one listing the
+	// user, so it only decides which cycles to offer; the chosen cycle's
+	// records come from membership, which reads every page.
+	isMember := func(c context.Context, cy api.ReviewCycle) (bool, error) {
+		if cache != nil && !opts.Refresh {
+			if _, member, ok := cache.Lookup(cy.ID, user.ID); ok {
+				return member, nil
 			}
-			if score != "" {
-				fmt.Fprintf(&b, "%s (score: %s):\n\n", mask(name), mask(score))
-			} else {
-				fmt.Fprintf(&b, "%s:\n\n", mask(name))
+		}
+		member, err := client.IsReviewee(c, cy, user.ID)
+		if err == nil && !member && cache != nil {
+			cache.Store(cy.ID, user.ID, "", false)
+		}
+		return member, err
+	}
+	// Picking among repeat records is interactive unless both the user and
+	// the cycle came from flags.
+	interactive := opts.UserID == "" || opts.CycleID == ""
+
+	var cycle api.ReviewCycle
+	var records []api.Reviewee
+	if opts.CycleID != "" {
+		found := false
+		for _, cy := range cycles {
+			if cy.ID == opts.CycleID {
+				cycle, found = cy, true
+				break
 			}
-			quote := ""
-			if r.Response.Comment != nil && strings.TrimSpace(*r.Response.Comment) != "" {
-				quote = sanitizeText(strings.TrimSpace(*r.Response.Comment))
-			} else if len(r.Response.Choices) > 0 {
-				quote = sanitizeText(strings.Join(r.Response.Choices, ", "))
+		}
+		if !found {
+			return reportSubject{}, false, fmt.Errorf("no review cycle with ID %q", opts.CycleID)
+		}
+		recordsAny, err := runWithSpinner(ctx, fmt.Sprintf("Checking %s is a reviewee in %s...", user.Name, cycle.Name), func(c context.Context) (any, error) {
+			recs, err := membership(c, cycle)
+			if err == nil && len(recs) == 0 {
+				err = fmt.Errorf("%s is not a reviewee in %q (cycle ID %s)", user.Name, cycle.Name, cycle.ID)
 			}
-			if strings.TrimSpace(quote) == "" {
-				quote = "(no comment)"
+			return recs, err
+		})
+		saveCache()
+		if err != nil {
+			return reportSubject{}, false, fmt.Errorf("cycle check failed: %w", err)
+		}
+		records = recordsAny.([]api.Reviewee)
+	} else {
+		if opts.LimitCycles > 0 && len(cycles) > opts.LimitCycles {
+			// Most recent first when cycles carry dates; otherwise API order.
+			api.SortCyclesRecentFirst(cycles)
+			cycles = cycles[:opts.LimitCycles]
+		}
+		type cycleEntry struct {
+			Name  string
+			Cycle api.ReviewCycle
+		}
+		// Show a spinner while filtering cycles down to those that include the selected user
+		var skipped []string
+		filteredAny, err := runWithSpinner(ctx, fmt.Sprintf("Filtering cycles for %s...", user.Name), func(c context.Context) (any, error) {
+			out := make([]cycleEntry, 0)
+			for _, cy := range cycles {
+				// The client already retries 429 and 5xx responses.
+				member, err := isMember(c, cy)
+				if errors.Is(err, api.ErrUnauthorized) || c.Err() != nil {
+					return nil, err
+				}
+				if err != nil {
+					skipped = append(skipped, fmt.Sprintf("could not check cycle %q (%s); it is missing from the list: %v", cy.Name, cy.ID, err))
+					continue
+				}
+				if member {
+					out = append(out, cycleEntry{Name: cy.Name, Cycle: cy})
+				}
 			}
-			for _, line := range strings.Split(mask(quote), "\n") {
-				fmt.Fprintf(&b, "> %s\n", line)
+			return out, nil
+		})
+		saveCache()
+		if err != nil {
+			return reportSubject{}, false, fmt.Errorf("failed to filter review cycles: %w", err)
+		}
+		for _, w := range skipped {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		filtered := filteredAny.([]cycleEntry)
+		if len(filtered) == 0 {
+			hint := ""
+			if opts.LimitCycles > 0 {
+				hint = fmt.Sprintf(" (only the %d most recent were checked; see --limit-cycles)", opts.LimitCycles)
 			}
-			b.WriteString("\n")
+			fmt.Fprintf(os.Stderr, "No review cycles include %s%s; nothing to select.\n", user.Name, hint)
+			return reportSubject{}, false, nil
+		}
+		sort.Slice(filtered, func(i, j int) bool { return strings.ToLower(filtered[i].Name) < strings.ToLower(filtered[j].Name) })
+		if opts.SortCycles == "recent" {
+			sort.SliceStable(filtered, func(i, j int) bool { return api.CycleMoreRecent(filtered[i].Cycle, filtered[j].Cycle) })
+		}
+
+		cycleNames := make([]string, len(filtered))
+		for i, ce := range filtered {
+			cycleNames[i] = ce.Name
+		}
+		m2 := newListModel("Select a cycle", cycleNames)
+		if _, err := tea.NewProgram(m2, tea.WithOutput(statusOut)).Run(); err != nil {
+			return reportSubject{}, false, fmt.Errorf("tui error: %w", err)
+		}
+		if m2.quit {
+			fmt.Fprintln(os.Stderr, "Cancelled.")
+			return reportSubject{}, false, nil
+		}
+		if m2.choice == "" {
+			return reportSubject{}, false, nil
+		}
+		idx := m2.cursor
+		if idx < 0 || idx >= len(filtered) {
+			return reportSubject{}, false, nil
+		}
+		cycle = filtered[idx].Cycle
+		recordsAny, err := runWithSpinner(ctx, fmt.Sprintf("Loading %s's records in %s...", user.Name, cycle.Name), func(c context.Context) (any, error) {
+			return membership(c, cycle)
+		})
+		saveCache()
+		if err != nil {
+			return reportSubject{}, false, fmt.Errorf("failed to fetch reviewees: %w", err)
 		}
+		records = recordsAny.([]api.Reviewee)
+		if len(records) == 0 {
+			fmt.Fprintf(os.Stderr, "%s is no longer a reviewee in %q.\n", user.Name, cycle.Name)
+			return reportSubject{}, false, nil
+		}
+	}
+	reviewsURL, ok, err := chooseReviewee(user, cycle, records, interactive, opts.Strict)
+	if !ok || err != nil {
+		return reportSubject{}, false, err
+	}
+
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "Selected: %s — %s\n", user.Name, cycle.Name)
+	}
+	fmt.Fprintln(os.Stderr)
+	reviewsAny, err := runWithSpinner(ctx, "Fetching reviews for cycle: "+cycle.Name+"...", func(c context.Context) (any, error) {
+		return client.ListReviewsByURL(c, reviewsURL, 0, opts.MaxReviews)
+	})
+	if err != nil {
+		return reportSubject{}, false, fmt.Errorf("failed to fetch reviews: %w", err)
 	}
+	reviews := reviewsAny.([]api.Review)
+	printWarnings(client)
+
+	return reportSubject{User: user, Cycle: cycle, Reviews: reviews, Resolver: client}, true, nil
+}
 
-	b.WriteString("---\n\n")
-	b.WriteString("## Self Review\n\n")
-	for _, qid := range qOrderSelf {
-		qtext := "Question"
-		if q, err := c.GetQuestionByID(ctx, qid); err == nil {
-			qtext = sanitizeText(strings.TrimSpace(q.Body))
-			qtext = strings.ReplaceAll(qtext, "\n", " ")
+// pickDirectReport lists the current user's direct reports and lets them
+// pick one. Fresh lists in lists (which may be nil) are used instead of
+// fetching. It returns false if nothing was selected.
+func pickDirectReport(ctx context.Context, client *api.Client, lists *api.ListCache) (api.User, bool, error) {
+	me, reports, _, ok := lists.Lookup()
+	if !ok {
+		meAny, err := runWithSpinner(ctx, "Loading current user...", func(c context.Context) (any, error) { return client.GetMe(c) })
+		if err != nil {
+			return api.User{}, false, fmt.Errorf("failed to fetch current user: %w", err)
 		}
-		fmt.Fprintf(&b, "### %s\n\n", qtext)
-		for _, r := range selfByQ[qid] {
-			quote := ""
-			if r.Response != nil && r.Response.Comment != nil && strings.TrimSpace(*r.Response.Comment) != "" {
-				quote = sanitizeText(strings.TrimSpace(*r.Response.Comment))
-			} else if r.Response != nil && len(r.Response.Choices) > 0 {
-				quote = sanitizeText(strings.Join(r.Response.Choices, ", "))
-			}
-			if strings.TrimSpace(quote) == "" {
-				quote = "(no comment)"
-			}
-			for _, line := range strings.Split(mask(quote), "\n") {
-				fmt.Fprintf(&b, "> %s\n", line)
+		me = *meAny.(*api.User)
+
+		reportsAny, err := runWithSpinner(ctx, "Loading direct reports...", func(c context.Context) (any, error) { return client.ListUsersByURL(c, me.DirectReports.URL) })
+		if err != nil {
+			return api.User{}, false, fmt.Errorf("failed to fetch direct reports: %w", err)
+		}
+		reports = reportsAny.([]api.User)
+		printWarnings(client)
+	}
+
+	if len(reports) == 0 {
+		fmt.Fprintf(os.Stderr, "No direct reports found for %s; nothing to select.\n", me.Name)
+		return api.User{}, false, nil
+	}
+	sort.Slice(reports, func(i, j int) bool { return strings.ToLower(reports[i].Name) < strings.ToLower(reports[j].Name) })
+	names := make([]string, 0, len(reports))
+	for _, u := range reports {
+		names = append(names, u.Name)
+	}
+	m := newListModel("Select a user", names)
+	if _, err := tea.NewProgram(m, tea.WithOutput(statusOut)).Run(); err != nil {
+		return api.User{}, false, fmt.Errorf("tui error: %w", err)
+	}
+	if m.quit {
+		fmt.Fprintln(os.Stderr, "Cancelled.")
+		return api.User{}, false, nil
+	}
+	if m.choice == "" || m.cursor < 0 || m.cursor >= len(reports) {
+		return api.User{}, false, nil
+	}
+	return reports[m.cursor], true, nil
+}
+
+// runConfigCommand handles `tess config <action>`.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: tess config restore|show [--config PATH]")
+	}
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	cfgFlag := fs.String("config", "", "Path to config TOML (default: ~/.tess/config.toml)")
+	asJSON := false
+	if args[0] == "show" {
+		fs.BoolVar(&asJSON, "json", false, "Print the effective configuration as JSON")
+		fs.String("preset", "", "Show the effect of loading this preset")
+		fs.String("templates", "", "Show the effect of --templates hub=ID,cover=ID,review=ID")
+		// Accept the config-backed flags so their effect can be previewed.
+		for _, name := range api.ConfigFlags() {
+			fs.String(name, "", "Override the "+name+" setting")
+		}
+	}
+	fs.Parse(args[1:])
+	cfgPath := *cfgFlag
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = api.DefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	switch args[0] {
+	case "restore":
+		if err := api.RestoreConfigBackup(cfgPath); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s from %s\n", cfgPath, api.BackupPath(cfgPath))
+		return nil
+	case "show":
+		return showConfig(fs, cfgPath, asJSON)
+	default:
+		return fmt.Errorf("unknown config action %q", args[0])
+	}
+}
+
+// runPresetCommand handles `tess preset <action>`: save NAME stores the
+// given selections in the config file, and list prints the presets found in
+// the home and project configs.
+func runPresetCommand(args []string) error {
+	if len(args) == 0 || (args[0] == "save" && (len(args) < 2 || strings.HasPrefix(args[1], "-"))) {
+		return fmt.Errorf("usage: tess preset save NAME [--user-id ID] [--cycle-id ID] [--upload-format F] [--rclone-folder-id ID] [--config PATH] | tess preset list [--config PATH]")
+	}
+	fs := flag.NewFlagSet("preset "+args[0], flag.ExitOnError)
+	cfgFlag := fs.String("config", "", "Path to config TOML (default: ~/.tess/config.toml)")
+	var p api.Preset
+	rest := args[1:]
+	if args[0] == "save" {
+		fs.StringVar(&p.UserID, "user-id", "", "Lattice user ID of the reviewee")
+		fs.StringVar(&p.CycleID, "cycle-id", "", "Review cycle ID")
+		fs.StringVar(&p.UploadFormat, "upload-format", "", "Upload format: docx, html, or pdf")
+		fs.StringVar(&p.RcloneFolderID, "rclone-folder-id", "", "Google Drive folder ID to upload into")
+		rest = args[2:]
+	}
+	fs.Parse(rest)
+	cfgPath := *cfgFlag
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = api.DefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	switch args[0] {
+	case "save":
+		name := strings.TrimSpace(args[1])
+		p = api.Preset{UserID: strings.TrimSpace(p.UserID), CycleID: strings.TrimSpace(p.CycleID), UploadFormat: strings.ToLower(strings.TrimSpace(p.UploadFormat)), RcloneFolderID: strings.TrimSpace(p.RcloneFolderID)}
+		if p == (api.Preset{}) {
+			return fmt.Errorf("nothing to save; pass at least one of --user-id, --cycle-id, --upload-format, --rclone-folder-id")
+		}
+		if p.UploadFormat != "" && !slices.Contains(uploadFormats, p.UploadFormat) {
+			return fmt.Errorf("invalid --upload-format %q (want one of: %s)", p.UploadFormat, strings.Join(uploadFormats, ", "))
+		}
+		if err := api.SavePreset(cfgPath, name, p); err != nil {
+			return err
+		}
+		fmt.Printf("Saved preset %q to %s; use it with: tess --preset %q\n", name, cfgPath, name)
+		return nil
+	case "list":
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		cfg, err := api.LoadEffectiveConfig(cfgPath, cwd, nil)
+		if err != nil {
+			return err
+		}
+		if len(cfg.Presets) == 0 {
+			fmt.Println("No presets saved.")
+			return nil
+		}
+		names := make([]string, 0, len(cfg.Presets))
+		for name := range cfg.Presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := cfg.Presets[name]
+			var parts []string
+			for _, f := range []struct{ key, val string }{{"user_id", p.UserID}, {"cycle_id", p.CycleID}, {"upload_format", p.UploadFormat}, {"rclone_folder_id", p.RcloneFolderID}} {
+				if f.val != "" {
+					parts = append(parts, f.key+"="+f.val)
+				}
 			}
-			b.WriteString("\n")
+			fmt.Printf("%s: %s\n", name, strings.Join(parts, ", "))
 		}
+		return nil
+	default:
+		return fmt.Errorf("unknown preset action %q", args[0])
+	}
+}
+
+// showConfig prints every resolved setting with its source. Secrets are
+// masked by EffectiveConfig.Settings; the raw API key is never printed.
+func showConfig(fs *flag.FlagSet, cfgPath string, asJSON bool) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	setFlags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "json" && f.Name != "templates" {
+			setFlags[f.Name] = f.Value.String()
+		}
+	})
+	templateIDs, err := parseTemplatesFlag(fs.Lookup("templates").Value.String())
+	if err != nil {
+		return err
+	}
+	for name, id := range templateIDs {
+		setFlags[name] = id
+	}
+	cfg, loadErr := api.LoadEffectiveConfig(cfgPath, cwd, setFlags)
+	printConfigWarning(cfg)
+	if asJSON {
+		out := struct {
+			HomePath    string        `json:"homePath"`
+			HomeFound   bool          `json:"homeFound"`
+			ProjectPath string        `json:"projectPath,omitempty"`
+			Settings    []api.Setting `json:"settings"`
+			Error       string        `json:"error,omitempty"`
+		}{HomePath: cfgPath, HomeFound: cfg.HomeFound, ProjectPath: cfg.ProjectPath, Settings: cfg.Settings()}
+		if loadErr != nil {
+			out.Error = loadErr.Error()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+		return loadErr
+	}
+	found := "found"
+	if !cfg.HomeFound {
+		found = "not found"
+	}
+	fmt.Printf("Home config: %s (%s)\n", cfgPath, found)
+	if cfg.ProjectPath != "" {
+		fmt.Printf("Project config: %s\n", cfg.ProjectPath)
+	}
+	fmt.Println()
+	for _, st := range cfg.Settings() {
+		fmt.Printf("%s = %s (%s)\n", st.Key, st.Value, st.Source)
+	}
+	return loadErr
+}
+
+// hiddenFlags are accepted but left out of --help: debugging aids that
+// bypass the normal flow.
+var hiddenFlags = map[string]bool{"reviews-url": true}
+
+// printVisibleDefaults prints flag defaults like flag.PrintDefaults, minus
+// hiddenFlags.
+func printVisibleDefaults(out io.Writer) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.PrintDefaults()
+}
+
+// subjectFromReviewsURL fetches reviews straight from listURL (--reviews-url)
+// for reproducing rendering problems against a specific endpoint. The
+// reviewee is looked up from the reviews when possible; otherwise generic
+// names stand in, and outputFileName still produces a usable file name.
+func subjectFromReviewsURL(ctx context.Context, client *api.Client, listURL string, maxReviews int) (reportSubject, error) {
+	fmt.Fprintf(os.Stderr, "Fetching reviews directly from %s (--reviews-url)\n", listURL)
+	reviewsAny, err := runWithSpinner(ctx, "Fetching reviews...", func(c context.Context) (any, error) {
+		return client.ListReviewsByURL(c, listURL, 0, maxReviews)
+	})
+	if err != nil {
+		return reportSubject{}, fmt.Errorf("failed to fetch reviews: %w", err)
+	}
+	reviews := reviewsAny.([]api.Review)
+	printWarnings(client)
+	subj := reportSubject{
+		User:     api.User{Name: "Unknown reviewee"},
+		Cycle:    api.ReviewCycle{Name: "Unknown cycle"},
+		Reviews:  reviews,
+		Resolver: client,
+	}
+	for _, r := range reviews {
+		if r.Reviewee.ID == "" {
+			continue
+		}
+		subj.User.ID = r.Reviewee.ID
+		if u, err := client.GetUserByID(ctx, r.Reviewee.ID); err == nil && strings.TrimSpace(u.Name) != "" {
+			subj.User = *u
+		}
+		break
+	}
+	return subj, nil
+}
+
+// printConfigWarning writes the project-config warning, if any, to stderr.
+func printConfigWarning(cfg api.EffectiveConfig) {
+	if w := cfg.ProjectWarning(); w != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
+// printWarnings writes any warnings the client recorded (e.g. truncated
+// results) to stderr so incomplete data is never silent.
+func printWarnings(client *api.Client) {
+	for _, w := range client.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
 	}
-	return b.String(), nil
 }
 
 func outputFileName(userName, cycleName string) string {
@@ -600,47 +1442,11 @@ func outputFileName(userName, cycleName string) string {
 	if first == "" {
 		first = "user"
 	}
-	return fmt.Sprintf("%s_%s_%s.md", toSlug(first), toSlug(last), toSlug(cycleName))
-}
-
-func sanitizeText(s string) string {
-	if s == "" {
-		return s
-	}
-	s = html.UnescapeString(s)
-	repls := []struct{ old, new string }{{"<br>", "\n"}, {"<br/>", "\n"}, {"<br />", "\n"}, {"</p>", "\n"}, {"<p>", ""}}
-	for _, r := range repls {
-		s = strings.ReplaceAll(s, r.old, r.new)
-	}
-	var b strings.Builder
-	inTag := false
-	for _, r := range s {
-		switch r {
-		case '<':
-			inTag = true
-		case '>':
-			if inTag {
-				inTag = false
-			}
-		default:
-			if !inTag {
-				b.WriteRune(r)
-			}
-		}
-	}
-	raw := strings.Split(b.String(), "\n")
-	compact := make([]string, 0, len(raw))
-	prevBlank := false
-	for _, line := range raw {
-		l := strings.TrimRight(line, " 	")
-		isBlank := strings.TrimSpace(l) == ""
-		if isBlank && prevBlank {
-			continue
-		}
-		compact = append(compact, l)
-		prevBlank = isBlank
+	cycle := toSlug(cycleName)
+	if cycle == "" {
+		cycle = "reviews"
 	}
-	return strings.TrimSpace(strings.Join(compact, "\n"))
+	return fmt.Sprintf("%s_%s_%s.md", toSlug(first), toSlug(last), cycle)
 }
 
 type doneMsg struct {
@@ -659,6 +1465,9 @@ type spinModel struct {
 func newSpinModel(ctx context.Context, title string, fn func(context.Context) (any, error)) *spinModel {
 	s := bubspinner.New()
 	s.Spinner = bubspinner.Pulse
+	if !api.Glyphs.Spinner {
+		s.Spinner = bubspinner.Line
+	}
 	return &spinModel{sp: s, title: title, work: fn, ctx: ctx}
 }
 func (m *spinModel) Init() tea.Cmd {
@@ -679,33 +1488,40 @@ func (m *spinModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m *spinModel) View() string { return fmt.Sprintf("%s %s", m.sp.View(), m.title) }
 func runWithSpinner(ctx context.Context, title string, fn func(context.Context) (any, error)) (any, error) {
 	m := newSpinModel(ctx, title, fn)
-	p := tea.NewProgram(m)
+	// The spinner reads no keys, so it needs no TTY for input.
+	p := tea.NewProgram(m, tea.WithOutput(statusOut), tea.WithInput(nil))
 	if _, err := p.Run(); err != nil {
 		return nil, err
 	}
 	// Persist a final line so history remains
-	fmt.Fprintf(os.Stderr, "✓ %s\n", title)
+	glyph := api.Glyphs.OK
+	if m.err != nil {
+		glyph = api.Glyphs.Fail
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", glyph, title)
 	return m.result, m.err
 }
 
 // buildHTMLDocument wraps Markdown content in minimal HTML for Drive import.
-
-// buildHTMLDocument wraps Markdown content in minimal HTML for Drive import.
-func buildHTMLDocument(title, md string) string {
+// badges maps reviewer names to inline HTML shown before their entries (see
+// reviewerBadges); nil means none.
+func buildHTMLDocument(title, md string, badges map[string]string) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "<!doctype html><html><head><meta charset=\"utf-8\"><title>%s</title></head><body>\n", html.EscapeString(title))
-	b.WriteString(markdownToBasicHTML(md))
+	b.WriteString(markdownToBasicHTML(md, badges))
 	b.WriteString("\n</body></html>")
 	return b.String()
 }
 
 // markdownToBasicHTML converts a subset of our Markdown to simple HTML suitable for Drive import.
-func markdownToBasicHTML(md string) string {
+// Reviewer entry leads ("Name:", "Name (score: ...):", or "**Name**" in
+// compact quotes) get the matching badge from badges.
+func markdownToBasicHTML(md string, badges map[string]string) string {
 	lines := strings.Split(md, "\n")
 	var b strings.Builder
 	para := func(s string) {
 		if strings.TrimSpace(s) != "" {
-			fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(s))
+			fmt.Fprintf(&b, "<p>%s%s</p>\n", badgeFor(s, badges), inlineHTML(s))
 		}
 	}
 	var acc []string
@@ -733,7 +1549,8 @@ func markdownToBasicHTML(md string) string {
 		}
 		if strings.HasPrefix(ln, "> ") {
 			flush()
-			fmt.Fprintf(&b, "<blockquote>%s</blockquote>\n", html.EscapeString(strings.TrimSpace(strings.TrimPrefix(ln, "> "))))
+			q := strings.TrimSpace(strings.TrimPrefix(ln, "> "))
+			fmt.Fprintf(&b, "<blockquote>%s%s</blockquote>\n", badgeFor(q, badges), inlineHTML(q))
 			continue
 		}
 		if strings.TrimSpace(ln) == "" {
@@ -745,3 +1562,60 @@ func markdownToBasicHTML(md string) string {
 	flush()
 	return b.String()
 }
+
+// badgeFor returns the badge for the reviewer whose entry lead starts s,
+// followed by a space, or "" when s is not a reviewer lead.
+func badgeFor(s string, badges map[string]string) string {
+	for name, badge := range badges {
+		if s == name+":" || strings.HasPrefix(s, name+" (score: ") || strings.HasPrefix(s, "**"+name+"**") {
+			return badge + " "
+		}
+	}
+	return ""
+}
+
+// inlineHTML escapes s for HTML and renders the inline Markdown reviewers
+// commonly type: **strong**, *em* / _em_, and `code`. Backslash escapes are
+// honored, so comments written with --comment-markdown escape come out as
+// the reviewer typed them.
+func inlineHTML(s string) string {
+	var b strings.Builder
+	span := func(i int, delim, tag string) (int, bool) {
+		if !strings.HasPrefix(s[i:], delim) {
+			return i, false
+		}
+		// Intraword underscores (snake_case) are not emphasis.
+		if delim[0] == '_' && i > 0 && (unicode.IsLetter(rune(s[i-1])) || unicode.IsDigit(rune(s[i-1]))) {
+			return i, false
+		}
+		rest := s[i+len(delim):]
+		j := strings.Index(rest, delim)
+		if j <= 0 || rest[0] == ' ' || rest[j-1] == '\\' {
+			return i, false
+		}
+		inner := html.EscapeString(rest[:j])
+		if tag != "code" {
+			inner = inlineHTML(rest[:j])
+		}
+		fmt.Fprintf(&b, "<%s>%s</%s>", tag, inner, tag)
+		return i + 2*len(delim) + j, true
+	}
+	for i := 0; i < len(s); {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(markdownPunct, s[i+1]) >= 0 {
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		}
+		matched := false
+		for _, m := range []struct{ delim, tag string }{{"`", "code"}, {"**", "strong"}, {"__", "strong"}, {"*", "em"}, {"_", "em"}} {
+			if i, matched = span(i, m.delim, m.tag); matched {
+				break
+			}
+		}
+		if !matched {
+			b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	api "tess/internal"
+)
+
+func TestChooseRevieweeWithoutPrompt(t *testing.T) {
+	user := api.User{Name: "Ada"}
+	cycle := api.ReviewCycle{Name: "Q4"}
+	older := api.Reviewee{ID: "r1", Reviews: api.ListRef{URL: "/r1"}, UpdatedAt: api.Timestamp{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	newer := api.Reviewee{ID: "r2", Reviews: api.ListRef{URL: "/r2"}, UpdatedAt: api.Timestamp{Time: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}}
+
+	for _, tc := range []struct {
+		name    string
+		records []api.Reviewee
+		strict  bool
+		want    string
+		wantErr string
+	}{
+		{"single record", []api.Reviewee{older}, true, "/r1", ""},
+		{"most recent", []api.Reviewee{newer, older}, false, "/r2", ""},
+		{"strict", []api.Reviewee{older, newer}, true, "", "refusing to guess with --strict (IDs: r1, r2)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := chooseReviewee(user, cycle, tc.records, false, tc.strict)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) || ok {
+					t.Errorf("got %q, %t, %v; want an error containing %q", got, ok, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !ok || got != tc.want {
+				t.Errorf("got %q, %t, %v; want %q", got, ok, err, tc.want)
+			}
+		})
+	}
+}
+
+// apiStub answers every request sent through http.DefaultTransport with the
+// status and body for its URL path, so commands can run without the network.
+type apiStub map[string]struct {
+	status int
+	body   string
+}
+
+func (s apiStub) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, ok := s[r.URL.Path]
+	if !ok {
+		resp.status, resp.body = http.StatusNotFound, "not found"
+	}
+	return &http.Response{StatusCode: resp.status, Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(strings.NewReader(resp.body)), Request: r}, nil
+}
+
+// useAPIStub routes the default transport to stub for the rest of the test
+// and keeps the membership cache in a temporary home. Spinner frames are
+// discarded.
+func useAPIStub(t *testing.T, stub apiStub) *api.Client {
+	t.Helper()
+	prev := http.DefaultTransport
+	prevOut := statusOut
+	http.DefaultTransport, statusOut = stub, io.Discard
+	t.Cleanup(func() { http.DefaultTransport, statusOut = prev, prevOut })
+	t.Setenv("HOME", t.TempDir())
+	client, err := api.NewClient("test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetries(0)
+	return client
+}
+
+func TestSelectReportReturnsErrors(t *testing.T) {
+	user := `{"id":"u1","name":"Ada"}`
+	cycles := `{"data":[{"id":"c1","name":"Q4"}]}`
+	for _, tc := range []struct {
+		name     string
+		stub     apiStub
+		opts     selectOptions
+		wantErr  string
+		wantCode int
+	}{
+		{
+			name:     "unknown cycle",
+			stub:     apiStub{"/v1/user/u1": {200, user}, "/v1/reviewCycles": {200, cycles}},
+			opts:     selectOptions{UserID: "u1", CycleID: "missing"},
+			wantErr:  `no review cycle with ID "missing"`,
+			wantCode: 1,
+		},
+		{
+			name:     "rejected key",
+			stub:     apiStub{"/v1/user/u1": {401, `{"error":"unauthorized"}`}},
+			opts:     selectOptions{UserID: "u1", CycleID: "c1"},
+			wantErr:  "failed to fetch user u1",
+			wantCode: api.ExitUnauthorized,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := useAPIStub(t, tc.stub)
+			_, ok, err := selectReport(context.Background(), client, tc.opts)
+			if ok || err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got %t, %v; want an error containing %q", ok, err, tc.wantErr)
+			}
+			if unauthorized := errors.Is(err, api.ErrUnauthorized); unauthorized != (tc.wantCode == api.ExitUnauthorized) {
+				t.Errorf("errors.Is(err, ErrUnauthorized) = %t", unauthorized)
+			}
+			if code := errorExitCode(err); code != tc.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tc.wantCode)
+			}
+		})
+	}
+}
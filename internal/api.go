@@ -3,10 +3,15 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,14 +19,26 @@ import (
 
 const defaultBaseURL = "https://api.latticehq.com/"
 
+// Client talks to the Lattice API. It is safe for concurrent use: the user
+// and question caches and the warning list are guarded by mu.
 type Client struct {
 	base          *url.URL
 	http          *http.Client
 	apiKey        string
+	authHeader    string
+	authTemplate  string
 	userCache     map[string]*User
 	questionCache map[string]*Question
+	warnings      []string
+	// retries is how many times a request answered with 429 or a 5xx status
+	// is sent again; see doJSON.
+	retries int
 }
 
+// DefaultAPIRetries is the default number of retries for a request that
+// got a 429 or 5xx response.
+const DefaultAPIRetries = 3
+
 func NewClient(apiKey string) (*Client, error) {
 	if strings.TrimSpace(apiKey) == "" {
 		return nil, fmt.Errorf("api key is empty")
@@ -33,9 +50,81 @@ func NewClient(apiKey string) (*Client, error) {
 		apiKey:        apiKey,
 		userCache:     make(map[string]*User),
 		questionCache: make(map[string]*Question),
+		retries:       DefaultAPIRetries,
 	}, nil
 }
 
+// NewClientFromConfig creates a Client for cfg's API key, applying its
+// auth_header and auth_value_template settings.
+func NewClientFromConfig(cfg EffectiveConfig) (*Client, error) {
+	c, err := NewClient(cfg.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetAuth(cfg.AuthHeader, cfg.AuthValueTemplate); err != nil {
+		return nil, err
+	}
+	if v := strings.TrimSpace(cfg.APIRetries); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid api_retries %q (want a whole number, 0 to disable)", cfg.APIRetries)
+		}
+		c.SetRetries(n)
+	}
+	return c, nil
+}
+
+// SetRetries sets how many times a request answered with 429 or a 5xx
+// status is retried; 0 disables retries.
+func (c *Client) SetRetries(n int) {
+	c.retries = max(n, 0)
+}
+
+// authKeyPlaceholder is replaced with the API key in an auth value template.
+const authKeyPlaceholder = "{key}"
+
+// SetAuth changes how the API key is sent, for gateways that don't use the
+// standard scheme. header names the request header ("" means
+// Authorization). valueTemplate shapes its value, with {key} standing for
+// the API key, e.g. "Token {key}"; "" keeps the default of adding "Bearer "
+// unless the key already carries a scheme.
+func (c *Client) SetAuth(header, valueTemplate string) error {
+	header = strings.TrimSpace(header)
+	if header != "" && strings.Trim(header, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&'*+-.^_`|~") != "" {
+		return fmt.Errorf("invalid auth header name %q", header)
+	}
+	if valueTemplate != "" && !strings.Contains(valueTemplate, authKeyPlaceholder) {
+		return fmt.Errorf("auth value template %q must contain %s", valueTemplate, authKeyPlaceholder)
+	}
+	if strings.ContainsAny(valueTemplate, "\r\n") {
+		return fmt.Errorf("auth value template must be a single line")
+	}
+	c.authHeader, c.authTemplate = header, valueTemplate
+	return nil
+}
+
+// BaseHost returns the host name of the Lattice API base URL.
+func (c *Client) BaseHost() string {
+	return c.base.Hostname()
+}
+
+// warnf records a non-fatal warning for the caller to surface.
+func (c *Client) warnf(format string, args ...any) {
+	mu.Lock()
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+	mu.Unlock()
+}
+
+// Warnings returns and clears any warnings recorded since the last call,
+// such as list results truncated to their first page.
+func (c *Client) Warnings() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	w := c.warnings
+	c.warnings = nil
+	return w
+}
+
 func (c *Client) resolve(pathOrURL string) (string, error) {
 	if strings.HasPrefix(pathOrURL, "http://") || strings.HasPrefix(pathOrURL, "https://") {
 		return pathOrURL, nil
@@ -61,16 +150,24 @@ func (c *Client) newRequest(ctx context.Context, method, pathOrURL string, body
 		return nil, err
 	}
 	req.Header.Set("accept", "application/json")
-	// Prefer a Bearer token; allow preformatted values in config.
-	req.Header.Set("Authorization", c.authHeaderValue())
+	header := c.authHeader
+	if header == "" {
+		header = "Authorization"
+	}
+	req.Header.Set(header, c.authHeaderValue())
 	return req, nil
 }
 
+// authHeaderValue renders the auth header value: the configured template,
+// or a Bearer token (preformatted values in config are kept as they are).
 func (c *Client) authHeaderValue() string {
 	v := strings.TrimSpace(c.apiKey)
 	if v == "" {
 		return ""
 	}
+	if c.authTemplate != "" {
+		return strings.ReplaceAll(c.authTemplate, authKeyPlaceholder, v)
+	}
 	lower := strings.ToLower(v)
 	if strings.HasPrefix(lower, "bearer ") || strings.HasPrefix(lower, "basic ") || strings.HasPrefix(lower, "token ") || strings.HasPrefix(lower, "lattice ") {
 		return v
@@ -78,7 +175,107 @@ func (c *Client) authHeaderValue() string {
 	return "Bearer " + v
 }
 
+// ErrUnauthorized matches (via errors.Is) an HTTPError for a 401 or 403,
+// which almost always means the API key expired or was revoked.
+var ErrUnauthorized = errors.New("api key rejected")
+
+// ExitUnauthorized is the process exit code used when the API key is rejected.
+const ExitUnauthorized = 3
+
+// HTTPError is returned for a non-2xx API response.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay asked for by a Retry-After header, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Body)
+}
+
+// Is reports whether the error matches ErrUnauthorized.
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrUnauthorized && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+}
+
+// UnauthorizedMessage returns an actionable message if err is a rejected API
+// key, and false otherwise.
+func UnauthorizedMessage(err error) (string, bool) {
+	var he *HTTPError
+	if !errors.As(err, &he) || !errors.Is(he, ErrUnauthorized) {
+		return "", false
+	}
+	return fmt.Sprintf("Your API key was rejected (%d). Run 'tess setup' to update it.", he.StatusCode), true
+}
+
+// maxRetryAfter caps how long doJSON honors a Retry-After header.
+const maxRetryAfter = time.Minute
+
+// doJSON sends req and decodes the JSON response into v (if non-nil).
+// Responses with 429 or a 5xx status are retried up to c.retries times,
+// waiting for the Retry-After header when present (at most maxRetryAfter)
+// and otherwise backing off exponentially from 500ms with jitter. Other
+// errors, including 4xx responses, are returned at once.
 func (c *Client) doJSON(req *http.Request, v any) error {
+	for attempt := 0; ; attempt++ {
+		err := c.doJSONOnce(req, v)
+		var he *HTTPError
+		if err == nil || attempt >= c.retries || !errors.As(err, &he) || !retryableStatus(he.StatusCode) {
+			return err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return err
+		}
+		wait := he.RetryAfter
+		if wait <= 0 {
+			base := 500 * time.Millisecond << attempt
+			wait = base/2 + rand.N(base/2)
+		}
+		if err := retryWait(req.Context(), min(wait, maxRetryAfter)); err != nil {
+			return err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// retryWait sleeps for d between retries, returning early with ctx's error
+// if it ends first. Tests replace it to skip the wait.
+var retryWait = func(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date,
+// returning zero when it is absent or unparseable.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func (c *Client) doJSONOnce(req *http.Request, v any) error {
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return err
@@ -86,7 +283,7 @@ func (c *Client) doJSON(req *http.Request, v any) error {
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
-		return fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(b)), RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
 	}
 	if v == nil {
 		io.Copy(io.Discard, resp.Body)
@@ -107,45 +304,175 @@ type User struct {
 	Name          string  `json:"name"`
 	Email         string  `json:"email"`
 	DirectReports ListRef `json:"directReports"`
+	// AvatarURL is the profile image, when the API provides one.
+	AvatarURL string `json:"avatarUrl,omitempty"`
 }
 
-type userListResponse struct {
+// listResponse is the envelope of a paginated list endpoint. Lattice uses
+// data/hasMore/endingCursor, but some endpoints spell the fields differently;
+// UnmarshalJSON accepts the known variants so a different envelope can't
+// silently decode as an empty list.
+type listResponse[T any] struct {
 	Object       string `json:"object"`
 	HasMore      bool   `json:"hasMore"`
 	EndingCursor any    `json:"endingCursor"`
-	Data         []User `json:"data"`
+	Data         []T    `json:"data"`
+}
+
+// Alternate envelope field names, in order of preference after the canonical
+// one (listed first).
+var (
+	listDataFields    = []string{"data", "items", "results", "records"}
+	listHasMoreFields = []string{"hasMore", "has_more", "hasNextPage", "has_next_page"}
+	listCursorFields  = []string{"endingCursor", "ending_cursor", "nextCursor", "next_cursor", "cursor"}
+)
+
+func (lr *listResponse[T]) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*lr = listResponse[T]{}
+	if v, ok := raw["object"]; ok {
+		_ = json.Unmarshal(v, &lr.Object)
+	}
+	if v, ok := firstField(raw, listDataFields); ok {
+		if err := json.Unmarshal(v, &lr.Data); err != nil {
+			return err
+		}
+	}
+	if v, ok := firstField(raw, listHasMoreFields); ok {
+		if err := json.Unmarshal(v, &lr.HasMore); err != nil {
+			return err
+		}
+	}
+	if v, ok := firstField(raw, listCursorFields); ok {
+		if err := json.Unmarshal(v, &lr.EndingCursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstField returns the first of names present (and not null) in raw.
+func firstField(raw map[string]json.RawMessage, names []string) (json.RawMessage, bool) {
+	for _, name := range names {
+		if v, ok := raw[name]; ok && string(v) != "null" {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Timestamp decodes API times given as RFC 3339 strings, plain dates
+// (YYYY-MM-DD), or Unix seconds. Missing or unparseable values are zero.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(b)), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339, "2006-01-02"} {
+		if v, err := time.Parse(layout, s); err == nil {
+			t.Time = v
+			return nil
+		}
+	}
+	var secs float64
+	if _, err := fmt.Sscanf(s, "%g", &secs); err == nil {
+		if secs > 1e12 { // milliseconds
+			secs /= 1000
+		}
+		t.Time = time.Unix(int64(secs), 0).UTC()
+	}
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339))
 }
 
 // Review cycles
 type ReviewCycle struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	Reviewees ListRef `json:"reviewees"`
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Reviewees  ListRef   `json:"reviewees"`
+	CreatedAt  Timestamp `json:"createdAt"`
+	LaunchedAt Timestamp `json:"launchedAt"`
+	EndedAt    Timestamp `json:"endedAt"`
 }
 
-type reviewCycleListResponse struct {
-	Object       string        `json:"object"`
-	HasMore      bool          `json:"hasMore"`
-	EndingCursor any           `json:"endingCursor"`
-	Data         []ReviewCycle `json:"data"`
+// Date returns the best available date for ordering cycles (launch, then
+// creation), or the zero time if the API provided neither.
+func (rc ReviewCycle) Date() time.Time {
+	if !rc.LaunchedAt.IsZero() {
+		return rc.LaunchedAt.Time
+	}
+	return rc.CreatedAt.Time
+}
+
+// SortCyclesRecentFirst orders cycles by Date descending. Cycles without a
+// date keep their relative order after the dated ones.
+func SortCyclesRecentFirst(cycles []ReviewCycle) {
+	sort.SliceStable(cycles, func(i, j int) bool { return CycleMoreRecent(cycles[i], cycles[j]) })
+}
+
+// CycleMoreRecent reports whether a sorts before b in recent-first order:
+// a is dated and b is newer or undated. It is a less function for stable
+// sorts, so undated cycles keep their order.
+func CycleMoreRecent(a, b ReviewCycle) bool {
+	da, db := a.Date(), b.Date()
+	if da.IsZero() || db.IsZero() {
+		return !da.IsZero() && db.IsZero()
+	}
+	return da.After(db)
 }
 
+type reviewCycleListResponse = listResponse[ReviewCycle]
+
 // Reviewees
 type UserRef struct {
 	ID string `json:"id"`
+	// Name and Email are decoded when the endpoint embeds them; they may be empty.
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
 }
 
 type Reviewee struct {
 	ID      string  `json:"id"`
 	User    UserRef `json:"user"`
 	Reviews ListRef `json:"reviews"`
+	// Status, CreatedAt, and UpdatedAt are empty/zero when the API omits
+	// them; they tell apart repeat records for the same user.
+	Status    string    `json:"status,omitempty"`
+	CreatedAt Timestamp `json:"createdAt"`
+	UpdatedAt Timestamp `json:"updatedAt"`
 }
 
-type revieweeListResponse struct {
-	Object       string     `json:"object"`
-	HasMore      bool       `json:"hasMore"`
-	EndingCursor any        `json:"endingCursor"`
-	Data         []Reviewee `json:"data"`
+// MostRecentReviewee returns the record in list with the latest update (or
+// creation) time; without dates, the last one in API order wins. list must
+// not be empty.
+func MostRecentReviewee(list []Reviewee) Reviewee {
+	stamp := func(rv Reviewee) time.Time {
+		if !rv.UpdatedAt.IsZero() {
+			return rv.UpdatedAt.Time
+		}
+		return rv.CreatedAt.Time
+	}
+	best := list[0]
+	for _, rv := range list[1:] {
+		if !stamp(rv).Before(stamp(best)) {
+			best = rv
+		}
+	}
+	return best
 }
 
 func (c *Client) GetMe(ctx context.Context) (*User, error) {
@@ -160,16 +487,58 @@ func (c *Client) GetMe(ctx context.Context) (*User, error) {
 	return &u, nil
 }
 
+// ListUsersByURL fetches every page of users at listURL (e.g. a user's
+// direct reports), following the response cursor; see listPages.
 func (c *Client) ListUsersByURL(ctx context.Context, listURL string) ([]User, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, listURL, nil)
+	return listPages[User](ctx, c, listURL, "users", nil)
+}
+
+// listPages fetches every page of the list at listURL, passing each
+// response's endingCursor back as startingAfter until hasMore is false, and
+// returns the items in page order. If stop is non-nil and returns true for
+// a page, no further pages are fetched. If a page after the first fails, the
+// items fetched so far are returned along with the error; what names the
+// items in that error and in warnings.
+func listPages[T any](ctx context.Context, c *Client, listURL, what string, stop func(page []T) bool) ([]T, error) {
+	full, err := c.resolve(listURL)
 	if err != nil {
 		return nil, err
 	}
-	var lr userListResponse
-	if err := c.doJSON(req, &lr); err != nil {
-		return nil, err
+	var out []T
+	cursor := ""
+	for page := 1; ; page++ {
+		u, err := url.Parse(full)
+		if err != nil {
+			return nil, err
+		}
+		if cursor != "" {
+			q := u.Query()
+			q.Set("startingAfter", cursor)
+			u.RawQuery = q.Encode()
+		}
+		req, err := c.newRequest(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return out, err
+		}
+		var lr listResponse[T]
+		if err := c.doJSON(req, &lr); err != nil {
+			if page > 1 {
+				err = fmt.Errorf("%s page %d (after %d %s): %w", what, page, len(out), what, err)
+			}
+			return out, err
+		}
+		out = append(out, lr.Data...)
+		next := cursorString(lr.EndingCursor)
+		if !lr.HasMore || (stop != nil && stop(lr.Data)) {
+			return out, nil
+		}
+		// A missing or repeated cursor would refetch the same page forever.
+		if next == "" || next == cursor {
+			c.warnf("results truncated; some %s not shown (%d loaded)", what, len(out))
+			return out, nil
+		}
+		cursor = next
 	}
-	return lr.Data, nil
 }
 
 func (c *Client) ListReviewCycles(ctx context.Context) ([]ReviewCycle, error) {
@@ -194,19 +563,66 @@ func (c *Client) ListReviewCycles(ctx context.Context) ([]ReviewCycle, error) {
 	if err := c.doJSON(req, &lr); err != nil {
 		return nil, err
 	}
+	if lr.HasMore {
+		c.warnf("results truncated; some review cycles not shown (%d loaded)", len(lr.Data))
+	}
 	return lr.Data, nil
 }
 
+// ListRevieweesByURL fetches every page of a cycle's reviewees at listURL,
+// following the response cursor; see listPages.
 func (c *Client) ListRevieweesByURL(ctx context.Context, listURL string) ([]Reviewee, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, listURL, nil)
+	return listPages[Reviewee](ctx, c, listURL, "reviewees", nil)
+}
+
+// ListRevieweesUntil is ListRevieweesByURL, except that it stops after the
+// first page for which stop returns true, returning the pages so far. Use it
+// when only some reviewees are wanted, to skip the rest of a large cycle.
+func (c *Client) ListRevieweesUntil(ctx context.Context, listURL string, stop func(page []Reviewee) bool) ([]Reviewee, error) {
+	return listPages(ctx, c, listURL, "reviewees", stop)
+}
+
+// FindReviewees returns every reviewee record for userID in cycle, in API
+// order. A user normally has one; re-enrollment can leave several, possibly
+// on different pages, so every page is read.
+func (c *Client) FindReviewees(ctx context.Context, cycle ReviewCycle, userID string) ([]Reviewee, error) {
+	reviewees, err := c.ListRevieweesByURL(ctx, cycle.Reviewees.URL)
 	if err != nil {
 		return nil, err
 	}
-	var lr revieweeListResponse
-	if err := c.doJSON(req, &lr); err != nil {
-		return nil, err
+	var out []Reviewee
+	for _, rv := range reviewees {
+		if rv.User.ID == userID {
+			out = append(out, rv)
+		}
 	}
-	return lr.Data, nil
+	return out, nil
+}
+
+// IsReviewee reports whether userID is a reviewee in cycle. Pages are
+// fetched only until the one that contains the user, so it is cheaper than
+// FindReviewees when the records themselves aren't needed; a user who isn't
+// a reviewee still costs a full walk.
+func (c *Client) IsReviewee(ctx context.Context, cycle ReviewCycle, userID string) (bool, error) {
+	isUser := func(rv Reviewee) bool { return rv.User.ID == userID }
+	reviewees, err := c.ListRevieweesUntil(ctx, cycle.Reviewees.URL, func(page []Reviewee) bool {
+		return slices.ContainsFunc(page, isUser)
+	})
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(reviewees, isUser), nil
+}
+
+// FindRevieweeReviewsURL looks through a cycle's reviewees for userID and
+// returns that reviewee's reviews URL, using the most recent record when
+// there are several; ok is false when the user is not a reviewee in the cycle.
+func (c *Client) FindRevieweeReviewsURL(ctx context.Context, cycle ReviewCycle, userID string) (string, bool, error) {
+	records, err := c.FindReviewees(ctx, cycle, userID)
+	if err != nil || len(records) == 0 {
+		return "", false, err
+	}
+	return MostRecentReviewee(records).Reviews.URL, true, nil
 }
 
 // Reviews
@@ -227,20 +643,27 @@ type Review struct {
 	Reviewee   struct {
 		ID string `json:"id"`
 	} `json:"reviewee"`
-	Reviewer UserRef         `json:"reviewer"`
-	Question QuestionRef     `json:"question"`
-	Response *ReviewResponse `json:"response"`
+	Reviewer UserRef `json:"reviewer"`
+	// Relationship is the reviewer's relationship to the reviewee (e.g.
+	// "direct_report", "peer", "cross_functional"), when the API provides it.
+	Relationship string          `json:"relationship,omitempty"`
+	Question     QuestionRef     `json:"question"`
+	Response     *ReviewResponse `json:"response"`
+	// SubmittedAt and UpdatedAt are zero when the API omits them.
+	SubmittedAt Timestamp `json:"submittedAt"`
+	UpdatedAt   Timestamp `json:"updatedAt"`
 }
 
-type reviewListResponse struct {
-	Object       string   `json:"object"`
-	HasMore      bool     `json:"hasMore"`
-	EndingCursor any      `json:"endingCursor"`
-	Data         []Review `json:"data"`
-}
+// reviewsPageSize is the page size requested from the reviews endpoint
+// unless the caller asks for another.
+const reviewsPageSize = 100
 
-func (c *Client) ListReviewsByURL(ctx context.Context, listURL string, limit int) ([]Review, error) {
-	// Resolve and append limit
+// ListReviewsByURL fetches the reviews at listURL, pageSize per request (0
+// for the default of 100), following the response cursor; see listPages.
+// If maxTotal > 0, at most maxTotal reviews are returned and no page past
+// the one that reaches it is fetched; 0 returns all. If a page after the
+// first fails, the reviews fetched so far are returned along with the error.
+func (c *Client) ListReviewsByURL(ctx context.Context, listURL string, pageSize, maxTotal int) ([]Review, error) {
 	full, err := c.resolve(listURL)
 	if err != nil {
 		return nil, err
@@ -249,27 +672,136 @@ func (c *Client) ListReviewsByURL(ctx context.Context, listURL string, limit int
 	if err != nil {
 		return nil, err
 	}
-	q := u.Query()
-	if limit > 0 {
-		q.Set("limit", fmt.Sprintf("%d", limit))
+	if pageSize <= 0 {
+		pageSize = reviewsPageSize
+	}
+	if maxTotal > 0 && maxTotal < pageSize {
+		pageSize = maxTotal
 	}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(pageSize))
 	u.RawQuery = q.Encode()
 
-	req, err := c.newRequest(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return nil, err
+	var stop func([]Review) bool
+	if maxTotal > 0 {
+		// stop only sees pages with more to come, so reaching maxTotal here
+		// means reviews are being left out.
+		total := 0
+		stop = func(page []Review) bool {
+			total += len(page)
+			if total < maxTotal {
+				return false
+			}
+			c.warnf("results truncated; some reviews not shown (%d loaded)", maxTotal)
+			return true
+		}
 	}
-	var lr reviewListResponse
-	if err := c.doJSON(req, &lr); err != nil {
-		return nil, err
+	out, err := listPages(ctx, c, u.String(), "reviews", stop)
+	if maxTotal > 0 && len(out) > maxTotal {
+		out = out[:maxTotal]
 	}
-	return lr.Data, nil
+	return out, err
+}
+
+// cursorString converts a list response's endingCursor to a query value,
+// returning "" when absent.
+func cursorString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
 }
 
 // Single resource fetches with caching
 type Question struct {
 	ID   string `json:"id"`
 	Body string `json:"body"`
+	// Type is the question kind, e.g. "text", "rating", or "multiple_choice".
+	Type string `json:"type,omitempty"`
+	// Category is the competency or section the question belongs to, if any.
+	Category Label `json:"category,omitempty"`
+	// ScaleMin and ScaleMax bound a rating question's scale, when provided
+	// (a missing minimum reads as 0).
+	ScaleMin float64 `json:"scaleMin,omitempty"`
+	ScaleMax float64 `json:"scaleMax,omitempty"`
+	// Choices are the options of a multiple-choice question.
+	Choices []QuestionChoice `json:"choices,omitempty"`
+}
+
+// QuestionChoice is one option of a multiple-choice question. Responses
+// reference choices by ID (or, in some payloads, by label).
+type QuestionChoice struct {
+	ID     string   `json:"id"`
+	Label  string   `json:"label"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+func (qc *QuestionChoice) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		ID     string   `json:"id"`
+		Label  string   `json:"label"`
+		Text   string   `json:"text"`
+		Body   string   `json:"body"`
+		Weight *float64 `json:"weight"`
+		Value  *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	qc.ID, qc.Label, qc.Weight = raw.ID, raw.Label, raw.Weight
+	if qc.Label == "" {
+		qc.Label = raw.Text
+	}
+	if qc.Label == "" {
+		qc.Label = raw.Body
+	}
+	if qc.Weight == nil {
+		qc.Weight = raw.Value
+	}
+	return nil
+}
+
+// Choice returns the choice a response value refers to, matching by ID first
+// and then by label.
+func (q *Question) Choice(v string) (QuestionChoice, bool) {
+	for _, ch := range q.Choices {
+		if ch.ID != "" && ch.ID == v {
+			return ch, true
+		}
+	}
+	for _, ch := range q.Choices {
+		if ch.Label != "" && strings.EqualFold(ch.Label, v) {
+			return ch, true
+		}
+	}
+	return QuestionChoice{}, false
+}
+
+// Label decodes a display name given either as a plain string or as an
+// object with a name (or title) field. It encodes as a plain string.
+type Label string
+
+func (l *Label) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = Label(strings.TrimSpace(s))
+		return nil
+	}
+	var obj struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		// Unknown shapes (null, numbers) are treated as absent.
+		*l = ""
+		return nil
+	}
+	if obj.Name != "" {
+		*l = Label(strings.TrimSpace(obj.Name))
+	} else {
+		*l = Label(strings.TrimSpace(obj.Title))
+	}
+	return nil
 }
 
 var mu sync.Mutex
@@ -295,6 +827,37 @@ func (c *Client) GetUserByID(ctx context.Context, id string) (*User, error) {
 	return &u, nil
 }
 
+// Resolver looks up the reviewer and question details a report needs.
+// *Client resolves against the API; StaticResolver against exported data.
+type Resolver interface {
+	ResolveUser(ctx context.Context, ref UserRef) (*User, error)
+	GetQuestionByID(ctx context.Context, id string) (*Question, error)
+}
+
+// CachedLookups returns copies of the users and questions fetched so far.
+func (c *Client) CachedLookups() (map[string]User, map[string]Question) {
+	mu.Lock()
+	defer mu.Unlock()
+	users := make(map[string]User, len(c.userCache))
+	for id, u := range c.userCache {
+		users[id] = *u
+	}
+	questions := make(map[string]Question, len(c.questionCache))
+	for id, q := range c.questionCache {
+		questions[id] = *q
+	}
+	return users, questions
+}
+
+// ResolveUser returns the user for ref, using the embedded name/email when
+// present and falling back to a (cached) GetUserByID lookup otherwise.
+func (c *Client) ResolveUser(ctx context.Context, ref UserRef) (*User, error) {
+	if strings.TrimSpace(ref.Name) != "" {
+		return &User{ID: ref.ID, Name: ref.Name, Email: ref.Email, AvatarURL: ref.AvatarURL}, nil
+	}
+	return c.GetUserByID(ctx, ref.ID)
+}
+
 func (c *Client) GetQuestionByID(ctx context.Context, id string) (*Question, error) {
 	mu.Lock()
 	if qv, ok := c.questionCache[id]; ok {
@@ -0,0 +1,519 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client whose base URL is a test server running h.
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient("test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.base, err = url.Parse(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// recordWaits replaces retryWait for the rest of the test and returns the
+// list the requested delays are appended to.
+func recordWaits(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var mu sync.Mutex
+	waits := &[]time.Duration{}
+	prev := retryWait
+	retryWait = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { retryWait = prev })
+	return waits
+}
+
+// statusSequence answers successive requests with the given statuses (and
+// Retry-After values, when non-empty), then with a question body.
+func statusSequence(t *testing.T, statuses []int, retryAfter []string) (http.Handler, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	n := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		i := n
+		n++
+		mu.Unlock()
+		if i < len(statuses) {
+			if i < len(retryAfter) && retryAfter[i] != "" {
+				w.Header().Set("Retry-After", retryAfter[i])
+			}
+			w.WriteHeader(statuses[i])
+			return
+		}
+		w.Write([]byte(`{"id":"q1","body":"How?"}`))
+	}), &n
+}
+
+func TestDoJSONRetriesWithRetryAfter(t *testing.T) {
+	waits := recordWaits(t)
+	h, n := statusSequence(t, []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, []string{"2"})
+	c := newTestClient(t, h)
+	q, err := c.GetQuestionByID(context.Background(), "q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Body != "How?" || *n != 3 {
+		t.Errorf("got %+v after %d requests, want the question after 3", q, *n)
+	}
+	if len(*waits) != 2 {
+		t.Fatalf("waits = %v, want 2", *waits)
+	}
+	if (*waits)[0] != 2*time.Second {
+		t.Errorf("first wait = %v, want the Retry-After of 2s", (*waits)[0])
+	}
+	// The 503 had no Retry-After: the second backoff is 1s with jitter.
+	if w := (*waits)[1]; w < 500*time.Millisecond || w >= time.Second {
+		t.Errorf("second wait = %v, want within [500ms, 1s)", w)
+	}
+}
+
+func TestDoJSONDoesNotRetryClientErrors(t *testing.T) {
+	waits := recordWaits(t)
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusBadRequest} {
+		h, n := statusSequence(t, []int{status}, nil)
+		c := newTestClient(t, h)
+		_, err := c.GetQuestionByID(context.Background(), "q1")
+		var he *HTTPError
+		if !errors.As(err, &he) || he.StatusCode != status {
+			t.Errorf("status %d: err = %v, want an HTTPError with that status", status, err)
+		}
+		if *n != 1 {
+			t.Errorf("status %d: %d requests, want 1", status, *n)
+		}
+	}
+	if len(*waits) != 0 {
+		t.Errorf("waited %v for non-retryable errors", *waits)
+	}
+}
+
+func TestDoJSONGivesUpAfterRetries(t *testing.T) {
+	recordWaits(t)
+	h, n := statusSequence(t, []int{502, 502, 502, 502, 502}, nil)
+	c := newTestClient(t, h)
+	c.SetRetries(2)
+	_, err := c.GetQuestionByID(context.Background(), "q1")
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != 502 {
+		t.Errorf("err = %v, want the last 502", err)
+	}
+	if *n != 3 {
+		t.Errorf("%d requests, want 1 + 2 retries", *n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"-3", 0},
+		{"soon", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0}, // in the past
+	} {
+		if got := parseRetryAfter(tc.in); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, want about an hour", future, got)
+	}
+}
+
+// pagedList serves pages of a cursor-paginated list: page i is returned for
+// startingAfter=c<i-1> (the first page for no cursor), and every page but
+// the last reports hasMore with the next cursor. It counts the requests.
+type pagedList struct {
+	mu       sync.Mutex
+	pages    [][]string // raw JSON items per page
+	requests int
+}
+
+func (p *pagedList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests++
+	p.mu.Unlock()
+	i := 0
+	if after := r.URL.Query().Get("startingAfter"); after != "" {
+		if _, err := fmt.Sscanf(after, "c%d", &i); err != nil {
+			http.Error(w, "bad cursor", http.StatusBadRequest)
+			return
+		}
+		i++
+	}
+	if i >= len(p.pages) {
+		http.Error(w, "no such page", http.StatusNotFound)
+		return
+	}
+	more := i < len(p.pages)-1
+	fmt.Fprintf(w, `{"data":[%s],"hasMore":%t,"endingCursor":"c%d"}`, strings.Join(p.pages[i], ","), more, i)
+}
+
+func reviewee(id, userID string) string {
+	return fmt.Sprintf(`{"id":%q,"user":{"id":%q},"reviews":{"url":"/v1/reviewee/%s/reviews"}}`, id, userID, id)
+}
+
+func TestFindRevieweesReadsEveryPage(t *testing.T) {
+	list := &pagedList{pages: [][]string{
+		{reviewee("r1", "u1"), reviewee("r2", "u2")},
+		{reviewee("r3", "u3")},
+		{reviewee("r4", "u2"), reviewee("r5", "u4")},
+	}}
+	c := newTestClient(t, list)
+	cycle := ReviewCycle{ID: "cy", Reviewees: ListRef{URL: "/v1/reviewCycle/cy/reviewees"}}
+
+	records, err := c.FindReviewees(context.Background(), cycle, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, rv := range records {
+		ids = append(ids, rv.ID)
+	}
+	if !slices.Equal(ids, []string{"r2", "r4"}) {
+		t.Errorf("records = %v, want both enrollments r2 and r4", ids)
+	}
+	if list.requests != 3 {
+		t.Errorf("%d requests, want all 3 pages", list.requests)
+	}
+
+	reviewsURL, ok, err := c.FindRevieweeReviewsURL(context.Background(), cycle, "u2")
+	if err != nil || !ok || reviewsURL != "/v1/reviewee/r4/reviews" {
+		t.Errorf("FindRevieweeReviewsURL = %q, %t, %v; want the later record's URL", reviewsURL, ok, err)
+	}
+}
+
+func TestIsRevieweeStopsAtUser(t *testing.T) {
+	list := &pagedList{pages: [][]string{
+		{reviewee("r1", "u1")},
+		{reviewee("r2", "u2")},
+		{reviewee("r3", "u3")},
+	}}
+	c := newTestClient(t, list)
+	cycle := ReviewCycle{ID: "cy", Reviewees: ListRef{URL: "/v1/reviewCycle/cy/reviewees"}}
+
+	for _, tc := range []struct {
+		user     string
+		want     bool
+		requests int
+	}{
+		{"u1", true, 1},
+		{"u2", true, 2},
+		{"nobody", false, 3},
+	} {
+		list.requests = 0
+		got, err := c.IsReviewee(context.Background(), cycle, tc.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want || list.requests != tc.requests {
+			t.Errorf("IsReviewee(%s) = %t after %d requests, want %t after %d", tc.user, got, list.requests, tc.want, tc.requests)
+		}
+	}
+}
+
+func reviewItems(ids ...string) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = fmt.Sprintf(`{"id":%q}`, id)
+	}
+	return out
+}
+
+func reviewIDs(reviews []Review) []string {
+	ids := make([]string, len(reviews))
+	for i, r := range reviews {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestListReviewsByURL(t *testing.T) {
+	pages := [][]string{reviewItems("a", "b"), reviewItems("c", "d"), reviewItems("e")}
+	for _, tc := range []struct {
+		name               string
+		pageSize, maxTotal int
+		wantLimit          string
+		want               []string
+		requests           int
+		truncated          bool
+	}{
+		{"all pages", 0, 0, "100", []string{"a", "b", "c", "d", "e"}, 3, false},
+		{"page size", 2, 0, "2", []string{"a", "b", "c", "d", "e"}, 3, false},
+		{"cap within a page", 0, 3, "3", []string{"a", "b", "c"}, 2, true},
+		{"cap on a page boundary", 2, 4, "2", []string{"a", "b", "c", "d"}, 2, true},
+		{"cap above the total", 0, 10, "10", []string{"a", "b", "c", "d", "e"}, 3, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			list := &pagedList{pages: pages}
+			var limits []string
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				limits = append(limits, r.URL.Query().Get("limit"))
+				list.ServeHTTP(w, r)
+			}))
+			got, err := c.ListReviewsByURL(context.Background(), "/v1/reviewee/r1/reviews", tc.pageSize, tc.maxTotal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := reviewIDs(got); !slices.Equal(ids, tc.want) {
+				t.Errorf("reviews = %v, want %v", ids, tc.want)
+			}
+			if list.requests != tc.requests {
+				t.Errorf("%d requests, want %d", list.requests, tc.requests)
+			}
+			for _, l := range limits {
+				if l != tc.wantLimit {
+					t.Errorf("limit = %s, want %s", l, tc.wantLimit)
+				}
+			}
+			warnings := c.Warnings()
+			if truncated := len(warnings) > 0; truncated != tc.truncated {
+				t.Errorf("warnings = %q, want truncated=%t", warnings, tc.truncated)
+			}
+		})
+	}
+}
+
+func TestListReviewsByURLKeepsPagesBeforeAnError(t *testing.T) {
+	list := &pagedList{pages: [][]string{reviewItems("a", "b"), reviewItems("c"), reviewItems("d")}}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("startingAfter") == "c1" {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		list.ServeHTTP(w, r)
+	}))
+	got, err := c.ListReviewsByURL(context.Background(), "/v1/reviewee/r1/reviews", 0, 0)
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want the third page's 404", err)
+	}
+	if !strings.Contains(err.Error(), "reviews page 3 (after 3 reviews)") {
+		t.Errorf("err = %q, want it to name the failed page", err)
+	}
+	if ids := reviewIDs(got); !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Errorf("reviews = %v, want the first two pages", ids)
+	}
+}
+
+func user(id string) string {
+	return fmt.Sprintf(`{"id":%q,"name":"User %s"}`, id, id)
+}
+
+func TestListUsersByURLFollowsCursor(t *testing.T) {
+	list := &pagedList{pages: [][]string{{user("1"), user("2")}, {user("3")}, {user("4"), user("5")}}}
+	var cursors []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "50" {
+			t.Errorf("query %q lost the list URL's own parameters", r.URL.RawQuery)
+		}
+		cursors = append(cursors, r.URL.Query().Get("startingAfter"))
+		list.ServeHTTP(w, r)
+	}))
+	// List URLs from the API are absolute and may carry their own query.
+	listURL := strings.TrimSuffix(c.base.String(), "/") + "/v1/user/m1/directReports?limit=50"
+	users, err := c.ListUsersByURL(context.Background(), listURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	if !slices.Equal(ids, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("users = %v, want every page in order", ids)
+	}
+	// The last page says hasMore is false, so no fourth request is made.
+	if !slices.Equal(cursors, []string{"", "c0", "c1"}) {
+		t.Errorf("cursors = %q, want one request per page", cursors)
+	}
+	if w := c.Warnings(); len(w) != 0 {
+		t.Errorf("unexpected warnings %q", w)
+	}
+}
+
+func TestListPagesStopsOnBadCursor(t *testing.T) {
+	for _, tc := range []struct {
+		name, second string
+		requests     int
+	}{
+		// hasMore with no cursor would refetch the first page forever.
+		{"missing cursor", `{"data":[{"id":"2"}],"hasMore":true}`, 2},
+		{"repeated cursor", `{"data":[{"id":"2"}],"hasMore":true,"endingCursor":"x"}`, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := 0
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n++
+				if r.URL.Query().Get("startingAfter") == "" {
+					fmt.Fprint(w, `{"data":[{"id":"1"}],"hasMore":true,"endingCursor":"x"}`)
+					return
+				}
+				fmt.Fprint(w, tc.second)
+			}))
+			users, err := listPages[User](context.Background(), c, "/v1/users", "users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || n != tc.requests {
+				t.Errorf("got %d users after %d requests, want 2 after %d", len(users), n, tc.requests)
+			}
+			if w := c.Warnings(); len(w) != 1 || !strings.Contains(w[0], "results truncated; some users not shown (2 loaded)") {
+				t.Errorf("warnings = %q, want one truncation warning", w)
+			}
+		})
+	}
+}
+
+func TestFindRevieweeReviewsURL(t *testing.T) {
+	recordWaits(t)
+	older := `{"id":"r2","user":{"id":"u2"},"reviews":{"url":"/v1/reviewee/r2/reviews"},"updatedAt":"2024-06-01T00:00:00Z"}`
+	newer := `{"id":"r3","user":{"id":"u2"},"reviews":{"url":"/v1/reviewee/r3/reviews"},"updatedAt":"2024-09-01T00:00:00Z"}`
+	pages := [][]string{{reviewee("r1", "u1"), newer}, {older}}
+	cycle := ReviewCycle{ID: "cy", Reviewees: ListRef{URL: "/v1/reviewCycle/cy/reviewees"}}
+	for _, tc := range []struct {
+		name, user string
+		want       string
+		wantOK     bool
+	}{
+		{"single record", "u1", "/v1/reviewee/r1/reviews", true},
+		{"most recently updated record", "u2", "/v1/reviewee/r3/reviews", true},
+		{"not a reviewee", "u9", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, &pagedList{pages: pages})
+			got, ok, err := c.FindRevieweeReviewsURL(context.Background(), cycle, tc.user)
+			if err != nil || ok != tc.wantOK || got != tc.want {
+				t.Errorf("got %q, %t, %v; want %q, %t", got, ok, err, tc.want, tc.wantOK)
+			}
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-key" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		_, ok, err := c.FindRevieweeReviewsURL(context.Background(), cycle, "u1")
+		if !errors.Is(err, ErrUnauthorized) || ok {
+			t.Errorf("got %t, %v; want ErrUnauthorized", ok, err)
+		}
+	})
+}
+
+func TestAuthHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name, key, header, template string
+		wantHeader, wantValue       string
+	}{
+		{"default bearer", "abc", "", "", "Authorization", "Bearer abc"},
+		{"preformatted key", "Token abc", "", "", "Authorization", "Token abc"},
+		{"custom header", "abc", "X-Api-Key", "{key}", "X-Api-Key", "abc"},
+		{"custom header keeps bearer default", "abc", "X-Lattice-Auth", "", "X-Lattice-Auth", "Bearer abc"},
+		{"template", "abc", "", "ApiKey key={key}", "Authorization", "ApiKey key=abc"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got http.Header
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				w.Write([]byte(`{"id":"me"}`))
+			}))
+			defer srv.Close()
+			c, err := NewClientFromConfig(EffectiveConfig{FileConfig: FileConfig{APIKey: tc.key, AuthHeader: tc.header, AuthValueTemplate: tc.template}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.base, _ = url.Parse(srv.URL + "/")
+			if _, err := c.GetMe(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if v := got.Get(tc.wantHeader); v != tc.wantValue {
+				t.Errorf("%s = %q, want %q", tc.wantHeader, v, tc.wantValue)
+			}
+			if tc.wantHeader != "Authorization" && got.Get("Authorization") != "" {
+				t.Errorf("Authorization sent alongside %s", tc.wantHeader)
+			}
+		})
+	}
+}
+
+func TestSetAuthRejects(t *testing.T) {
+	c, err := NewClient("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ header, template string }{
+		{"X Api Key", ""},
+		{"X-Api-Key:", ""},
+		{"", "Bearer"},
+		{"", "Bearer {key}\r\nX-Other: 1"},
+	} {
+		if err := c.SetAuth(tc.header, tc.template); err == nil {
+			t.Errorf("SetAuth(%q, %q) succeeded", tc.header, tc.template)
+		}
+	}
+}
+
+func TestListResponseFieldNames(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		wantMore   bool
+		wantCursor string
+	}{
+		{"lattice", `{"object":"list","data":[{"id":"a"},{"id":"b"}],"hasMore":true,"endingCursor":"c1"}`, true, "c1"},
+		{"snake case", `{"data":[{"id":"a"},{"id":"b"}],"has_more":true,"ending_cursor":"c1"}`, true, "c1"},
+		{"items and next cursor", `{"items":[{"id":"a"},{"id":"b"}],"hasNextPage":true,"nextCursor":"c1"}`, true, "c1"},
+		{"results", `{"results":[{"id":"a"},{"id":"b"}],"has_next_page":true,"next_cursor":"c1"}`, true, "c1"},
+		{"records and cursor", `{"records":[{"id":"a"},{"id":"b"}],"cursor":"c1"}`, false, "c1"},
+		{"numeric cursor", `{"data":[{"id":"a"},{"id":"b"}],"hasMore":true,"endingCursor":42}`, true, "42"},
+		{"null falls through", `{"data":null,"items":[{"id":"a"},{"id":"b"}],"endingCursor":null,"next_cursor":"c1"}`, false, "c1"},
+		{"last page", `{"data":[{"id":"a"},{"id":"b"}],"hasMore":false,"endingCursor":null}`, false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var lr listResponse[User]
+			if err := json.Unmarshal([]byte(tc.body), &lr); err != nil {
+				t.Fatal(err)
+			}
+			if len(lr.Data) != 2 || lr.Data[0].ID != "a" || lr.Data[1].ID != "b" {
+				t.Errorf("data = %+v, want users a and b", lr.Data)
+			}
+			if lr.HasMore != tc.wantMore || cursorString(lr.EndingCursor) != tc.wantCursor {
+				t.Errorf("hasMore = %t, cursor = %q; want %t, %q", lr.HasMore, cursorString(lr.EndingCursor), tc.wantMore, tc.wantCursor)
+			}
+		})
+	}
+
+	var lr listResponse[User]
+	if err := json.Unmarshal([]byte(`{"data":{"id":"a"}}`), &lr); err == nil {
+		t.Error("a non-array data field decoded without error")
+	}
+}
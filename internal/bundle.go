@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// BundleManifestName is the manifest's file name inside a bundle.
+const BundleManifestName = "manifest.json"
+
+// BundleFile is a local file to add to a bundle under Name.
+type BundleFile struct {
+	Name string
+	Path string
+}
+
+// BundleManifest describes a bundle's contents; it is stored as manifest.json.
+type BundleManifest struct {
+	GeneratedAt string `json:"generatedAt"`
+	TessVersion string `json:"tessVersion"`
+	User        string `json:"user"`
+	Cycle       string `json:"cycle"`
+	// Sections lists the report sections included ("peer", "self").
+	Sections []string `json:"sections,omitempty"`
+	Files    []string `json:"files"`
+}
+
+// WriteBundle writes a zip at path holding files, sorted by name, followed by
+// manifest.json. Every entry is stamped with the manifest's generation time,
+// so the same inputs always produce the same archive layout.
+func WriteBundle(path string, m BundleManifest, files []BundleFile) error {
+	files = append([]BundleFile(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	if m.GeneratedAt == "" {
+		m.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if m.TessVersion == "" {
+		m.TessVersion = Version
+	}
+	m.Files = m.Files[:0]
+	for _, f := range files {
+		if f.Name == BundleManifestName {
+			return fmt.Errorf("bundle file name %q is reserved", f.Name)
+		}
+		m.Files = append(m.Files, f.Name)
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	modified, _ := time.Parse(time.RFC3339, m.GeneratedAt)
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	add := func(name string, r io.Reader) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		return err
+	}
+	err = func() error {
+		for _, f := range files {
+			src, err := os.Open(f.Path)
+			if err != nil {
+				return fmt.Errorf("bundle %s: %w", f.Name, err)
+			}
+			err = add(f.Name, src)
+			src.Close()
+			if err != nil {
+				return fmt.Errorf("bundle %s: %w", f.Name, err)
+			}
+		}
+		return add(BundleManifestName, bytes.NewReader(append(manifest, '\n')))
+	}()
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
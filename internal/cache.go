@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached cycle membership stays valid.
+const DefaultCacheTTL = 24 * time.Hour
+
+// DefaultCacheDir returns ~/.tess/cache, or $XDG_CACHE_HOME/tess when the
+// home directory can't be determined. Callers run without a cache on error.
+func DefaultCacheDir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".tess", "cache"), nil
+	}
+	if dir := xdgDir("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "tess"), nil
+	}
+	return "", errors.New("no cache directory: HOME and XDG_CACHE_HOME are not set")
+}
+
+type membershipEntry struct {
+	Member     bool      `json:"member"`
+	ReviewsURL string    `json:"reviewsUrl,omitempty"`
+	FetchedAt  time.Time `json:"fetchedAt"`
+}
+
+type membershipFile struct {
+	// CyclesHash fingerprints the cycle list; any change invalidates the cache.
+	CyclesHash string `json:"cyclesHash"`
+	// Entries maps cycle ID -> user ID -> membership.
+	Entries map[string]map[string]membershipEntry `json:"entries"`
+}
+
+// MembershipCache remembers which users are reviewees in which cycles, so
+// repeated runs can skip the per-cycle reviewee fetches. It is safe for
+// concurrent use.
+type MembershipCache struct {
+	mu    sync.Mutex
+	path  string
+	ttl   time.Duration
+	data  membershipFile
+	dirty bool
+}
+
+// LoadMembershipCache opens the membership cache in dir. If the stored cycle
+// list differs from cycles, the cache starts empty. Read errors are treated as
+// an empty cache.
+func LoadMembershipCache(dir string, ttl time.Duration, cycles []ReviewCycle) *MembershipCache {
+	m := &MembershipCache{path: filepath.Join(dir, "membership.json"), ttl: ttl}
+	hash := cyclesHash(cycles)
+	if b, err := os.ReadFile(m.path); err == nil {
+		var f membershipFile
+		if json.Unmarshal(b, &f) == nil && f.CyclesHash == hash {
+			m.data = f
+		}
+	}
+	m.data.CyclesHash = hash
+	if m.data.Entries == nil {
+		m.data.Entries = make(map[string]map[string]membershipEntry)
+	}
+	return m
+}
+
+// Lookup returns a fresh cached result for userID in cycleID. ok is false when
+// there is no entry or it is older than the TTL.
+func (m *MembershipCache) Lookup(cycleID, userID string) (reviewsURL string, member, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.data.Entries[cycleID][userID]
+	if !found || time.Since(e.FetchedAt) > m.ttl {
+		return "", false, false
+	}
+	return e.ReviewsURL, e.Member, true
+}
+
+// Store records whether userID is a reviewee in cycleID.
+func (m *MembershipCache) Store(cycleID, userID, reviewsURL string, member bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data.Entries[cycleID] == nil {
+		m.data.Entries[cycleID] = make(map[string]membershipEntry)
+	}
+	m.data.Entries[cycleID][userID] = membershipEntry{Member: member, ReviewsURL: reviewsURL, FetchedAt: time.Now()}
+	m.dirty = true
+}
+
+// Save writes the cache to disk if anything changed.
+func (m *MembershipCache) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(m.data)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.path, b, 0o600); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+// cyclesHash fingerprints the set of cycle IDs and reviewee URLs.
+func cyclesHash(cycles []ReviewCycle) string {
+	keys := make([]string, 0, len(cycles))
+	for _, c := range cycles {
+		keys = append(keys, c.ID+"|"+c.Reviewees.URL)
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+type listsFile struct {
+	Me            User          `json:"me"`
+	DirectReports []User        `json:"directReports"`
+	Cycles        []ReviewCycle `json:"cycles"`
+	FetchedAt     time.Time     `json:"fetchedAt"`
+}
+
+// ListCache remembers the current user, their direct reports, and the
+// review cycle list, as saved by `tess prewarm`, so the interactive flow can
+// skip those fetches too.
+type ListCache struct {
+	path string
+	ttl  time.Duration
+	data listsFile
+}
+
+// LoadListCache opens the list cache in dir. Read errors are treated as an
+// empty cache.
+func LoadListCache(dir string, ttl time.Duration) *ListCache {
+	l := &ListCache{path: filepath.Join(dir, "lists.json"), ttl: ttl}
+	if b, err := os.ReadFile(l.path); err == nil {
+		var f listsFile
+		if json.Unmarshal(b, &f) == nil {
+			l.data = f
+		}
+	}
+	return l
+}
+
+// Lookup returns the cached lists. ok is false when nothing is cached, the
+// lists are older than the TTL, or l is nil.
+func (l *ListCache) Lookup() (me User, reports []User, cycles []ReviewCycle, ok bool) {
+	if l == nil || l.data.FetchedAt.IsZero() || time.Since(l.data.FetchedAt) > l.ttl {
+		return User{}, nil, nil, false
+	}
+	return l.data.Me, l.data.DirectReports, l.data.Cycles, true
+}
+
+// Store replaces the cached lists.
+func (l *ListCache) Store(me User, reports []User, cycles []ReviewCycle) {
+	l.data = listsFile{Me: me, DirectReports: reports, Cycles: cycles, FetchedAt: time.Now()}
+}
+
+// Save writes the cache to disk.
+func (l *ListCache) Save() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(l.data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, b, 0o600)
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, _, ok := LoadListCache(dir, time.Hour).Lookup(); ok {
+		t.Fatal("empty cache reported a hit")
+	}
+	var nilCache *ListCache
+	if _, _, _, ok := nilCache.Lookup(); ok {
+		t.Fatal("nil cache reported a hit")
+	}
+
+	me := User{ID: "m1", Name: "Manager", DirectReports: ListRef{URL: "/v1/user/m1/directReports"}}
+	reports := []User{{ID: "u1", Name: "Ada", Email: "ada@example.com"}, {ID: "u2", Name: "Grace"}}
+	cycles := []ReviewCycle{{
+		ID: "c1", Name: "Q4", Reviewees: ListRef{URL: "/v1/reviewCycle/c1/reviewees"},
+		LaunchedAt: Timestamp{Time: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	l := LoadListCache(dir, time.Hour)
+	l.Store(me, reports, cycles)
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	gotMe, gotReports, gotCycles, ok := LoadListCache(dir, time.Hour).Lookup()
+	if !ok {
+		t.Fatal("saved lists not found")
+	}
+	if !reflect.DeepEqual(gotMe, me) || !reflect.DeepEqual(gotReports, reports) {
+		t.Errorf("got %+v %+v, want %+v %+v", gotMe, gotReports, me, reports)
+	}
+	if len(gotCycles) != 1 || gotCycles[0].ID != "c1" || gotCycles[0].Reviewees != cycles[0].Reviewees || !gotCycles[0].Date().Equal(cycles[0].Date()) {
+		t.Errorf("cycles = %+v, want %+v", gotCycles, cycles)
+	}
+	if _, _, _, ok := LoadListCache(dir, 0).Lookup(); ok {
+		t.Error("expired lists reported a hit")
+	}
+}
+
+func TestMembershipCacheInvalidatedByCycles(t *testing.T) {
+	dir := t.TempDir()
+	cycles := []ReviewCycle{{ID: "c1", Reviewees: ListRef{URL: "/r/c1"}}}
+	m := LoadMembershipCache(dir, time.Hour, cycles)
+	m.Store("c1", "u1", "/reviews/u1", true)
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if url, member, ok := LoadMembershipCache(dir, time.Hour, cycles).Lookup("c1", "u1"); !ok || !member || url != "/reviews/u1" {
+		t.Errorf("Lookup = %q, %t, %t; want the stored entry", url, member, ok)
+	}
+	changed := append(cycles, ReviewCycle{ID: "c2", Reviewees: ListRef{URL: "/r/c2"}})
+	if _, _, ok := LoadMembershipCache(dir, time.Hour, changed).Lookup("c1", "u1"); ok {
+		t.Error("entry survived a change to the cycle list")
+	}
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// capabilityProbeTimeout bounds each external command run by
+// DetectCapabilities, so a wedged tool can't stall a wrapper.
+const capabilityProbeTimeout = 3 * time.Second
+
+// Capabilities describes what this install of Tess can produce, for tools
+// and UIs built on top of it (`tess capabilities --json`).
+type Capabilities struct {
+	Version string `json:"version"`
+	// Formats lists every output format with whether the installed tools
+	// can produce it.
+	Formats []FormatCapability `json:"formats"`
+	// PDFEngines are the supported PDF engines found on PATH, in
+	// preference order.
+	PDFEngines []string   `json:"pdfEngines"`
+	Pandoc     ToolStatus `json:"pandoc"`
+	Rclone     ToolStatus `json:"rclone"`
+	// Remotes are the remotes in the rclone config; RemotesError says why
+	// they couldn't be listed (e.g. an encrypted config).
+	Remotes      []string `json:"remotes"`
+	RemotesError string   `json:"remotesError,omitempty"`
+}
+
+// FormatCapability is one output format and whether it is available.
+type FormatCapability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	// Reason explains an unavailable format, with install guidance.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ToolStatus reports whether an external tool is on PATH, and its version.
+type ToolStatus struct {
+	Found   bool   `json:"found"`
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// DetectCapabilities probes the installed tools. It is best-effort: each
+// probe is bounded by capabilityProbeTimeout, and failures show up as
+// missing tools or an unavailable format rather than an error.
+func DetectCapabilities(ctx context.Context) Capabilities {
+	caps := Capabilities{
+		Version:    Version,
+		Formats:    []FormatCapability{{Name: "md", Available: true}},
+		PDFEngines: AvailablePDFEngines(),
+		Pandoc:     toolStatus(ctx, "pandoc"),
+		Rclone:     toolStatus(ctx, "rclone"),
+		Remotes:    []string{},
+	}
+	if caps.PDFEngines == nil {
+		caps.PDFEngines = []string{}
+	}
+	for _, format := range []string{"docx", "html", "pdf"} {
+		fc := FormatCapability{Name: format, Available: true}
+		if err := CheckFormatTools(format); err != nil {
+			fc.Available, fc.Reason = false, err.Error()
+		}
+		caps.Formats = append(caps.Formats, fc)
+	}
+	if caps.Rclone.Found {
+		probeCtx, cancel := context.WithTimeout(ctx, capabilityProbeTimeout)
+		defer cancel()
+		if remotes, err := ListRemotes(probeCtx); err != nil {
+			caps.RemotesError = err.Error()
+		} else {
+			caps.Remotes = remotes
+		}
+	}
+	return caps
+}
+
+// toolStatus locates name on PATH and reads the first line of its
+// `--version` output (`version` for rclone), trimmed of the tool name.
+func toolStatus(ctx context.Context, name string) ToolStatus {
+	st := ToolStatus{Path: toolPath(name)}
+	if st.Path == "" {
+		return st
+	}
+	st.Found = true
+	probeCtx, cancel := context.WithTimeout(ctx, capabilityProbeTimeout)
+	defer cancel()
+	arg := "--version"
+	if name == "rclone" {
+		arg = "version"
+	}
+	out, err := runner.Output(probeCtx, name, arg)
+	if err != nil {
+		return st
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	st.Version = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(first), name))
+	return st
+}
+
+// WriteCapabilities prints caps as indented JSON, or as a short
+// human-readable list.
+func WriteCapabilities(w io.Writer, caps Capabilities, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(caps)
+	}
+	fmt.Fprintf(w, "Tess %s\n\n", caps.Version)
+	for _, f := range caps.Formats {
+		if f.Available {
+			fmt.Fprintf(w, "%s format %s\n", Glyphs.OK, f.Name)
+		} else {
+			fmt.Fprintf(w, "%s format %s: %s\n", Glyphs.Fail, f.Name, f.Reason)
+		}
+	}
+	for _, t := range []struct {
+		name string
+		st   ToolStatus
+	}{{"pandoc", caps.Pandoc}, {"rclone", caps.Rclone}} {
+		if !t.st.Found {
+			fmt.Fprintf(w, "%s %s not found\n", Glyphs.Fail, t.name)
+			continue
+		}
+		label := t.name
+		if t.st.Version != "" {
+			label += " " + t.st.Version
+		}
+		fmt.Fprintf(w, "%s %s (%s)\n", Glyphs.OK, label, t.st.Path)
+	}
+	if len(caps.PDFEngines) > 0 {
+		fmt.Fprintf(w, "%s PDF engines: %s\n", Glyphs.Info, strings.Join(caps.PDFEngines, ", "))
+	}
+	switch {
+	case caps.RemotesError != "":
+		fmt.Fprintf(w, "%s rclone remotes: %s\n", Glyphs.Warn, caps.RemotesError)
+	case len(caps.Remotes) > 0:
+		fmt.Fprintf(w, "%s rclone remotes: %s\n", Glyphs.Info, strings.Join(caps.Remotes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Default per-step limits for external tools; zero disables the limit.
+const (
+	DefaultPandocTimeout = 5 * time.Minute
+	DefaultRcloneTimeout = 5 * time.Minute
+)
+
+// StepTimeoutError reports a subprocess that was killed for exceeding its
+// per-step timeout.
+type StepTimeoutError struct {
+	Tool    string
+	Timeout time.Duration
+	// Flag is the option that controls the timeout, for the hint.
+	Flag string
+}
+
+func (e *StepTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s and was killed (raise %s if it is just slow)", e.Tool, e.Timeout, e.Flag)
+}
+
+// commandRunner executes non-interactive external tools. execRunner shells
+// out; tests can swap the package-level runner for one that records the
+// command lines instead, so argument assembly is checkable without pandoc or
+// rclone installed.
+type commandRunner interface {
+	// CombinedOutput runs name with args and returns stdout and stderr together.
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Output runs name with args and returns stdout only.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// execRunner runs commands with os/exec. Processes are killed when ctx ends.
+type execRunner struct{}
+
+func (execRunner) command(ctx context.Context, name string, args []string) *exec.Cmd {
+	logCommand(name, args)
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Don't wait forever on grandchildren that keep the output pipe open.
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+func (r execRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.command(ctx, name, args).CombinedOutput()
+}
+
+func (r execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.command(ctx, name, args).Output()
+}
+
+var commandLog io.Writer
+
+// PrintCommands makes every pandoc and rclone invocation print its command
+// line (shell-quoted, secrets redacted) to w before it runs; nil turns it off.
+func PrintCommands(w io.Writer) {
+	commandLog = w
+}
+
+func logCommand(name string, args []string) {
+	if commandLog != nil {
+		fmt.Fprintf(commandLog, "+ %s\n", FormatCommand(name, args))
+	}
+}
+
+// sensitiveArgWords mark an option whose value must not be printed.
+var sensitiveArgWords = []string{"secret", "token", "password", "pass", "key", "credential"}
+
+func sensitiveOption(opt string) bool {
+	opt = strings.ToLower(strings.TrimLeft(opt, "-"))
+	for _, w := range sensitiveArgWords {
+		if strings.Contains(opt, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatCommand renders name and args as a copy-pasteable shell command. The
+// values of options that look secret (--drive-client-secret=..., --password
+// x, ...) are replaced with REDACTED; true/false switches are left alone.
+func FormatCommand(name string, args []string) string {
+	parts := []string{shellQuote(name)}
+	redactNext := false
+	for _, a := range args {
+		switch {
+		case redactNext:
+			a, redactNext = "REDACTED", false
+		case strings.HasPrefix(a, "-"):
+			if opt, v, ok := strings.Cut(a, "="); ok {
+				if sensitiveOption(opt) && v != "true" && v != "false" {
+					a = opt + "=REDACTED"
+				}
+			} else {
+				redactNext = sensitiveOption(a)
+			}
+		}
+		parts = append(parts, shellQuote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote single-quotes s when it contains anything a POSIX shell would
+// interpret.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=./:,+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runner executes every non-interactive pandoc and rclone call.
+var runner commandRunner = execRunner{}
+
+// runStep runs name with args through runner under a child context limited
+// to timeout (zero means only ctx applies) and returns its combined output.
+// If the step's own deadline fires, the process is killed and a
+// *StepTimeoutError is returned instead of the bare exec error.
+func runStep(ctx context.Context, timeout time.Duration, flag, name string, args ...string) ([]byte, error) {
+	stepCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	out, err := runner.CombinedOutput(stepCtx, name, args...)
+	if err != nil && timeout > 0 && ctx.Err() == nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		tool := name
+		if len(args) > 0 && name == "rclone" {
+			tool += " " + args[0]
+		}
+		return out, &StepTimeoutError{Tool: tool, Timeout: timeout, Flag: flag}
+	}
+	return out, err
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner records every command instead of running it. reply, if set,
+// supplies each command's output and error.
+type fakeRunner struct {
+	mu    sync.Mutex
+	calls [][]string // name followed by its args
+	reply func(name string, args []string) ([]byte, error)
+}
+
+func (f *fakeRunner) run(name string, args []string) ([]byte, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, append([]string{name}, args...))
+	f.mu.Unlock()
+	if f.reply == nil {
+		return nil, nil
+	}
+	return f.reply(name, args)
+}
+
+func (f *fakeRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	return f.run(name, args)
+}
+
+func (f *fakeRunner) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	return f.run(name, args)
+}
+
+// useFakeRunner swaps the package runner for a fakeRunner for the rest of
+// the test, and resets the rclone options so no earlier setup leaks in.
+func useFakeRunner(t *testing.T, reply func(name string, args []string) ([]byte, error)) *fakeRunner {
+	t.Helper()
+	f := &fakeRunner{reply: reply}
+	prevRunner, prevOpts := runner, rcloneOpts
+	runner = f
+	ConfigureRclone(RcloneOptions{})
+	t.Cleanup(func() {
+		runner = prevRunner
+		ConfigureRclone(prevOpts)
+	})
+	return f
+}
+
+// fakeTools puts empty executables with the given names first on PATH, so
+// exec.LookPath finds them. They are never run: the fake runner stands in.
+func fakeTools(t *testing.T, names ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestConvertMarkdownToDOCXCommand(t *testing.T) {
+	fakeTools(t, "pandoc")
+	f := useFakeRunner(t, nil)
+	opts := PandocOptions{Flavor: "markdown", Vars: []string{"lang=de"}, LuaFilters: []string{"f.lua"}}
+	if err := ConvertMarkdownToDOCX(context.Background(), "in.md", "out.docx", opts); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"pandoc", "-f", "markdown", "-t", "docx", "-o", "out.docx", "in.md", "-V", "lang=de", "--lua-filter", "f.lua"}}
+	if !slices.EqualFunc(f.calls, want, slices.Equal) {
+		t.Errorf("calls = %q, want %q", f.calls, want)
+	}
+}
+
+func TestConvertMarkdownToPDFCommand(t *testing.T) {
+	fakeTools(t, "pandoc", "xelatex")
+	t.Setenv("TESS_PDF_SANS_FONT", "Test Sans")
+	var header string
+	f := useFakeRunner(t, func(name string, args []string) ([]byte, error) {
+		// The header is removed once pandoc returns, so read it now.
+		if i := slices.Index(args, "-H"); i >= 0 {
+			b, err := os.ReadFile(args[i+1])
+			if err != nil {
+				t.Errorf("header file: %v", err)
+			}
+			header = string(b)
+		}
+		return nil, nil
+	})
+	if err := ConvertMarkdownToPDFWithEngine(context.Background(), "in.md", "out.pdf", "xelatex", PandocOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 1 {
+		t.Fatalf("got %d commands, want 1: %q", len(f.calls), f.calls)
+	}
+	call := f.calls[0]
+	wantPrefix := []string{"pandoc", "-f", "gfm", "-t", "pdf", "-o", "out.pdf", "in.md", "--pdf-engine=xelatex", "-V", "mainfont=Test Sans", "-V", "sansfont=Test Sans", "-V", "familydefault=sf", "-H"}
+	if len(call) != len(wantPrefix)+1 || !slices.Equal(call[:len(wantPrefix)], wantPrefix) {
+		t.Errorf("command = %q, want %q followed by the header path", call, wantPrefix)
+	}
+	if !strings.Contains(header, `\setmainfont{Test Sans}`) {
+		t.Errorf("header = %q, want it to set the main font", header)
+	}
+	if _, err := os.Stat(call[len(call)-1]); !os.IsNotExist(err) {
+		t.Errorf("header file %s still exists after conversion", call[len(call)-1])
+	}
+}
+
+func TestConvertMarkdownToPDFFallsBackToAvailableEngine(t *testing.T) {
+	fakeTools(t, "pandoc", "wkhtmltopdf")
+	f := useFakeRunner(t, nil)
+	if err := ConvertMarkdownToPDFWithEngine(context.Background(), "in.md", "out.pdf", "tectonic", PandocOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 1 || !slices.Contains(f.calls[0], "--pdf-engine=wkhtmltopdf") || !slices.Contains(f.calls[0], "--css") {
+		t.Errorf("calls = %q, want one wkhtmltopdf run with a CSS file", f.calls)
+	}
+}
+
+func TestConvertMarkdownToPDFWithoutEngine(t *testing.T) {
+	fakeTools(t, "pandoc")
+	f := useFakeRunner(t, nil)
+	err := ConvertMarkdownToPDFWithEngine(context.Background(), "in.md", "out.pdf", "", PandocOptions{})
+	if err != ErrNoPDFEngine {
+		t.Errorf("err = %v, want ErrNoPDFEngine", err)
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("pandoc ran without an engine: %q", f.calls)
+	}
+}
+
+func TestImportAsGoogleDocCommands(t *testing.T) {
+	fakeTools(t, "rclone")
+	f := useFakeRunner(t, func(name string, args []string) ([]byte, error) {
+		if args[0] == "link" {
+			return []byte("https://docs.example/d/1\n"), nil
+		}
+		return nil, nil
+	})
+	link, err := ImportAsGoogleDoc(context.Background(), "drive", "F1", "/tmp/Report.docx", "Peer & Self Reviews", "docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "https://docs.example/d/1" {
+		t.Errorf("link = %q", link)
+	}
+	want := [][]string{
+		{"rclone", "copyto", "/tmp/Report.docx", "drive:Peer & Self Reviews.docx", "--drive-root-folder-id=F1", "--drive-import-formats", "docx", "--ask-password=false"},
+		{"rclone", "link", "drive:Peer & Self Reviews.docx", "--drive-root-folder-id=F1", "--ask-password=false"},
+	}
+	if !slices.EqualFunc(f.calls, want, slices.Equal) {
+		t.Errorf("calls =\n%q\nwant\n%q", f.calls, want)
+	}
+}
+
+func TestCopyToAndLinkGlobalArgs(t *testing.T) {
+	fakeTools(t, "rclone")
+	f := useFakeRunner(t, func(name string, args []string) ([]byte, error) {
+		return []byte("https://x\n"), nil
+	})
+	ConfigureRclone(RcloneOptions{SharedDriveID: "TD", ExtraArgs: []string{"--fast-list"}})
+	if _, err := CopyToAndLink(context.Background(), "drive", "", "a.pdf", "a.pdf", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rclone", "copyto", "a.pdf", "drive:a.pdf", "--ask-password=false", "--drive-team-drive=TD", "--fast-list"}
+	if len(f.calls) == 0 || !slices.Equal(f.calls[0], want) {
+		t.Errorf("first call = %q, want %q", f.calls, want)
+	}
+}
+
+func TestFormatCommandRedactsSecrets(t *testing.T) {
+	got := FormatCommand("rclone", []string{"config", "create", "--drive-client-secret=abc", "--password", "hunter2", "--drive-use-trash=false", "name with space"})
+	want := "rclone config create --drive-client-secret=REDACTED --password REDACTED --drive-use-trash=false 'name with space'"
+	if got != want {
+		t.Errorf("FormatCommand = %q, want %q", got, want)
+	}
+}
@@ -9,26 +9,195 @@ import (
 	"strings"
 )
 
+// ProjectConfigName is the file name of a project-local config, discovered by
+// walking up from the working directory.
+const ProjectConfigName = ".tess.toml"
+
+// Default template file IDs used by --copy-templates.
+const (
+	DefaultTemplateHubID    = "1HU2Jm_JLaLOLPR6V6HjPI4VzwzZRw_OCOvsT3rC_8G0"
+	DefaultTemplateCoverID  = "1vX9gElaEXkQYReZTEb1151x1JnYDSw64eObiWjS7Sp4"
+	DefaultTemplateReviewID = "1OLd7jgwsoKSFiTsiWtOjw9k_c9BfNhx0XRFdMYDaLP0"
+)
+
 // FileConfig represents the user configuration stored in TOML.
 type FileConfig struct {
-	APIKey           string
-	RcloneRemote     string
-	TemplateHubID    string
-	TemplateCoverID  string
-	TemplateReviewID string
+	APIKey             string
+	APIKeyFile         string
+	RcloneRemote       string
+	RcloneFolderID     string
+	UploadFormat       string
+	PDFEngine          string
+	MarkdownFlavor     string
+	RcloneExtraArgs    string
+	SharedDriveID      string
+	ServiceAccountFile string
+	TemplateHubID      string
+	TemplateCoverID    string
+	TemplateReviewID   string
+	TmpDir             string
+	AuthHeader         string
+	AuthValueTemplate  string
+	ReviewWeights      string
+	Uploader           string
+	DriveTokenFile     string
+	APIRetries         string
+	// TemplateOverrides maps a reviewee user ID or email to template IDs
+	// used instead of the global ones, from [templates."<id-or-email>"] sections.
+	TemplateOverrides map[string]TemplateSet
+	// Presets maps a name to saved report selections, from [presets.<name>]
+	// sections; --preset loads one.
+	Presets map[string]Preset
+}
+
+// TemplateSet is a group of template file IDs; empty fields fall back to the
+// global template IDs.
+type TemplateSet struct {
+	HubID    string
+	CoverID  string
+	ReviewID string
+}
+
+// templateSetKeys maps keys inside a [templates."..."] section to TemplateSet fields.
+var templateSetKeys = map[string]func(*TemplateSet) *string{
+	"hub_id":    func(t *TemplateSet) *string { return &t.HubID },
+	"cover_id":  func(t *TemplateSet) *string { return &t.CoverID },
+	"review_id": func(t *TemplateSet) *string { return &t.ReviewID },
+}
+
+// Preset is a saved set of report selections. Empty fields leave the
+// setting to the other sources.
+type Preset struct {
+	UserID         string
+	CycleID        string
+	UploadFormat   string
+	RcloneFolderID string
+}
+
+// presetKeys maps keys inside a [presets.<name>] section to Preset fields,
+// in the order they are written. upload_format and rclone_folder_id share
+// their names with the top-level settings they override.
+var presetKeys = []struct {
+	Name  string
+	field func(*Preset) *string
+}{
+	{"user_id", func(p *Preset) *string { return &p.UserID }},
+	{"cycle_id", func(p *Preset) *string { return &p.CycleID }},
+	{"upload_format", func(p *Preset) *string { return &p.UploadFormat }},
+	{"rclone_folder_id", func(p *Preset) *string { return &p.RcloneFolderID }},
+}
+
+// presetField returns the Preset field for a key in a presets section.
+func presetField(key string) (func(*Preset) *string, bool) {
+	for _, k := range presetKeys {
+		if k.Name == key {
+			return k.field, true
+		}
+	}
+	return nil, false
+}
+
+// configKey describes a single setting and every place it can come from.
+type configKey struct {
+	Name    string // TOML key
+	Flag    string // CLI flag name, if any
+	Env     string // environment variable, if any
+	Default string
+	Secret  bool // mask when printing
+	// Project marks settings a project .tess.toml may set: per-project
+	// choices that are safe to commit. Credentials, file paths, and rclone
+	// flags are read from the home config, env, or flags only.
+	Project bool
+	field   func(*FileConfig) *string
 }
 
-// DefaultConfigPath returns ~/.tess/config.toml.
+// configKeys lists every known setting in display order.
+var configKeys = []configKey{
+	{Name: "api_key", Env: "TESS_API_KEY", Secret: true, field: func(c *FileConfig) *string { return &c.APIKey }},
+	{Name: "api_key_file", Flag: "api-key-file", Env: "TESS_API_KEY_FILE", field: func(c *FileConfig) *string { return &c.APIKeyFile }},
+	{Name: "rclone_remote", Flag: "rclone-remote", Env: "TESS_RCLONE_REMOTE", Default: "drive", Project: true, field: func(c *FileConfig) *string { return &c.RcloneRemote }},
+	{Name: "rclone_folder_id", Flag: "rclone-folder-id", Env: "TESS_RCLONE_FOLDER_ID", Project: true, field: func(c *FileConfig) *string { return &c.RcloneFolderID }},
+	{Name: "upload_format", Flag: "upload-format", Env: "TESS_UPLOAD_FORMAT", Default: "docx", Project: true, field: func(c *FileConfig) *string { return &c.UploadFormat }},
+	{Name: "pdf_engine", Flag: "pdf-engine", Env: "TESS_PDF_ENGINE", Project: true, field: func(c *FileConfig) *string { return &c.PDFEngine }},
+	{Name: "markdown_flavor", Flag: "markdown-flavor", Env: "TESS_MARKDOWN_FLAVOR", Default: DefaultMarkdownFlavor, Project: true, field: func(c *FileConfig) *string { return &c.MarkdownFlavor }},
+	{Name: "service_account_file", Flag: "service-account-file", Env: "TESS_SERVICE_ACCOUNT_FILE", field: func(c *FileConfig) *string { return &c.ServiceAccountFile }},
+	{Name: "rclone_extra_args", Flag: "rclone-extra-args", Env: "TESS_RCLONE_EXTRA_ARGS", field: func(c *FileConfig) *string { return &c.RcloneExtraArgs }},
+	{Name: "shared_drive_id", Flag: "shared-drive-id", Env: "TESS_SHARED_DRIVE_ID", Project: true, field: func(c *FileConfig) *string { return &c.SharedDriveID }},
+	{Name: "template_hub_id", Flag: "template-hub-id", Env: "TESS_TEMPLATE_HUB_ID", Default: DefaultTemplateHubID, Project: true, field: func(c *FileConfig) *string { return &c.TemplateHubID }},
+	{Name: "template_cover_id", Flag: "template-cover-id", Env: "TESS_TEMPLATE_COVER_ID", Default: DefaultTemplateCoverID, Project: true, field: func(c *FileConfig) *string { return &c.TemplateCoverID }},
+	{Name: "template_review_id", Flag: "template-review-id", Env: "TESS_TEMPLATE_REVIEW_ID", Default: DefaultTemplateReviewID, Project: true, field: func(c *FileConfig) *string { return &c.TemplateReviewID }},
+	{Name: "tmp_dir", Flag: "tmp-dir", Env: "TESS_TMPDIR", field: func(c *FileConfig) *string { return &c.TmpDir }},
+	{Name: "auth_header", Flag: "auth-header", Env: "TESS_AUTH_HEADER", Default: "Authorization", field: func(c *FileConfig) *string { return &c.AuthHeader }},
+	{Name: "auth_value_template", Flag: "auth-value-template", Env: "TESS_AUTH_VALUE_TEMPLATE", field: func(c *FileConfig) *string { return &c.AuthValueTemplate }},
+	{Name: "api_retries", Flag: "api-retries", Env: "TESS_API_RETRIES", Default: "3", field: func(c *FileConfig) *string { return &c.APIRetries }},
+	{Name: "uploader", Flag: "uploader", Env: "TESS_UPLOADER", Default: "rclone", field: func(c *FileConfig) *string { return &c.Uploader }},
+	{Name: "drive_token_file", Flag: "drive-token-file", Env: "TESS_DRIVE_TOKEN_FILE", field: func(c *FileConfig) *string { return &c.DriveTokenFile }},
+	{Name: "review_weights", Flag: "review-weights", Env: "TESS_REVIEW_WEIGHTS", Project: true, field: func(c *FileConfig) *string { return &c.ReviewWeights }},
+}
+
+func lookupConfigKey(name string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return configKey{}, false
+}
+
+// ConfigFlags returns the CLI flag names of every setting that has one, in
+// display order.
+func ConfigFlags() []string {
+	var out []string
+	for _, k := range configKeys {
+		if k.Flag != "" {
+			out = append(out, k.Flag)
+		}
+	}
+	return out
+}
+
+// ErrNoConfigDir means neither the home directory nor XDG_CONFIG_HOME is
+// available, so there is no default config location.
+var ErrNoConfigDir = errors.New("cannot determine a config location: the home directory is unknown (HOME is not set) and XDG_CONFIG_HOME is not set; pass --config PATH, or set HOME or XDG_CONFIG_HOME")
+
+// DefaultConfigPath returns ~/.tess/config.toml, falling back to
+// $XDG_CONFIG_HOME/tess/config.toml when the home directory can't be
+// determined (e.g. containers without HOME). It returns ErrNoConfigDir when
+// neither is available.
 func DefaultConfigPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".tess", "config.toml"), nil
+	}
+	if dir := xdgDir("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "tess", "config.toml"), nil
+	}
+	return "", ErrNoConfigDir
+}
+
+// xdgDir returns the XDG base directory in env, or "" when it is unset or
+// relative (which the XDG spec says to ignore).
+func xdgDir(env string) string {
+	dir := strings.TrimSpace(os.Getenv(env))
+	if !filepath.IsAbs(dir) {
+		return ""
 	}
-	return filepath.Join(home, ".tess", "config.toml"), nil
+	return dir
 }
 
 // LoadConfig reads a minimal TOML and returns the FileConfig.
 func LoadConfig(path string) (FileConfig, error) {
+	cfg, err := parseConfig(path)
+	if err != nil {
+		return FileConfig{}, err
+	}
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		return FileConfig{}, fmt.Errorf("missing 'api_key' in config: %s", path)
+	}
+	return cfg, nil
+}
+
+// parseConfig reads a minimal TOML without validating required keys.
+func parseConfig(path string) (FileConfig, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -38,14 +207,15 @@ func LoadConfig(path string) (FileConfig, error) {
 	}
 	defer f.Close()
 	var cfg FileConfig
+	section := ""
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if i := strings.Index(line, "#"); i >= 0 {
-			line = line[:i]
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
 		}
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "[") {
+		if strings.HasPrefix(line, "[") {
+			section = strings.TrimSpace(strings.Trim(line, "[]"))
 			continue
 		}
 		parts := strings.SplitN(line, "=", 2)
@@ -55,61 +225,208 @@ func LoadConfig(path string) (FileConfig, error) {
 		key := strings.TrimSpace(parts[0])
 		val := strings.TrimSpace(parts[1])
 		val = strings.Trim(val, " \t")
-		if len(val) >= 2 {
-			if (val[0] == '"' && val[len(val)-1] == '"') || (val[0] == '\'' && val[len(val)-1] == '\'') {
-				val = val[1 : len(val)-1]
+		val = unquote(val)
+		if name, ok := strings.CutPrefix(section, "presets."); ok {
+			name = unquote(strings.TrimSpace(name))
+			if field, ok := presetField(key); ok && name != "" {
+				if cfg.Presets == nil {
+					cfg.Presets = make(map[string]Preset)
+				}
+				p := cfg.Presets[name]
+				*field(&p) = strings.TrimSpace(val)
+				cfg.Presets[name] = p
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(section, "templates."); ok {
+			name = unquote(strings.TrimSpace(name))
+			if field, ok := templateSetKeys[key]; ok && name != "" {
+				if cfg.TemplateOverrides == nil {
+					cfg.TemplateOverrides = make(map[string]TemplateSet)
+				}
+				ts := cfg.TemplateOverrides[name]
+				*field(&ts) = strings.TrimSpace(val)
+				cfg.TemplateOverrides[name] = ts
 			}
+			continue
 		}
-		switch key {
-		case "api_key":
-			cfg.APIKey = val
-		case "rclone_remote":
-			cfg.RcloneRemote = strings.TrimSpace(val)
-		case "template_hub_id":
-			cfg.TemplateHubID = strings.TrimSpace(val)
-		case "template_cover_id":
-			cfg.TemplateCoverID = strings.TrimSpace(val)
-		case "template_review_id":
-			cfg.TemplateReviewID = strings.TrimSpace(val)
+		if k, ok := lookupConfigKey(key); ok {
+			if !k.Secret {
+				val = strings.TrimSpace(val)
+			}
+			*k.field(&cfg) = val
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return FileConfig{}, err
 	}
-	if strings.TrimSpace(cfg.APIKey) == "" {
-		return FileConfig{}, fmt.Errorf("missing 'api_key' in config: %s", path)
-	}
 	return cfg, nil
 }
 
+// FindProjectConfig walks up from dir looking for a .tess.toml. The search
+// stops at the first directory containing .git (the repo root) or at the
+// filesystem root. It returns the path and whether one was found.
+func FindProjectConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		candidate := filepath.Join(dir, ProjectConfigName)
+		if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+			return candidate, true
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
 // EnsureConfigDir ensures the parent directory for path exists.
 func EnsureConfigDir(path string) error {
 	dir := filepath.Dir(path)
 	return os.MkdirAll(dir, 0o755)
 }
 
-// SaveConfig writes a minimal TOML to path.
+// SaveConfig writes a minimal TOML to path. Any existing file is first copied
+// to path+".bak" (one generation) so it can be restored.
 func SaveConfig(path string, cfg FileConfig) error {
 	if err := EnsureConfigDir(path); err != nil {
 		return err
 	}
+	if prev, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(BackupPath(path), prev, 0o600); err != nil {
+			return fmt.Errorf("backup config: %w", err)
+		}
+	}
 	var b strings.Builder
-	if strings.TrimSpace(cfg.APIKey) != "" {
-		fmt.Fprintf(&b, "api_key = \"%s\"\n", escape(cfg.APIKey))
+	for _, k := range configKeys {
+		if v := *k.field(&cfg); strings.TrimSpace(v) != "" {
+			fmt.Fprintf(&b, "%s = \"%s\"\n", k.Name, escape(v))
+		}
 	}
-	if strings.TrimSpace(cfg.RcloneRemote) != "" {
-		fmt.Fprintf(&b, "rclone_remote = \"%s\"\n", escape(cfg.RcloneRemote))
+	for _, name := range sortedKeys(cfg.TemplateOverrides) {
+		ts := cfg.TemplateOverrides[name]
+		fmt.Fprintf(&b, "\n[templates.\"%s\"]\n", escape(name))
+		for _, key := range []string{"hub_id", "cover_id", "review_id"} {
+			if v := *templateSetKeys[key](&ts); strings.TrimSpace(v) != "" {
+				fmt.Fprintf(&b, "%s = \"%s\"\n", key, escape(v))
+			}
+		}
 	}
-	if strings.TrimSpace(cfg.TemplateHubID) != "" {
-		fmt.Fprintf(&b, "template_hub_id = \"%s\"\n", escape(cfg.TemplateHubID))
+	for _, name := range sortedKeys(cfg.Presets) {
+		p := cfg.Presets[name]
+		fmt.Fprintf(&b, "\n[presets.\"%s\"]\n", escape(name))
+		for _, k := range presetKeys {
+			if v := *k.field(&p); strings.TrimSpace(v) != "" {
+				fmt.Fprintf(&b, "%s = \"%s\"\n", k.Name, escape(v))
+			}
+		}
 	}
-	if strings.TrimSpace(cfg.TemplateCoverID) != "" {
-		fmt.Fprintf(&b, "template_cover_id = \"%s\"\n", escape(cfg.TemplateCoverID))
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
+// SavePreset stores p as the preset name in the config at path, replacing
+// any preset with that name and keeping everything else. The file is
+// created if it doesn't exist.
+func SavePreset(path, name string, p Preset) error {
+	var cfg FileConfig
+	if _, err := os.Stat(path); err == nil {
+		if cfg, err = parseConfig(path); err != nil {
+			return err
+		}
 	}
-	if strings.TrimSpace(cfg.TemplateReviewID) != "" {
-		fmt.Fprintf(&b, "template_review_id = \"%s\"\n", escape(cfg.TemplateReviewID))
+	if cfg.Presets == nil {
+		cfg.Presets = make(map[string]Preset)
 	}
-	return os.WriteFile(path, []byte(b.String()), 0o600)
+	cfg.Presets[name] = p
+	return SaveConfig(path, cfg)
+}
+
+// BackupPath returns the backup location for the config at path.
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// RestoreConfigBackup swaps the config at path with its backup, so running it
+// twice undoes the restore.
+func RestoreConfigBackup(path string) error {
+	bak := BackupPath(path)
+	prev, err := os.ReadFile(bak)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no backup found: %s", bak)
+		}
+		return err
+	}
+	cur, err := os.ReadFile(path)
+	hasCur := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.WriteFile(path, prev, 0o600); err != nil {
+		return err
+	}
+	if hasCur {
+		return os.WriteFile(bak, cur, 0o600)
+	}
+	return os.Remove(bak)
+}
+
+// unquote strips one pair of matching single or double quotes. Inside
+// double quotes it undoes escape, turning \\ and \" back into \ and ";
+// other backslashes are kept, so hand-written Windows paths survive.
+func unquote(val string) string {
+	if len(val) >= 2 {
+		if val[0] == '\'' && val[len(val)-1] == '\'' {
+			return val[1 : len(val)-1]
+		}
+		if val[0] == '"' && val[len(val)-1] == '"' {
+			return unescape(val[1 : len(val)-1])
+		}
+	}
+	return val
+}
+
+// unescape reverses escape.
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '\\' || s[i+1] == '"') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// stripComment removes a trailing # comment from a config line, ignoring #
+// inside a quoted value.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
 }
 
 func escape(s string) string {
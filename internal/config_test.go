@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSavePresetRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	cfg := FileConfig{
+		APIKey:          `k"ey\with#chars`,
+		TmpDir:          `C:\Users\me\tmp`,
+		RcloneExtraArgs: `--exclude "*.bak" # not a comment`,
+		TemplateOverrides: map[string]TemplateSet{
+			`me@example.com`: {HubID: `hub\1`},
+		},
+	}
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := cfg
+	want.Presets = map[string]Preset{}
+	// Each save re-reads the previous one, so escaping must not compound.
+	for i, name := range []string{"q4", `team "a"`, "q4"} {
+		p := Preset{UserID: "u1", CycleID: `c\` + name, RcloneFolderID: `F#1`}
+		if err := SavePreset(path, name, p); err != nil {
+			t.Fatal(err)
+		}
+		want.Presets[name] = p
+		got, err := parseConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			b, _ := os.ReadFile(path)
+			t.Fatalf("after save %d got\n%+v\nwant\n%+v\nfile:\n%s", i+1, got, want, b)
+		}
+	}
+}
+
+func TestParseConfigQuotingAndComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `# top comment
+api_key = "a\"b" # trailing comment
+tmp_dir = 'C:\tmp\new' # literal string
+pdf_engine = "C:\tools\xelatex"
+rclone_extra_args = "--include '#*'"
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"api_key", got.APIKey, `a"b`},
+		{"tmp_dir", got.TmpDir, `C:\tmp\new`},
+		{"pdf_engine", got.PDFEngine, `C:\tools\xelatex`},
+		{"rclone_extra_args", got.RcloneExtraArgs, `--include '#*'`},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+}
@@ -2,58 +2,204 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
+// slowAPILatency is the /v1/me round trip above which doctor flags the network.
+const slowAPILatency = 2 * time.Second
+
+// DoctorOptions controls RunDoctor.
+type DoctorOptions struct {
+	// FailOnWarning makes any warning (or failure) produce a non-zero exit.
+	FailOnWarning bool
+	// JSON prints a DoctorReport as JSON instead of the human-readable list.
+	JSON bool
+	// ConfigPath is the home config to check; empty means DefaultConfigPath.
+	ConfigPath string
+}
+
+// Doctor check statuses.
+const (
+	DoctorOK   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+	DoctorInfo = "info"
+)
+
+// DoctorCheck is one line of doctor output.
+type DoctorCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// DoctorReport collects everything RunDoctor found.
+//
+// Failures (DoctorFail) are: no config or API key, invalid rclone options,
+// DNS failure for the API host, and an unreachable API or rejected token.
+//
+// Warnings (DoctorWarn) are: a key set to different values in the home and
+// project config files, rclone missing, the configured rclone remote
+// missing or unverifiable, an unreachable Shared Drive, inaccessible template
+// IDs, pandoc missing, no PDF engine, a slow API round trip, and tools
+// installed in a known location that is not on PATH.
+//
+// A rejected token exits with ExitUnauthorized, even with FailOnWarning.
+type DoctorReport struct {
+	ConfigPath  string        `json:"configPath"`
+	ProjectPath string        `json:"projectPath,omitempty"`
+	ConfigFiles []ConfigFile  `json:"configFiles,omitempty"`
+	Settings    []Setting     `json:"settings,omitempty"`
+	Checks      []DoctorCheck `json:"checks"`
+	Warnings    int           `json:"warnings"`
+	Failures    int           `json:"failures"`
+	ExitCode    int           `json:"exitCode"`
+}
+
 // RunDoctor inspects the user's environment and prints actionable diagnostics.
-func RunDoctor(ctx context.Context) int {
+func RunDoctor(ctx context.Context, opts DoctorOptions) int {
+	var rep DoctorReport
+	// say prints free-form text in human-readable mode only.
+	say := func(format string, args ...any) {
+		if !opts.JSON {
+			fmt.Printf(format, args...)
+		}
+	}
 	// Status helpers
-	ok := func(msg string) { fmt.Printf("✓ %s\n", msg) }
-	warn := func(msg string) { fmt.Printf("! %s\n", msg) }
-	bad := func(msg string) { fmt.Printf("✗ %s\n", msg) }
+	record := func(status, glyph, msg string) {
+		rep.Checks = append(rep.Checks, DoctorCheck{Status: status, Message: msg})
+		switch status {
+		case DoctorWarn:
+			rep.Warnings++
+		case DoctorFail:
+			rep.Failures++
+		}
+		say("%s %s\n", glyph, msg)
+	}
+	ok := func(msg string) { record(DoctorOK, Glyphs.OK, msg) }
+	warn := func(msg string) { record(DoctorWarn, Glyphs.Warn, msg) }
+	bad := func(msg string) { record(DoctorFail, Glyphs.Fail, msg) }
+	info := func(msg string) { record(DoctorInfo, Glyphs.Info, msg) }
+	finish := func(code int) int {
+		if opts.FailOnWarning && code == 0 && (rep.Warnings > 0 || rep.Failures > 0) {
+			code = 1
+		}
+		rep.ExitCode = code
+		if opts.JSON {
+			b, _ := json.MarshalIndent(rep, "", "  ")
+			fmt.Println(string(b))
+		}
+		return code
+	}
 
 	// Config
-	cfgPath, err := DefaultConfigPath()
-	if err != nil {
-		bad(fmt.Sprintf("determine config path: %v", err))
-		return 1
+	cfgPath := opts.ConfigPath
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = DefaultConfigPath(); err != nil {
+			bad(err.Error())
+			return finish(1)
+		}
+	}
+	say("Tess doctor\n\n")
+	say("Config path: %s\n", cfgPath)
+	rep.ConfigPath = cfgPath
+	cwd, _ := os.Getwd()
+	cfg, err := LoadEffectiveConfig(cfgPath, cwd, nil)
+	if err == nil {
+		err = cfg.RequireAPIKey()
+	}
+	if cfg.ProjectPath != "" {
+		say("Project config: %s\n", cfg.ProjectPath)
+		rep.ProjectPath = cfg.ProjectPath
 	}
-	fmt.Printf("Tess doctor\n\n")
-	fmt.Printf("Config path: %s\n", cfgPath)
-	cfg, err := LoadConfig(cfgPath)
 	if err != nil {
 		bad(err.Error())
-		fmt.Printf("Hint: run 'tess setup' to create a config.\n")
-		return 1
+		say("Hint: run 'tess setup' to create a config.\n")
+		return finish(1)
 	}
-	masked := maskToken(cfg.APIKey)
 	ok("Loaded config")
-	fmt.Printf("- api_key: %s\n", masked)
-	if strings.TrimSpace(cfg.RcloneRemote) != "" {
-		fmt.Printf("- rclone_remote: %s\n", strings.TrimSpace(cfg.RcloneRemote))
+	rep.Settings = cfg.Settings()
+	for _, st := range rep.Settings {
+		say("- %s: %s (%s)\n", st.Key, st.Value, st.Source)
+	}
+	files, conflicts := cfg.ConfigFiles()
+	rep.ConfigFiles = files
+	for _, f := range files {
+		keys := "no keys"
+		if len(f.Keys) > 0 {
+			keys = "sets " + strings.Join(f.Keys, ", ")
+			if len(f.Effective) < len(f.Keys) {
+				keys += fmt.Sprintf("; in effect: %d of %d", len(f.Effective), len(f.Keys))
+			}
+		}
+		info(fmt.Sprintf("Config file %s (%s)", f.Path, keys))
+	}
+	if w := cfg.ProjectWarning(); w != "" {
+		warn(w)
+	}
+	for _, cf := range conflicts {
+		warn(fmt.Sprintf("%s is set differently in %s and %s; the %s value is used", cf.Key, cfg.HomePath, cfg.ProjectPath, cf.Winner))
+	}
+
+	if ro, err := RcloneOptionsFromConfig(cfg); err != nil {
+		bad(err.Error())
+	} else {
+		ConfigureRclone(ro)
 	}
 
 	// API token check (lightweight /v1/me)
-	client, err := NewClient(cfg.APIKey)
+	client, err := NewClientFromConfig(cfg)
 	if err != nil {
-		bad(fmt.Sprintf("invalid API key: %v", err))
-		return 1
+		bad(fmt.Sprintf("could not create API client: %v", err))
+		return finish(1)
 	}
-	if me, err := client.GetMe(ctx); err == nil && me != nil && strings.TrimSpace(me.ID) != "" {
-		ok("Lattice API reachable and token accepted")
-		fmt.Printf("- Current user: %s (%s)\n", me.Name, me.Email)
-	} else if err != nil {
+	host := client.BaseHost()
+	dnsStart := time.Now()
+	if addrs, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		bad(fmt.Sprintf("DNS lookup for %s failed: %v", host, err))
+		info("Check your network connection, VPN, or DNS settings.")
+	} else {
+		ok(fmt.Sprintf("DNS resolved %s to %s in %s", host, addrs[0], time.Since(dnsStart).Round(time.Millisecond)))
+	}
+	start := time.Now()
+	me, err := client.GetMe(ctx)
+	latency := time.Since(start).Round(time.Millisecond)
+	var netErr net.Error
+	exitCode := 0
+	switch {
+	case err != nil && errors.Is(err, ErrUnauthorized):
+		msg, _ := UnauthorizedMessage(err)
+		bad(msg)
+		exitCode = ExitUnauthorized
+	case err != nil && errors.As(err, &netErr):
+		bad(fmt.Sprintf("Lattice API unreachable after %s: %v", latency, err))
+		info("This is a network problem, not a token problem; check proxies (HTTPS_PROXY) and firewalls.")
+	case err != nil:
 		bad(fmt.Sprintf("Lattice API check failed: %v", err))
-		fmt.Printf("- Ensure your key is valid; if missing 'Bearer', Tess adds it automatically.\n")
+		info("Ensure your key is valid; if missing 'Bearer', Tess adds it automatically.")
+	case me != nil && strings.TrimSpace(me.ID) != "":
+		ok(fmt.Sprintf("Lattice API reachable and token accepted (%s)", latency))
+		info(fmt.Sprintf("Current user: %s (%s)", me.Name, me.Email))
+		if latency > slowAPILatency {
+			warn(fmt.Sprintf("Lattice API is slow (%s round trip); runs may take a while. Check your network or proxy.", latency))
+		}
 	}
 
 	// Optional tools
 	if err := RcloneAvailable(); err != nil {
 		warn("rclone not found (Drive upload disabled). Install from https://rclone.org")
 	} else {
-		ok("rclone found")
+		ok("rclone found: " + toolPath("rclone"))
 		// Check the configured remote exists (if provided)
 		if strings.TrimSpace(cfg.RcloneRemote) != "" {
 			exists, err := RemoteExists(ctx, cfg.RcloneRemote)
@@ -63,23 +209,118 @@ func RunDoctor(ctx context.Context) int {
 				warn(fmt.Sprintf("rclone remote '%s' not found. Run 'rclone config' and create it (Storage: drive)", cfg.RcloneRemote))
 			} else {
 				ok(fmt.Sprintf("rclone remote '%s' present", cfg.RcloneRemote))
+				if strings.TrimSpace(cfg.SharedDriveID) != "" {
+					if err := SharedDriveReachable(ctx, cfg.RcloneRemote); err != nil {
+						warn(fmt.Sprintf("shared drive '%s' not reachable: %v", cfg.SharedDriveID, err))
+					} else {
+						ok(fmt.Sprintf("shared drive '%s' reachable", cfg.SharedDriveID))
+					}
+				}
+				checkTemplates(ctx, cfg, ok, warn)
 			}
 		}
 	}
 	if err := HasPandoc(); err != nil {
 		warn("pandoc not found (DOCX/PDF export disabled). Install from https://pandoc.org")
 	} else {
-		ok("pandoc found")
+		ok("pandoc found: " + toolPath("pandoc"))
+	}
+	engines := 0
+	for _, eng := range pdfEngines {
+		if p := toolPath(eng); p != "" {
+			ok(fmt.Sprintf("PDF engine %s found: %s", eng, p))
+			engines++
+		}
+	}
+	if engines == 0 {
+		warn("no PDF engine found (--upload-format pdf disabled). Install tectonic for the lightest option")
 	}
 
-	// PATH sanity (best-effort)
-	path := os.Getenv("PATH")
-	if !strings.Contains(path, "/usr/local/bin") && !strings.Contains(path, "/opt/homebrew/bin") {
-		warn("/usr/local/bin or /opt/homebrew/bin not in PATH (Homebrew installs may not be visible)")
+	// PATH sanity: tools installed in a common location that PATH doesn't include.
+	for _, tool := range append([]string{"rclone", "pandoc"}, pdfEngines...) {
+		if toolPath(tool) != "" {
+			continue
+		}
+		for _, dir := range commonInstallDirs(runtime.GOOS) {
+			candidate := filepath.Join(dir, exeName(tool))
+			if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+				warn(fmt.Sprintf("%s is installed at %s but %s is not on PATH", tool, candidate, dir))
+				break
+			}
+		}
 	}
 
-	fmt.Printf("\nAll done. If something looks off, try 'tess setup' or check the README.\n")
-	return 0
+	say("\nAll done. If something looks off, try 'tess setup' or check the README.\n")
+	return finish(exitCode)
+}
+
+// toolPath returns the absolute path name resolves to on PATH, or "".
+func toolPath(name string) string {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// exeName adds the platform executable suffix.
+func exeName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// commonInstallDirs lists where package managers usually place binaries.
+func commonInstallDirs(goos string) []string {
+	home, _ := os.UserHomeDir()
+	switch goos {
+	case "darwin":
+		return []string{"/opt/homebrew/bin", "/usr/local/bin", "/Library/TeX/texbin", filepath.Join(home, ".cargo", "bin")}
+	case "windows":
+		pf := os.Getenv("ProgramFiles")
+		local := os.Getenv("LOCALAPPDATA")
+		return []string{
+			filepath.Join(pf, "Pandoc"),
+			filepath.Join(pf, "rclone"),
+			filepath.Join(local, "Pandoc"),
+			filepath.Join(local, "Microsoft", "WinGet", "Links"),
+			filepath.Join(home, "scoop", "shims"),
+			`C:\ProgramData\chocolatey\bin`,
+		}
+	default:
+		return []string{"/usr/local/bin", "/usr/bin", "/home/linuxbrew/.linuxbrew/bin", "/snap/bin", filepath.Join(home, ".local", "bin"), filepath.Join(home, ".cargo", "bin")}
+	}
+}
+
+// checkTemplates verifies each configured template ID (global and per-reviewee)
+// is reachable with the configured remote and reports its name.
+func checkTemplates(ctx context.Context, cfg EffectiveConfig, ok, warn func(string)) {
+	type tmpl struct{ label, id string }
+	list := []tmpl{{"Hub", cfg.TemplateHubID}, {"Cover", cfg.TemplateCoverID}, {"Review", cfg.TemplateReviewID}}
+	names := make([]string, 0, len(cfg.TemplateOverrides))
+	for name := range cfg.TemplateOverrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ts := cfg.TemplateOverrides[name]
+		list = append(list, tmpl{"Hub for " + name, ts.HubID}, tmpl{"Cover for " + name, ts.CoverID}, tmpl{"Review for " + name, ts.ReviewID})
+	}
+	for _, t := range list {
+		if strings.TrimSpace(t.id) == "" {
+			continue
+		}
+		info, err := StatFileByID(ctx, cfg.RcloneRemote, t.id)
+		if err != nil {
+			warn(fmt.Sprintf("template %s (%s) not accessible: %v", t.label, t.id, err))
+			continue
+		}
+		ok(fmt.Sprintf("template %s: %s", t.label, info.Name))
+	}
 }
 
 func maskToken(v string) string {
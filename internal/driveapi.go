@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	driveFilesURL  = "https://www.googleapis.com/drive/v3/files"
+	driveUploadURL = "https://www.googleapis.com/upload/drive/v3/files"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleDocMIME  = "application/vnd.google-apps.document"
+)
+
+// driveUploadMIME maps upload file extensions to their content types.
+var driveUploadMIME = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".html": "text/html",
+	".pdf":  "application/pdf",
+	".md":   "text/markdown",
+}
+
+// DriveToken is a stored OAuth token for the Drive API. Two shapes are
+// accepted: an "authorized_user" file (client_id, client_secret,
+// refresh_token), as written by `gcloud auth application-default login`,
+// which is refreshed as needed; or a bare access_token, used until it
+// expires.
+type DriveToken struct {
+	Type         string    `json:"type,omitempty"`
+	ClientID     string    `json:"client_id,omitempty"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+	TokenURI     string    `json:"token_uri,omitempty"`
+}
+
+// DefaultDriveTokenPath returns ~/.tess/drive_token.json, the token file
+// used by --drive-api when drive_token_file is not set.
+func DefaultDriveTokenPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the Drive token: %w; set drive_token_file", err)
+	}
+	return filepath.Join(home, ".tess", "drive_token.json"), nil
+}
+
+// DriveAPI is an Uploader that writes to a Google Drive folder with the
+// Drive v3 REST API instead of rclone. It is safe for concurrent use.
+type DriveAPI struct {
+	http      *http.Client
+	folderID  string
+	tokenPath string
+	mu        sync.Mutex
+	token     DriveToken
+}
+
+// driveRootFolder is Drive's alias for the top of My Drive, used when no
+// folder ID is configured, as rclone does.
+const driveRootFolder = "root"
+
+// NewDriveAPI loads the OAuth token at tokenPath for uploads to folderID, or
+// to the top of My Drive when folderID is empty.
+func NewDriveAPI(tokenPath, folderID string) (*DriveAPI, error) {
+	if folderID = strings.TrimSpace(folderID); folderID == "" {
+		folderID = driveRootFolder
+	}
+	b, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("read Drive token: %w (create one with an OAuth flow; see \"Drive API instead of rclone\" in the README)", err)
+	}
+	var tok DriveToken
+	if err := json.Unmarshal(b, &tok); err != nil {
+		return nil, fmt.Errorf("parse Drive token %s: %w", tokenPath, err)
+	}
+	if tok.RefreshToken == "" && tok.AccessToken == "" {
+		return nil, fmt.Errorf("Drive token %s has neither a refresh_token nor an access_token", tokenPath)
+	}
+	if tok.RefreshToken != "" && (tok.ClientID == "" || tok.ClientSecret == "") {
+		return nil, fmt.Errorf("Drive token %s has a refresh_token but no client_id/client_secret to refresh it with", tokenPath)
+	}
+	return &DriveAPI{http: &http.Client{Timeout: 2 * time.Minute}, folderID: folderID, tokenPath: tokenPath, token: tok}, nil
+}
+
+func (d *DriveAPI) Name() string { return "Drive API" }
+
+func (d *DriveAPI) Destination() string { return "Drive" }
+
+// accessToken returns a valid access token, refreshing it when it is
+// missing or about to expire.
+func (d *DriveAPI) accessToken(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.token.AccessToken != "" && (d.token.Expiry.IsZero() || time.Until(d.token.Expiry) > time.Minute) {
+		return d.token.AccessToken, nil
+	}
+	if d.token.RefreshToken == "" {
+		return "", fmt.Errorf("Drive access token in %s has expired and there is no refresh_token; authorize again", d.tokenPath)
+	}
+	tokenURL := d.token.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {d.token.RefreshToken},
+		"client_id":     {d.token.ClientID},
+		"client_secret": {d.token.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("refresh Drive token: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("refresh Drive token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		msg := strings.TrimSpace(body.Error + ": " + body.Description)
+		return "", fmt.Errorf("refresh Drive token: %s %s (authorize again to replace %s)", resp.Status, strings.Trim(msg, ": "), d.tokenPath)
+	}
+	d.token.AccessToken = body.AccessToken
+	d.token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return d.token.AccessToken, nil
+}
+
+// driveFile is the subset of Drive file metadata Tess reads.
+type driveFile struct {
+	ID          string `json:"id"`
+	WebViewLink string `json:"webViewLink"`
+}
+
+// do sends req with the access token and decodes a JSON response into out.
+func (d *DriveAPI) do(req *http.Request, out any) error {
+	token, err := d.accessToken(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &e) == nil && e.Error.Message != "" {
+			msg = e.Error.Message
+		}
+		return fmt.Errorf("drive api %s: %s", resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// findInFolder returns the ID of a file named name in folderID, or "".
+func (d *DriveAPI) findInFolder(ctx context.Context, folderID, name, mimeType string) (string, error) {
+	esc := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	q := url.Values{
+		"q":                         {fmt.Sprintf("name = '%s' and '%s' in parents and mimeType = '%s' and trashed = false", esc.Replace(name), esc.Replace(folderID), mimeType)},
+		"fields":                    {"files(id)"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, driveFilesURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	var list struct {
+		Files []driveFile `json:"files"`
+	}
+	if err := d.do(req, &list); err != nil {
+		return "", err
+	}
+	if len(list.Files) == 0 {
+		return "", nil
+	}
+	return list.Files[0].ID, nil
+}
+
+// Upload sends localPath to the folder as opts.Name. With opts.ImportFormat
+// set, Drive converts the file to a native Google Doc named without the
+// extension, as with ImportAsGoogleDoc. A file of the same name and type
+// already in the folder is updated in place instead of duplicated.
+func (d *DriveAPI) Upload(ctx context.Context, localPath string, opts UploadOptions) (UploadResult, error) {
+	link, err := d.upload(ctx, localPath, opts.Name, opts.ImportFormat)
+	return UploadResult{Link: link}, err
+}
+
+func (d *DriveAPI) upload(ctx context.Context, srcPath, name, importFormat string) (string, error) {
+	folderID := d.folderID
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(srcPath))
+	mediaType, ok := driveUploadMIME[ext]
+	if !ok {
+		mediaType = "application/octet-stream"
+	}
+	targetType := mediaType
+	if importFormat != "" {
+		targetType = googleDocMIME
+		name = strings.TrimSuffix(name, "."+importFormat)
+	}
+	existing, err := d.findInFolder(ctx, folderID, name, targetType)
+	if err != nil {
+		return "", fmt.Errorf("drive api: look for an existing %q: %w", name, err)
+	}
+
+	// An update replaces the content and keeps the file's type and place.
+	meta := map[string]any{"name": name}
+	method, endpoint := http.MethodPost, driveUploadURL
+	if existing != "" {
+		method, endpoint = http.MethodPatch, driveUploadURL+"/"+url.PathEscape(existing)
+	} else {
+		meta["mimeType"], meta["parents"] = targetType, []string{folderID}
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{{"application/json; charset=UTF-8", metaJSON}, {mediaType, content}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	q := url.Values{"uploadType": {"multipart"}, "supportsAllDrives": {"true"}, "fields": {"id,webViewLink"}}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"?"+q.Encode(), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	var f driveFile
+	if err := d.do(req, &f); err != nil {
+		return "", err
+	}
+	if f.WebViewLink == "" {
+		return "", ErrLinkUnavailable
+	}
+	return f.WebViewLink, nil
+}
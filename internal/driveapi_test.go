@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// driveStub answers Drive API requests in place of the network, recording
+// each one. existing is the ID returned by the name lookup ("" for none).
+type driveStub struct {
+	mu       sync.Mutex
+	existing string
+	requests []string // method, URL, and body of each request
+}
+
+func (s *driveStub) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.String()+"\n"+string(body))
+	s.mu.Unlock()
+	reply := `{"id":"f1","webViewLink":"https://drive.example/f1"}`
+	if r.Method == http.MethodGet {
+		reply = `{"files":[]}`
+		if s.existing != "" {
+			reply = `{"files":[{"id":"` + s.existing + `"}]}`
+		}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}, Body: io.NopCloser(strings.NewReader(reply)), Request: r}, nil
+}
+
+// newStubDriveAPI returns a DriveAPI for folderID that talks to a driveStub.
+func newStubDriveAPI(t *testing.T, folderID string, stub *driveStub) *DriveAPI {
+	t.Helper()
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(tokenPath, []byte(`{"access_token":"tok"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDriveAPI(tokenPath, folderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.http.Transport = stub
+	return d
+}
+
+func TestDriveAPIUploadFolder(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "Report.pdf")
+	if err := os.WriteFile(src, []byte("%PDF"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, folderID, wantParent string
+	}{
+		{"configured folder", "F1", "F1"},
+		{"no folder", "", "root"},
+		{"blank folder", "  ", "root"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &driveStub{}
+			d := newStubDriveAPI(t, tc.folderID, stub)
+			res, err := d.Upload(context.Background(), src, UploadOptions{Name: "Report.pdf"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Link != "https://drive.example/f1" {
+				t.Errorf("link = %q", res.Link)
+			}
+			if len(stub.requests) != 2 {
+				t.Fatalf("got %d requests, want a lookup and an upload: %q", len(stub.requests), stub.requests)
+			}
+			if want := "%27" + tc.wantParent + "%27+in+parents"; !strings.Contains(stub.requests[0], want) {
+				t.Errorf("lookup = %q, want it to search %q", stub.requests[0], tc.wantParent)
+			}
+			if want := `"parents":["` + tc.wantParent + `"]`; !strings.HasPrefix(stub.requests[1], "POST ") || !strings.Contains(stub.requests[1], want) {
+				t.Errorf("upload = %q, want a POST with %s", stub.requests[1], want)
+			}
+		})
+	}
+}
+
+func TestDriveAPIUploadUpdatesExisting(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "Report.docx")
+	if err := os.WriteFile(src, []byte("docx"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stub := &driveStub{existing: "old1"}
+	d := newStubDriveAPI(t, "F1", stub)
+	if _, err := d.Upload(context.Background(), src, UploadOptions{Name: "Report.docx", ImportFormat: "docx"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.requests) != 2 {
+		t.Fatalf("got %d requests: %q", len(stub.requests), stub.requests)
+	}
+	if !strings.Contains(stub.requests[0], "name+%3D+%27Report%27") || !strings.Contains(stub.requests[0], "application%2Fvnd.google-apps.document") {
+		t.Errorf("lookup = %q, want the Google Doc named without the extension", stub.requests[0])
+	}
+	if up := stub.requests[1]; !strings.HasPrefix(up, "PATCH https://www.googleapis.com/upload/drive/v3/files/old1?") || strings.Contains(up, `"parents"`) {
+		t.Errorf("upload = %q, want a PATCH of old1 that keeps its parents", up)
+	}
+}
@@ -0,0 +1,355 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Source identifies where an effective setting came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceHome    Source = "home config"
+	SourceProject Source = "project config"
+	SourcePreset  Source = "preset"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceKeyFile Source = "api_key_file"
+)
+
+// EffectiveConfig is the fully resolved configuration for a run, along with
+// the source of each value keyed by TOML key name.
+type EffectiveConfig struct {
+	FileConfig
+	Sources     map[string]Source
+	HomePath    string
+	ProjectPath string
+	HomeFound   bool
+	// PresetName and Preset are the preset selected with --preset, if any.
+	PresetName string
+	Preset     Preset
+	// ProjectIgnored lists settings the project file set that a project
+	// file may not (see configKey.Project); they were left out.
+	ProjectIgnored []string
+	// home and project are the raw files, kept for ConfigFiles.
+	home, project FileConfig
+}
+
+// Source returns where the named setting came from ("" if unset).
+func (e EffectiveConfig) Source(key string) Source {
+	return e.Sources[key]
+}
+
+// ConfigInputs holds every raw source that feeds ResolveConfig.
+type ConfigInputs struct {
+	Home    FileConfig
+	Project FileConfig
+	// Preset is the selected preset, if any; it overrides both files.
+	Preset Preset
+	// Flags maps explicitly provided flag names to their values.
+	Flags map[string]string
+	// Env looks up environment variables; nil means os.LookupEnv.
+	Env func(string) (string, bool)
+}
+
+// ResolveConfig merges every source for each known setting in the order
+// flag > env > preset > project config > home config > default. Project
+// values are only used for settings marked Project.
+func ResolveConfig(in ConfigInputs) EffectiveConfig {
+	env := in.Env
+	if env == nil {
+		env = os.LookupEnv
+	}
+	eff := EffectiveConfig{Sources: make(map[string]Source)}
+	for _, k := range configKeys {
+		val, src := k.Default, SourceDefault
+		if v := *k.field(&in.Home); strings.TrimSpace(v) != "" {
+			val, src = v, SourceHome
+		}
+		if v := *k.field(&in.Project); k.Project && strings.TrimSpace(v) != "" {
+			val, src = v, SourceProject
+		}
+		if field, ok := presetField(k.Name); ok {
+			if v := *field(&in.Preset); strings.TrimSpace(v) != "" {
+				val, src = v, SourcePreset
+			}
+		}
+		if k.Env != "" {
+			if v, ok := env(k.Env); ok && strings.TrimSpace(v) != "" {
+				val, src = strings.TrimSpace(v), SourceEnv
+			}
+		}
+		if k.Flag != "" {
+			if v, ok := in.Flags[k.Flag]; ok {
+				val, src = strings.TrimSpace(v), SourceFlag
+			}
+		}
+		if strings.TrimSpace(val) == "" {
+			continue
+		}
+		*k.field(&eff.FileConfig) = val
+		eff.Sources[k.Name] = src
+	}
+	// Per-reviewee template overrides merge by name; project entries win.
+	for _, m := range []map[string]TemplateSet{in.Home.TemplateOverrides, in.Project.TemplateOverrides} {
+		for name, ts := range m {
+			if eff.TemplateOverrides == nil {
+				eff.TemplateOverrides = make(map[string]TemplateSet)
+			}
+			eff.TemplateOverrides[name] = ts
+		}
+	}
+	for _, m := range []map[string]Preset{in.Home.Presets, in.Project.Presets} {
+		for name, p := range m {
+			if eff.Presets == nil {
+				eff.Presets = make(map[string]Preset)
+			}
+			eff.Presets[name] = p
+		}
+	}
+	return eff
+}
+
+// TemplatesFor returns the template IDs to use for a reviewee. An override
+// keyed by user ID (or email, case-insensitively) replaces the config-file and
+// default template IDs; explicit flags and env vars still win.
+func (e EffectiveConfig) TemplatesFor(userID, email string) TemplateSet {
+	out := TemplateSet{HubID: e.TemplateHubID, CoverID: e.TemplateCoverID, ReviewID: e.TemplateReviewID}
+	ov, ok := e.TemplateOverrides[userID]
+	if !ok && strings.TrimSpace(email) != "" {
+		for name, ts := range e.TemplateOverrides {
+			if strings.EqualFold(name, strings.TrimSpace(email)) {
+				ov, ok = ts, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return out
+	}
+	apply := func(key string, dst *string, v string) {
+		if src := e.Sources[key]; src == SourceFlag || src == SourceEnv || strings.TrimSpace(v) == "" {
+			return
+		}
+		*dst = v
+	}
+	apply("template_hub_id", &out.HubID, ov.HubID)
+	apply("template_cover_id", &out.CoverID, ov.CoverID)
+	apply("template_review_id", &out.ReviewID, ov.ReviewID)
+	return out
+}
+
+// LoadEffectiveConfig reads the home config at homePath and the nearest
+// project .tess.toml above cwd, then resolves them together with flags and
+// environment variables. Settings a project file may not set are dropped
+// from it and listed in ProjectIgnored. flags["preset"], when set, names a preset from
+// either file (project wins) to apply above both files. Missing files are
+// skipped; call RequireAPIKey before talking to the API.
+func LoadEffectiveConfig(homePath, cwd string, flags map[string]string) (EffectiveConfig, error) {
+	projectPath, hasProject := FindProjectConfig(cwd)
+	var in ConfigInputs
+	var ignored []string
+	in.Flags = flags
+	homeFound := false
+	if _, err := os.Stat(homePath); err == nil {
+		home, err := parseConfig(homePath)
+		if err != nil {
+			return EffectiveConfig{}, err
+		}
+		in.Home, homeFound = home, true
+	}
+	if hasProject {
+		project, err := parseConfig(projectPath)
+		if err != nil {
+			return EffectiveConfig{}, err
+		}
+		in.Project, ignored = projectOnly(project)
+	}
+	presetName := strings.TrimSpace(flags["preset"])
+	if presetName != "" {
+		p, ok := in.Project.Presets[presetName]
+		if !ok {
+			p, ok = in.Home.Presets[presetName]
+		}
+		if !ok {
+			return EffectiveConfig{}, fmt.Errorf("unknown preset %q (save one with: tess preset save %s --user-id ... --cycle-id ...)", presetName, presetName)
+		}
+		in.Preset = p
+	}
+	eff := ResolveConfig(in)
+	eff.HomePath, eff.ProjectPath, eff.HomeFound = homePath, projectPath, homeFound
+	eff.PresetName, eff.Preset = presetName, in.Preset
+	eff.home, eff.project = in.Home, in.Project
+	eff.ProjectIgnored = ignored
+	if err := eff.applyAPIKeyFile(); err != nil {
+		return eff, err
+	}
+	return eff, nil
+}
+
+// projectOnly clears the settings a project file may not set, returning the
+// cleaned config and the names of the keys it cleared.
+func projectOnly(fc FileConfig) (FileConfig, []string) {
+	var ignored []string
+	for _, k := range configKeys {
+		if v := k.field(&fc); !k.Project && strings.TrimSpace(*v) != "" {
+			*v = ""
+			ignored = append(ignored, k.Name)
+		}
+	}
+	return fc, ignored
+}
+
+// ProjectWarning explains which project settings were ignored, or returns ""
+// when none were.
+func (e EffectiveConfig) ProjectWarning() string {
+	if len(e.ProjectIgnored) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ignoring %s in %s: a project config may only set per-project settings such as folder and template IDs; move these to %s", strings.Join(e.ProjectIgnored, ", "), e.ProjectPath, e.HomePath)
+}
+
+// applyAPIKeyFile replaces the API key with the contents of api_key_file when
+// one is set. TESS_API_KEY still wins; an inline api_key does not.
+func (e *EffectiveConfig) applyAPIKeyFile() error {
+	path := strings.TrimSpace(e.APIKeyFile)
+	if path == "" || e.Sources["api_key"] == SourceEnv {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read api_key_file: %w", err)
+	}
+	key := strings.TrimSpace(string(b))
+	if key == "" {
+		return fmt.Errorf("api_key_file is empty: %s", path)
+	}
+	e.APIKey = key
+	e.Sources["api_key"] = SourceKeyFile
+	return nil
+}
+
+// RequireAPIKey returns an error describing why no API key is available.
+func (e EffectiveConfig) RequireAPIKey() error {
+	if strings.TrimSpace(e.APIKey) != "" {
+		return nil
+	}
+	if !e.HomeFound && e.ProjectPath == "" {
+		return fmt.Errorf("config file not found: %s", e.HomePath)
+	}
+	return fmt.Errorf("missing 'api_key' in config: %s", e.HomePath)
+}
+
+// ConfigFile describes one config file that was found and the keys it sets.
+type ConfigFile struct {
+	Path string `json:"path"`
+	// Keys lists the settings the file sets, in display order; per-reviewee
+	// template sections appear as templates."<name>".
+	Keys []string `json:"keys"`
+	// Effective lists the subset of Keys whose value this file supplies to
+	// the effective config (not overridden by a later file, env, or flag).
+	Effective []string `json:"effective"`
+	// Ignored lists settings in a project file that a project file may not
+	// set, so they have no effect.
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// ConfigConflict is a key set to different values in the home and project
+// config files.
+type ConfigConflict struct {
+	Key string `json:"key"`
+	// Winner is the source whose value is used (project, env, or flag).
+	Winner Source `json:"winner"`
+}
+
+// ConfigFiles returns the config files that were found, home first, with the
+// keys each contributes, and the keys the two files disagree on.
+func (e EffectiveConfig) ConfigFiles() ([]ConfigFile, []ConfigConflict) {
+	var files []ConfigFile
+	describe := func(path string, fc FileConfig, src Source) ConfigFile {
+		f := ConfigFile{Path: path, Keys: []string{}, Effective: []string{}}
+		for _, k := range configKeys {
+			if strings.TrimSpace(*k.field(&fc)) == "" {
+				continue
+			}
+			f.Keys = append(f.Keys, k.Name)
+			if e.Sources[k.Name] == src {
+				f.Effective = append(f.Effective, k.Name)
+			}
+		}
+		for _, name := range sortedKeys(fc.TemplateOverrides) {
+			key := fmt.Sprintf("templates.%q", name)
+			f.Keys = append(f.Keys, key)
+			if _, inProject := e.project.TemplateOverrides[name]; src == SourceProject || !inProject {
+				f.Effective = append(f.Effective, key)
+			}
+		}
+		for _, name := range sortedKeys(fc.Presets) {
+			key := fmt.Sprintf("presets.%q", name)
+			f.Keys = append(f.Keys, key)
+			if _, inProject := e.project.Presets[name]; src == SourceProject || !inProject {
+				f.Effective = append(f.Effective, key)
+			}
+		}
+		return f
+	}
+	if e.HomeFound {
+		files = append(files, describe(e.HomePath, e.home, SourceHome))
+	}
+	if e.ProjectPath != "" {
+		f := describe(e.ProjectPath, e.project, SourceProject)
+		f.Ignored = e.ProjectIgnored
+		files = append(files, f)
+	}
+	var conflicts []ConfigConflict
+	if !e.HomeFound || e.ProjectPath == "" {
+		return files, conflicts
+	}
+	for _, k := range configKeys {
+		hv, pv := strings.TrimSpace(*k.field(&e.home)), strings.TrimSpace(*k.field(&e.project))
+		if hv != "" && pv != "" && hv != pv {
+			conflicts = append(conflicts, ConfigConflict{Key: k.Name, Winner: e.Sources[k.Name]})
+		}
+	}
+	for _, name := range sortedKeys(e.home.TemplateOverrides) {
+		if pv, ok := e.project.TemplateOverrides[name]; ok && pv != e.home.TemplateOverrides[name] {
+			conflicts = append(conflicts, ConfigConflict{Key: fmt.Sprintf("templates.%q", name), Winner: SourceProject})
+		}
+	}
+	return files, conflicts
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Setting is a single resolved value for display.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+}
+
+// Settings returns each resolved setting in display order. Secret values are masked.
+func (e EffectiveConfig) Settings() []Setting {
+	out := make([]Setting, 0, len(configKeys))
+	for _, k := range configKeys {
+		v := *k.field(&e.FileConfig)
+		if v == "" {
+			continue
+		}
+		if k.Secret {
+			v = maskToken(v)
+		}
+		out = append(out, Setting{Key: k.Name, Value: v, Source: e.Sources[k.Name]})
+	}
+	return out
+}
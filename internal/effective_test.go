@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	home := FileConfig{RcloneRemote: "home", UploadFormat: "pdf", PDFEngine: "home-engine", TmpDir: "/home-tmp", RcloneFolderID: "home-folder"}
+	project := FileConfig{RcloneRemote: "project", UploadFormat: "html", PDFEngine: "project-engine", RcloneFolderID: "project-folder"}
+	env := map[string]string{"TESS_RCLONE_REMOTE": "env", "TESS_UPLOAD_FORMAT": "  docx  ", "TESS_TMPDIR": "   "}
+	in := ConfigInputs{
+		Home:    home,
+		Project: project,
+		Preset:  Preset{RcloneFolderID: "preset-folder", UploadFormat: "md"},
+		Flags:   map[string]string{"rclone-remote": "flag"},
+		Env: func(k string) (string, bool) {
+			v, ok := env[k]
+			return v, ok
+		},
+	}
+	eff := ResolveConfig(in)
+	for _, tc := range []struct {
+		key, got, want string
+		src            Source
+	}{
+		{"rclone_remote", eff.RcloneRemote, "flag", SourceFlag},
+		{"upload_format", eff.UploadFormat, "docx", SourceEnv},
+		{"rclone_folder_id", eff.RcloneFolderID, "preset-folder", SourcePreset},
+		{"pdf_engine", eff.PDFEngine, "project-engine", SourceProject},
+		// A blank env var doesn't hide the file value.
+		{"tmp_dir", eff.TmpDir, "/home-tmp", SourceHome},
+		{"markdown_flavor", eff.MarkdownFlavor, DefaultMarkdownFlavor, SourceDefault},
+		{"shared_drive_id", eff.SharedDriveID, "", ""},
+	} {
+		if tc.got != tc.want || eff.Source(tc.key) != tc.src {
+			t.Errorf("%s = %q from %q, want %q from %q", tc.key, tc.got, eff.Source(tc.key), tc.want, tc.src)
+		}
+	}
+}
+
+func TestLoadEffectiveConfigFiles(t *testing.T) {
+	for _, k := range configKeys {
+		if k.Env != "" {
+			t.Setenv(k.Env, "")
+			os.Unsetenv(k.Env)
+		}
+	}
+	dir := t.TempDir()
+	homePath := filepath.Join(dir, "home", "config.toml")
+	repo := filepath.Join(dir, "repo")
+	sub := filepath.Join(repo, "sub")
+	keyPath := filepath.Join(dir, "key")
+	for path, content := range map[string]string{
+		homePath:                               "api_key = \"inline\"\napi_key_file = \"" + keyPath + "\"\nrclone_remote = \"home\"\n\n[presets.q4]\ncycle_id = \"c-home\"\n",
+		filepath.Join(repo, ProjectConfigName): "rclone_remote = \"project\"\n\n[presets.q4]\ncycle_id = \"c-project\"\nupload_format = \"pdf\"\n",
+		keyPath:                                "from-file\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	eff, err := LoadEffectiveConfig(homePath, sub, map[string]string{"preset": "q4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eff.ProjectPath != filepath.Join(repo, ProjectConfigName) || !eff.HomeFound {
+		t.Errorf("project = %q, home found = %t", eff.ProjectPath, eff.HomeFound)
+	}
+	if eff.RcloneRemote != "project" || eff.Source("rclone_remote") != SourceProject {
+		t.Errorf("rclone_remote = %q from %q, want the project value", eff.RcloneRemote, eff.Source("rclone_remote"))
+	}
+	// The project's preset of the same name wins.
+	if eff.Preset.CycleID != "c-project" || eff.UploadFormat != "pdf" || eff.Source("upload_format") != SourcePreset {
+		t.Errorf("preset = %+v, upload_format = %q from %q", eff.Preset, eff.UploadFormat, eff.Source("upload_format"))
+	}
+	// api_key_file beats an inline api_key, but not TESS_API_KEY.
+	if eff.APIKey != "from-file" || eff.Source("api_key") != SourceKeyFile {
+		t.Errorf("api_key = %q from %q, want the key file", eff.APIKey, eff.Source("api_key"))
+	}
+	t.Setenv("TESS_API_KEY", "from-env")
+	if eff, err = LoadEffectiveConfig(homePath, sub, nil); err != nil || eff.APIKey != "from-env" {
+		t.Errorf("api_key = %q (%v), want TESS_API_KEY", eff.APIKey, err)
+	}
+
+	if _, err := LoadEffectiveConfig(homePath, sub, map[string]string{"preset": "missing"}); err == nil {
+		t.Error("unknown preset accepted")
+	}
+}
+
+func TestLoadEffectiveConfigIgnoresUnsafeProjectKeys(t *testing.T) {
+	for _, k := range configKeys {
+		if k.Env != "" {
+			t.Setenv(k.Env, "")
+			os.Unsetenv(k.Env)
+		}
+	}
+	dir := t.TempDir()
+	homePath := filepath.Join(dir, "config.toml")
+	projectPath := filepath.Join(dir, ProjectConfigName)
+	if err := os.WriteFile(homePath, []byte("api_key = \"home-key\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	project := "api_key = \"project-key\"\nrclone_extra_args = \"--config /tmp/evil.conf\"\nrclone_folder_id = \"F1\"\n"
+	if err := os.WriteFile(projectPath, []byte(project), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	eff, err := LoadEffectiveConfig(homePath, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eff.APIKey != "home-key" || eff.Source("api_key") != SourceHome {
+		t.Errorf("api_key = %q from %q, want the home key", eff.APIKey, eff.Source("api_key"))
+	}
+	if eff.RcloneExtraArgs != "" {
+		t.Errorf("rclone_extra_args = %q, want the project value ignored", eff.RcloneExtraArgs)
+	}
+	if eff.RcloneFolderID != "F1" || eff.Source("rclone_folder_id") != SourceProject {
+		t.Errorf("rclone_folder_id = %q from %q, want the project value", eff.RcloneFolderID, eff.Source("rclone_folder_id"))
+	}
+	if want := []string{"api_key", "rclone_extra_args"}; !slices.Equal(eff.ProjectIgnored, want) {
+		t.Errorf("ProjectIgnored = %q, want %q", eff.ProjectIgnored, want)
+	}
+	if w := eff.ProjectWarning(); !strings.Contains(w, "api_key, rclone_extra_args") || !strings.Contains(w, projectPath) {
+		t.Errorf("ProjectWarning = %q", w)
+	}
+	files, conflicts := eff.ConfigFiles()
+	if len(files) != 2 || !slices.Equal(files[1].Keys, []string{"rclone_folder_id"}) || !slices.Equal(files[1].Ignored, eff.ProjectIgnored) {
+		t.Errorf("project file = %+v", files[len(files)-1])
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts = %+v, want none for ignored keys", conflicts)
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ExportSchemaVersion is the current JSON export format version. Bump it when
+// a field is removed or changes meaning; purely additive fields don't need a
+// bump. ReadExport rejects versions newer than this.
+const ExportSchemaVersion = 1
+
+// ReportExport is the JSON export of everything needed to rebuild a report
+// without the API (see --export-json and --from-file).
+type ReportExport struct {
+	// SchemaVersion identifies the layout of this document. Files written
+	// before versioning existed have no field (0) and are read as version 1.
+	SchemaVersion int `json:"schemaVersion"`
+	// GeneratedAt is when the export was written (RFC 3339).
+	GeneratedAt string `json:"generatedAt"`
+	// TessVersion is the version of the binary that wrote the export.
+	TessVersion string `json:"tessVersion"`
+	// User is the reviewee the report is about.
+	User User `json:"user"`
+	// Cycle is the review cycle the reviews belong to.
+	Cycle ReviewCycle `json:"cycle"`
+	// Reviews are the raw review records as returned by the API.
+	Reviews []Review `json:"reviews"`
+	// Users holds resolved reviewers keyed by user ID.
+	Users map[string]User `json:"users"`
+	// Questions holds resolved questions keyed by question ID.
+	Questions map[string]Question `json:"questions"`
+}
+
+// WriteExport stamps e with the current schema version and writes it to path.
+func WriteExport(path string, e ReportExport) error {
+	e.SchemaVersion = ExportSchemaVersion
+	if e.GeneratedAt == "" {
+		e.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if e.TessVersion == "" {
+		e.TessVersion = Version
+	}
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// ReadExport reads an export written by WriteExport, migrating older schema
+// versions and rejecting ones this binary doesn't understand.
+func ReadExport(path string) (ReportExport, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ReportExport{}, err
+	}
+	var e ReportExport
+	if err := json.Unmarshal(b, &e); err != nil {
+		return ReportExport{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if err := migrateExport(&e); err != nil {
+		return ReportExport{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// migrateExport upgrades e in place to ExportSchemaVersion.
+func migrateExport(e *ReportExport) error {
+	switch {
+	case e.SchemaVersion == 0:
+		// Unversioned drafts share the version 1 layout.
+		e.SchemaVersion = 1
+	case e.SchemaVersion > ExportSchemaVersion:
+		return fmt.Errorf("export schema version %d is newer than this tess supports (%d); upgrade tess", e.SchemaVersion, ExportSchemaVersion)
+	case e.SchemaVersion < 0:
+		return fmt.Errorf("invalid export schema version %d", e.SchemaVersion)
+	}
+	return nil
+}
+
+// StaticResolver resolves users and questions from in-memory maps, such as
+// those stored in a ReportExport.
+type StaticResolver struct {
+	Users     map[string]User
+	Questions map[string]Question
+}
+
+// ResolveUser returns the embedded reviewer details or the stored user.
+func (r StaticResolver) ResolveUser(ctx context.Context, ref UserRef) (*User, error) {
+	if strings.TrimSpace(ref.Name) != "" {
+		return &User{ID: ref.ID, Name: ref.Name, Email: ref.Email, AvatarURL: ref.AvatarURL}, nil
+	}
+	if u, ok := r.Users[ref.ID]; ok {
+		return &u, nil
+	}
+	return nil, fmt.Errorf("user %s not found", ref.ID)
+}
+
+// GetQuestionByID returns the stored question.
+func (r StaticResolver) GetQuestionByID(ctx context.Context, id string) (*Question, error) {
+	if q, ok := r.Questions[id]; ok {
+		return &q, nil
+	}
+	return nil, fmt.Errorf("question %s not found", id)
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"os"
+	"strings"
+)
+
+// GlyphSet holds the status markers printed by doctor, setup, spinners, and
+// summaries.
+type GlyphSet struct {
+	OK, Warn, Fail, Info string
+	// Arrow links a tool to its result in run summaries.
+	Arrow string
+	// Spinner is true when animated Unicode spinners are safe to show.
+	Spinner bool
+}
+
+var (
+	unicodeGlyphs = GlyphSet{OK: "✓", Warn: "!", Fail: "✗", Info: "-", Arrow: "→", Spinner: true}
+	asciiGlyphs   = GlyphSet{OK: "[OK]", Warn: "[WARN]", Fail: "[FAIL]", Info: "[INFO]", Arrow: "->"}
+)
+
+// Glyphs is the active glyph set; see UseASCII.
+var Glyphs = unicodeGlyphs
+
+// UseASCII switches every status marker to plain ASCII ([OK], [WARN], ...)
+// when on is true.
+func UseASCII(on bool) {
+	if on {
+		Glyphs = asciiGlyphs
+	} else {
+		Glyphs = unicodeGlyphs
+	}
+}
+
+// asciiTerms are TERM values whose fonts commonly lack ✓/✗ and block glyphs.
+var asciiTerms = []string{"dumb", "linux", "vt100", "vt102", "vt220", "ansi", "cons25"}
+
+// ASCIITerminal reports whether TERM names a terminal that should get ASCII
+// output without being asked.
+func ASCIITerminal() bool {
+	term := strings.ToLower(strings.TrimSpace(os.Getenv("TERM")))
+	for _, t := range asciiTerms {
+		if term == t {
+			return true
+		}
+	}
+	return false
+}
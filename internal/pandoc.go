@@ -2,10 +2,13 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 )
 
 // HasPandoc returns nil if pandoc is available on PATH, otherwise an error.
@@ -16,80 +19,336 @@ func HasPandoc() error {
 	return nil
 }
 
+// DefaultMarkdownFlavor is the pandoc input format used when none is configured.
+const DefaultMarkdownFlavor = "gfm"
+
+// markdownFlavors lists the pandoc Markdown readers Tess accepts for -f.
+var markdownFlavors = []string{"gfm", "commonmark", "commonmark_x", "markdown", "markdown_strict", "markdown_phpextra", "markdown_mmd"}
+
+// ValidateMarkdownFlavor checks flavor against the known pandoc Markdown
+// readers. Extension toggles such as "markdown+footnotes" or "gfm-smart" are
+// allowed on any known reader.
+func ValidateMarkdownFlavor(flavor string) error {
+	base := strings.TrimSpace(flavor)
+	if i := strings.IndexAny(base, "+-"); i >= 0 {
+		base = base[:i]
+	}
+	for _, f := range markdownFlavors {
+		if base == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown markdown flavor %q (want one of: %s)", flavor, strings.Join(markdownFlavors, ", "))
+}
+
+// PandocOptions tweaks how Markdown is converted.
+type PandocOptions struct {
+	// Flavor is pandoc's input format (-f); empty means DefaultMarkdownFlavor.
+	Flavor string
+	// Timeout bounds each pandoc run; zero means no limit.
+	Timeout time.Duration
+	// Vars are extra "key=value" template variables, passed as -V.
+	Vars []string
+	// LuaFilters are paths to pandoc Lua filters, applied in order.
+	LuaFilters []string
+}
+
+// reservedPandocVars are set by Tess for PDF fonts and can't be overridden
+// with --pandoc-var (use TESS_PDF_SANS_FONT instead).
+var reservedPandocVars = []string{"mainfont", "sansfont", "familydefault"}
+
+// ValidatePandocVar checks that v has the key=value shape and doesn't name a
+// variable Tess sets itself.
+func ValidatePandocVar(v string) error {
+	key, _, ok := strings.Cut(v, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("invalid --pandoc-var %q (want key=value)", v)
+	}
+	for _, r := range reservedPandocVars {
+		if strings.EqualFold(key, r) {
+			return fmt.Errorf("--pandoc-var can't set %q; Tess sets it for PDF fonts (use TESS_PDF_SANS_FONT to change the font)", key)
+		}
+	}
+	return nil
+}
+
+// ValidateLuaFilter checks that path names a readable regular file.
+func ValidateLuaFilter(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("--lua-filter %q: %w", path, err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("--lua-filter %q is a directory", path)
+	}
+	return nil
+}
+
+// extraArgs returns the user-supplied pandoc arguments common to every
+// conversion.
+func (o PandocOptions) extraArgs() []string {
+	var args []string
+	for _, v := range o.Vars {
+		args = append(args, "-V", v)
+	}
+	for _, f := range o.LuaFilters {
+		args = append(args, "--lua-filter", f)
+	}
+	return args
+}
+
+func (o PandocOptions) flavor() string {
+	if f := strings.TrimSpace(o.Flavor); f != "" {
+		return f
+	}
+	return DefaultMarkdownFlavor
+}
+
+// runPandoc runs pandoc with args, killing it after timeout (if non-zero).
+func runPandoc(ctx context.Context, timeout time.Duration, args []string) ([]byte, error) {
+	return runStep(ctx, timeout, "--pandoc-timeout", "pandoc", args...)
+}
+
 // ConvertMarkdownToDOCX converts a Markdown file at mdPath to a DOCX at outPath.
 // The H1 in the Markdown serves as the document title; no metadata title is set
 // to avoid duplicate titles when imported into Google Docs.
-func ConvertMarkdownToDOCX(ctx context.Context, mdPath, outPath string) error {
+func ConvertMarkdownToDOCX(ctx context.Context, mdPath, outPath string, opts PandocOptions) error {
 	if err := HasPandoc(); err != nil {
 		return err
 	}
-	args := []string{"-f", "gfm", "-t", "docx", "-o", outPath, mdPath}
-	cmd := exec.CommandContext(ctx, "pandoc", args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("pandoc docx failed: %v: %s", err, string(out))
+	args := append([]string{"-f", opts.flavor(), "-t", "docx", "-o", outPath, mdPath}, opts.extraArgs()...)
+	if out, err := runPandoc(ctx, opts.Timeout, args); err != nil {
+		return fmt.Errorf("pandoc docx failed: %w: %s", err, string(out))
 	}
 	return nil
 }
 
+// pdfEngines lists supported PDF engines in order of preference: LaTeX-based
+// engines for typographic control, wkhtmltopdf last.
+var pdfEngines = []string{"tectonic", "xelatex", "lualatex", "pdflatex", "wkhtmltopdf"}
+
+// ErrNoPDFEngine is returned by PDF conversion when none of pdfEngines is on
+// PATH. Left to itself, pandoc would fail with a cryptic error about its
+// default engine.
+var ErrNoPDFEngine = errors.New("no PDF engine found (looked for: " + strings.Join(pdfEngines, ", ") + "); install tectonic (https://tectonic-typesetting.github.io) or use --upload-format docx")
+
 // pickPDFEngine attempts to find a preferred PDF engine. Returns empty string
-// if none is found; pandoc will fall back to its defaults which may require a
-// TeX engine present.
+// if none is found.
 func pickPDFEngine() string {
-	// Prefer LaTeX-based engines for typographic control; wkhtmltopdf last.
-	for _, eng := range []string{"tectonic", "xelatex", "lualatex", "pdflatex", "wkhtmltopdf"} {
+	if engines := AvailablePDFEngines(); len(engines) > 0 {
+		return engines[0]
+	}
+	return ""
+}
+
+// enginePreference returns pdfEngines ordered for goos. On Windows, pdflatex
+// is tried last: without fontspec it can't use system fonts like Arial, so
+// wkhtmltopdf (styled via CSS) gives a closer result.
+func enginePreference(goos string) []string {
+	if goos != "windows" {
+		return pdfEngines
+	}
+	out := make([]string, 0, len(pdfEngines))
+	for _, eng := range pdfEngines {
+		if eng != "pdflatex" {
+			out = append(out, eng)
+		}
+	}
+	return append(out, "pdflatex")
+}
+
+// defaultSansFont returns the sans-serif font used for PDFs on goos, honoring
+// TESS_PDF_SANS_FONT.
+func defaultSansFont(goos string) string {
+	if font := os.Getenv("TESS_PDF_SANS_FONT"); font != "" {
+		return font
+	}
+	switch goos {
+	case "darwin":
+		return "Helvetica Neue"
+	case "windows":
+		return "Arial"
+	default:
+		return "Noto Sans"
+	}
+}
+
+// fontspecEngine reports whether eng is a Unicode TeX engine that supports
+// fontspec and therefore arbitrary system fonts.
+func fontspecEngine(eng string) bool {
+	return eng == "tectonic" || eng == "xelatex" || eng == "lualatex"
+}
+
+var tempDir string
+
+// SetTempDir makes TempDir and the pandoc helper files use dir instead of
+// os.TempDir(); "" restores the default.
+func SetTempDir(dir string) {
+	tempDir = dir
+}
+
+// TempDir returns the directory for intermediate files: the one given to
+// SetTempDir, or os.TempDir().
+func TempDir() string {
+	if tempDir != "" {
+		return tempDir
+	}
+	return os.TempDir()
+}
+
+// ValidateTempDir checks that dir exists and a file can be created in it.
+func ValidateTempDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("temp dir: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("temp dir %s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, "tess-write-check-*")
+	if err != nil {
+		return fmt.Errorf("temp dir %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// writeTempFile writes content to a new temp file matching pattern and
+// returns its path. The file is closed before returning so it can be removed
+// on Windows.
+func writeTempFile(pattern, content string) (string, error) {
+	f, err := os.CreateTemp(TempDir(), pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// AvailablePDFEngines returns the supported PDF engines found on PATH, in
+// preference order for this platform.
+func AvailablePDFEngines() []string {
+	var out []string
+	for _, eng := range enginePreference(runtime.GOOS) {
 		if _, err := exec.LookPath(eng); err == nil {
-			return eng
+			out = append(out, eng)
 		}
 	}
-	return ""
+	return out
 }
 
-// ConvertMarkdownToPDFWithEngine allows specifying a preferred PDF engine.
-// If engine is empty or not found, it falls back to pickPDFEngine().
-func ConvertMarkdownToPDFWithEngine(ctx context.Context, mdPath, outPath, engine string) error {
+// CheckFormatTools reports whether format ("docx", "pdf", or "html") can be produced
+// with the installed tools, so callers can fail before doing any API work.
+// The error includes install guidance.
+func CheckFormatTools(format string) error {
+	if format == "html" {
+		// Tess renders HTML itself.
+		return nil
+	}
 	if err := HasPandoc(); err != nil {
-		return err
+		return fmt.Errorf("%s export needs pandoc, which was not found on PATH; install it from https://pandoc.org", format)
+	}
+	if format == "pdf" && len(AvailablePDFEngines()) == 0 {
+		return fmt.Errorf("pdf export needs a PDF engine (one of: %s) and none was found on PATH; install tectonic (https://tectonic-typesetting.github.io) for the lightest option, or use docx", strings.Join(pdfEngines, ", "))
 	}
-	eng := engine
-	if eng != "" {
-		if _, err := exec.LookPath(eng); err != nil {
-			eng = ""
+	return nil
+}
+
+// resolvePDFEngine returns engine if it is on PATH, otherwise the preferred
+// available engine ("" if none).
+func resolvePDFEngine(engine string) string {
+	if engine != "" {
+		if _, err := exec.LookPath(engine); err == nil {
+			return engine
 		}
 	}
-	if eng == "" {
-		eng = pickPDFEngine()
-	}
-	args := []string{"-f", "gfm", "-t", "pdf", "-o", outPath, mdPath}
-	if eng != "" {
-		args = append(args, "--pdf-engine="+eng)
-	}
-	var headerFile string
-	if eng == "tectonic" || eng == "pdflatex" || eng == "xelatex" || eng == "lualatex" {
-		font := os.Getenv("TESS_PDF_SANS_FONT")
-		if font == "" {
-			switch runtime.GOOS {
-			case "darwin":
-				font = "Helvetica Neue"
-			case "windows":
-				font = "Arial"
-			default:
-				font = "Noto Sans"
-			}
+	return pickPDFEngine()
+}
+
+// pdfArgOptions are the inputs to buildPandocPDFArgs beyond the file paths.
+type pdfArgOptions struct {
+	PandocOptions
+	// GOOS selects platform font defaults; empty means runtime.GOOS.
+	GOOS string
+	// Font overrides the sans font; empty means defaultSansFont(GOOS).
+	Font string
+}
+
+// buildPandocPDFArgs assembles the pandoc arguments for converting in to a PDF
+// at out with an already-resolved engine ("" lets pandoc choose). Any helper
+// files it writes (LaTeX header, CSS) are removed by the returned cleanup,
+// which is always non-nil.
+func buildPandocPDFArgs(in, out, engine string, opts pdfArgOptions) ([]string, func()) {
+	goos := opts.GOOS
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	font := opts.Font
+	if font == "" {
+		font = defaultSansFont(goos)
+	}
+	var temps []string
+	cleanup := func() {
+		for _, p := range temps {
+			os.Remove(p)
 		}
+	}
+	args := []string{"-f", opts.flavor(), "-t", "pdf", "-o", out, in}
+	if engine != "" {
+		args = append(args, "--pdf-engine="+engine)
+	}
+	switch {
+	case fontspecEngine(engine):
 		// Instruct pandoc's LaTeX template to use the sans font as the main font.
 		args = append(args, "-V", "mainfont="+font, "-V", "sansfont="+font, "-V", "familydefault=sf")
-		f, err := os.CreateTemp("", "tess-pandoc-header-*.tex")
-		if err == nil {
-			_, _ = f.WriteString("\\usepackage{fontspec}\n\\setmainfont{" + font + "}\n\\setsansfont{" + font + "}\n\\renewcommand{\\familydefault}{\\sfdefault}\n")
-			f.Close()
-			headerFile = f.Name()
-			args = append(args, "-H", headerFile)
-			defer os.Remove(headerFile)
+		header := "\\usepackage{fontspec}\n\\setmainfont{" + font + "}\n\\setsansfont{" + font + "}\n\\renewcommand{\\familydefault}{\\sfdefault}\n"
+		if path, err := writeTempFile("tess-pandoc-header-*.tex", header); err == nil {
+			args = append(args, "-H", path)
+			temps = append(temps, path)
+		}
+	case engine == "pdflatex":
+		// pdflatex has no fontspec: switch to its built-in sans family instead
+		// of naming a system font it can't load.
+		args = append(args, "-V", "familydefault=sf")
+		if path, err := writeTempFile("tess-pandoc-header-*.tex", "\\renewcommand{\\familydefault}{\\sfdefault}\n"); err == nil {
+			args = append(args, "-H", path)
+			temps = append(temps, path)
 		}
+	case engine == "wkhtmltopdf":
+		css := "body { font-family: \"" + font + "\", Arial, Helvetica, sans-serif; }\n"
+		if path, err := writeTempFile("tess-pandoc-*.css", css); err == nil {
+			args = append(args, "--css", path)
+			temps = append(temps, path)
+		}
+	}
+	return append(args, opts.extraArgs()...), cleanup
+}
+
+// ConvertMarkdownToPDFWithEngine allows specifying a preferred PDF engine.
+// If engine is empty or not found, it falls back to pickPDFEngine(), and
+// returns ErrNoPDFEngine when there is none.
+func ConvertMarkdownToPDFWithEngine(ctx context.Context, mdPath, outPath, engine string, opts PandocOptions) error {
+	if err := HasPandoc(); err != nil {
+		return err
+	}
+	engine = resolvePDFEngine(engine)
+	if engine == "" {
+		return ErrNoPDFEngine
 	}
-	cmd := exec.CommandContext(ctx, "pandoc", args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("pandoc pdf failed: %v: %s", err, string(out))
+	args, cleanup := buildPandocPDFArgs(mdPath, outPath, engine, pdfArgOptions{PandocOptions: opts})
+	defer cleanup()
+	if out, err := runPandoc(ctx, opts.Timeout, args); err != nil {
+		return fmt.Errorf("pandoc pdf failed: %w: %s", err, string(out))
 	}
 	return nil
 }
@@ -97,5 +356,5 @@ func ConvertMarkdownToPDFWithEngine(ctx context.Context, mdPath, outPath, engine
 // ConvertMarkdownToPDF converts a Markdown file at mdPath to a PDF at outPath.
 // It tries to select a reasonable PDF engine if available.
 func ConvertMarkdownToPDF(ctx context.Context, mdPath, outPath string) error {
-	return ConvertMarkdownToPDFWithEngine(ctx, mdPath, outPath, "")
+	return ConvertMarkdownToPDFWithEngine(ctx, mdPath, outPath, "", PandocOptions{})
 }
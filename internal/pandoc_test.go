@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// helperFile stands in for a temp file path in expected pandoc args.
+const helperFile = "<file>"
+
+func TestBuildPandocPDFArgs(t *testing.T) {
+	t.Setenv("TESS_PDF_SANS_FONT", "")
+	SetTempDir(t.TempDir())
+	t.Cleanup(func() { SetTempDir("") })
+
+	base := []string{"-f", "gfm", "-t", "pdf", "-o", "out.pdf", "in.md"}
+	for _, tc := range []struct {
+		engine, goos string
+		wantArgs     []string
+		wantHelper   string // substring of the helper file, if one is written
+	}{
+		{"tectonic", "darwin", []string{"--pdf-engine=tectonic", "-V", "mainfont=Helvetica Neue", "-V", "sansfont=Helvetica Neue", "-V", "familydefault=sf", "-H", helperFile}, `\setmainfont{Helvetica Neue}`},
+		{"tectonic", "windows", []string{"--pdf-engine=tectonic", "-V", "mainfont=Arial", "-V", "sansfont=Arial", "-V", "familydefault=sf", "-H", helperFile}, `\setmainfont{Arial}`},
+		{"tectonic", "linux", []string{"--pdf-engine=tectonic", "-V", "mainfont=Noto Sans", "-V", "sansfont=Noto Sans", "-V", "familydefault=sf", "-H", helperFile}, `\setsansfont{Noto Sans}`},
+		{"pdflatex", "darwin", []string{"--pdf-engine=pdflatex", "-V", "familydefault=sf", "-H", helperFile}, `\renewcommand{\familydefault}{\sfdefault}`},
+		{"pdflatex", "windows", []string{"--pdf-engine=pdflatex", "-V", "familydefault=sf", "-H", helperFile}, `\renewcommand{\familydefault}{\sfdefault}`},
+		{"pdflatex", "linux", []string{"--pdf-engine=pdflatex", "-V", "familydefault=sf", "-H", helperFile}, `\renewcommand{\familydefault}{\sfdefault}`},
+		{"wkhtmltopdf", "darwin", []string{"--pdf-engine=wkhtmltopdf", "--css", helperFile}, `font-family: "Helvetica Neue"`},
+		{"wkhtmltopdf", "windows", []string{"--pdf-engine=wkhtmltopdf", "--css", helperFile}, `font-family: "Arial"`},
+		{"wkhtmltopdf", "linux", []string{"--pdf-engine=wkhtmltopdf", "--css", helperFile}, `font-family: "Noto Sans"`},
+		{"", "linux", nil, ""},
+	} {
+		t.Run(tc.engine+"/"+tc.goos, func(t *testing.T) {
+			args, cleanup := buildPandocPDFArgs("in.md", "out.pdf", tc.engine, pdfArgOptions{GOOS: tc.goos})
+			var helpers []string
+			got := slices.Clone(args)
+			for i, a := range got {
+				if i > 0 && (got[i-1] == "-H" || got[i-1] == "--css") {
+					helpers = append(helpers, a)
+					got[i] = helperFile
+				}
+			}
+			if want := append(slices.Clone(base), tc.wantArgs...); !slices.Equal(got, want) {
+				t.Errorf("args = %q, want %q", got, want)
+			}
+			for _, path := range helpers {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(b), tc.wantHelper) {
+					t.Errorf("helper file = %q, want it to contain %q", b, tc.wantHelper)
+				}
+				if !strings.HasPrefix(path, TempDir()) {
+					t.Errorf("helper file %s is outside the temp dir %s", path, TempDir())
+				}
+			}
+			cleanup()
+			for _, path := range helpers {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("cleanup left %s behind", path)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPandocPDFArgsOptions(t *testing.T) {
+	SetTempDir(t.TempDir())
+	t.Cleanup(func() { SetTempDir("") })
+
+	opts := pdfArgOptions{
+		PandocOptions: PandocOptions{Flavor: "commonmark", Vars: []string{"geometry=margin=1in"}},
+		GOOS:          "linux",
+		Font:          "Inter",
+	}
+	args, cleanup := buildPandocPDFArgs("in.md", "out.pdf", "xelatex", opts)
+	defer cleanup()
+	if !slices.Equal(args[:2], []string{"-f", "commonmark"}) {
+		t.Errorf("args = %q, want the commonmark flavor", args)
+	}
+	if !slices.Contains(args, "mainfont=Inter") {
+		t.Errorf("args = %q, want the Font override", args)
+	}
+	if tail := args[len(args)-2:]; !slices.Equal(tail, []string{"-V", "geometry=margin=1in"}) {
+		t.Errorf("args end with %q, want the extra variables last", tail)
+	}
+}
+
+func TestEnginePreference(t *testing.T) {
+	for _, tc := range []struct {
+		goos string
+		want []string
+	}{
+		{"linux", []string{"tectonic", "xelatex", "lualatex", "pdflatex", "wkhtmltopdf"}},
+		{"darwin", []string{"tectonic", "xelatex", "lualatex", "pdflatex", "wkhtmltopdf"}},
+		// pdflatex can't load Arial, so wkhtmltopdf comes first on Windows.
+		{"windows", []string{"tectonic", "xelatex", "lualatex", "wkhtmltopdf", "pdflatex"}},
+	} {
+		if got := enginePreference(tc.goos); !slices.Equal(got, tc.want) {
+			t.Errorf("enginePreference(%s) = %q, want %q", tc.goos, got, tc.want)
+		}
+	}
+	if !slices.Equal(pdfEngines, []string{"tectonic", "xelatex", "lualatex", "pdflatex", "wkhtmltopdf"}) {
+		t.Errorf("enginePreference modified pdfEngines: %q", pdfEngines)
+	}
+}
+
+func TestDefaultSansFont(t *testing.T) {
+	t.Setenv("TESS_PDF_SANS_FONT", "")
+	for goos, want := range map[string]string{"darwin": "Helvetica Neue", "windows": "Arial", "linux": "Noto Sans", "freebsd": "Noto Sans"} {
+		if got := defaultSansFont(goos); got != want {
+			t.Errorf("defaultSansFont(%s) = %q, want %q", goos, got, want)
+		}
+	}
+	t.Setenv("TESS_PDF_SANS_FONT", "Source Sans 3")
+	if got := defaultSansFont("windows"); got != "Source Sans 3" {
+		t.Errorf("defaultSansFont with TESS_PDF_SANS_FONT = %q", got)
+	}
+}
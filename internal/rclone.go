@@ -2,10 +2,14 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
+	"time"
 )
 
 // RcloneAvailable returns an error if rclone is not available in PATH.
@@ -16,13 +20,253 @@ func RcloneAvailable() error {
 	return nil
 }
 
+// RcloneOptions holds settings applied to every rclone invocation.
+type RcloneOptions struct {
+	// ExtraArgs are appended verbatim to each rclone command line.
+	ExtraArgs []string
+	// SharedDriveID targets a Shared Drive (Team Drive) via --drive-team-drive.
+	SharedDriveID string
+	// ServiceAccountFile authenticates with a Google service account JSON
+	// via --drive-service-account-file, for headless uploads.
+	ServiceAccountFile string
+	// Timeout bounds each non-interactive rclone call; zero means no limit.
+	Timeout time.Duration
+	// Concurrency caps how many rclone processes run at once (for batch
+	// uploads); zero or less means DefaultRcloneConcurrency.
+	Concurrency int
+	// VerifyUploads makes CopyToAndLink list the destination after copying
+	// and fail unless the file is there with a nonzero size.
+	VerifyUploads bool
+}
+
+// DefaultRcloneConcurrency is the default cap on simultaneous rclone
+// processes, conservative to stay clear of Drive rate limits.
+const DefaultRcloneConcurrency = 2
+
+var (
+	rcloneOpts RcloneOptions
+	// rcloneSlots is a semaphore bounding concurrent non-interactive rclone calls.
+	rcloneSlots = make(chan struct{}, DefaultRcloneConcurrency)
+)
+
+// ConfigureRclone sets the options used by all subsequent rclone calls. Call
+// it before any rclone work starts.
+func ConfigureRclone(o RcloneOptions) {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultRcloneConcurrency
+	}
+	rcloneOpts = o
+	rcloneSlots = make(chan struct{}, o.Concurrency)
+}
+
+// acquireRclone waits for an rclone slot; the returned func releases it.
+func acquireRclone(ctx context.Context) (func(), error) {
+	select {
+	case rcloneSlots <- struct{}{}:
+		return func() { <-rcloneSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RcloneOptionsFromConfig builds RcloneOptions from the effective config,
+// validating any pass-through arguments.
+func RcloneOptionsFromConfig(cfg EffectiveConfig) (RcloneOptions, error) {
+	o := RcloneOptions{SharedDriveID: strings.TrimSpace(cfg.SharedDriveID)}
+	if sa := strings.TrimSpace(cfg.ServiceAccountFile); sa != "" {
+		if _, err := os.Stat(sa); err != nil {
+			return o, fmt.Errorf("service_account_file: %w", err)
+		}
+		o.ServiceAccountFile = sa
+	}
+	if strings.TrimSpace(cfg.RcloneExtraArgs) != "" {
+		args, err := SplitArgs(cfg.RcloneExtraArgs)
+		if err != nil {
+			return o, fmt.Errorf("rclone_extra_args: %w", err)
+		}
+		if err := validateExtraArgs(args); err != nil {
+			return o, fmt.Errorf("rclone_extra_args: %w", err)
+		}
+		o.ExtraArgs = args
+	}
+	return o, nil
+}
+
+// rcloneArgs appends the configured global args to args.
+func rcloneArgs(args ...string) []string {
+	return rcloneArgsFor(true, args...)
+}
+
+// rcloneArgsFor is rcloneArgs, leaving out the Drive-only global flags
+// (shared drive, service account) unless drive is set.
+func rcloneArgsFor(drive bool, args ...string) []string {
+	full := append([]string{}, args...)
+	if drive && rcloneOpts.SharedDriveID != "" {
+		full = append(full, "--drive-team-drive="+rcloneOpts.SharedDriveID)
+	}
+	if drive && rcloneOpts.ServiceAccountFile != "" {
+		full = append(full, "--drive-service-account-file="+rcloneOpts.ServiceAccountFile)
+	}
+	return append(full, rcloneOpts.ExtraArgs...)
+}
+
+// rcloneCmd builds an interactive rclone command (attached to the terminal by
+// the caller) with the configured global args appended.
+func rcloneCmd(ctx context.Context, args ...string) *exec.Cmd {
+	full := rcloneArgs(args...)
+	logCommand("rclone", full)
+	return exec.CommandContext(ctx, "rclone", full...)
+}
+
+// rcloneOutput runs a non-interactive rclone command under the configured
+// per-step timeout and returns its combined output.
+func rcloneOutput(ctx context.Context, args ...string) ([]byte, error) {
+	return rcloneOutputFor(ctx, true, args...)
+}
+
+// rcloneOutputFor is rcloneOutput with the global args from rcloneArgsFor.
+func rcloneOutputFor(ctx context.Context, drive bool, args ...string) ([]byte, error) {
+	release, err := acquireRclone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	out, err := runStep(ctx, rcloneOpts.Timeout, "--rclone-timeout", "rclone", rcloneArgsFor(drive, append(args, "--ask-password=false")...)...)
+	return out, rcloneConfigError(out, err)
+}
+
+// ErrRcloneConfigEncrypted is returned (wrapped) when rclone needs the
+// password for an encrypted config and none was provided.
+var ErrRcloneConfigEncrypted = errors.New("the rclone config is encrypted and no password was provided; set RCLONE_CONFIG_PASS, or pass --rclone-config-pass-env with the name of a variable that holds it")
+
+// rcloneConfigError replaces err with ErrRcloneConfigEncrypted when rclone's
+// output shows it stopped for a config password. Non-interactive calls pass
+// --ask-password=false, so rclone fails instead of waiting at a prompt.
+func rcloneConfigError(out []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	text := string(out)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		text += string(exitErr.Stderr)
+	}
+	text = strings.ToLower(text)
+	if strings.Contains(text, "configuration password") || strings.Contains(text, "decrypt configuration") || strings.Contains(text, "rclone_config_pass") {
+		return fmt.Errorf("%w (%v)", ErrRcloneConfigEncrypted, err)
+	}
+	return err
+}
+
+// UseRcloneConfigPassFrom passes the rclone config password held in the
+// environment variable name to every rclone call (as RCLONE_CONFIG_PASS).
+// The value only goes into the child environment, never onto a command line.
+func UseRcloneConfigPassFrom(name string) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return fmt.Errorf("--rclone-config-pass-env: environment variable %s is not set", name)
+	}
+	return os.Setenv("RCLONE_CONFIG_PASS", v)
+}
+
+// SplitArgs splits s into arguments on whitespace, honoring single and double
+// quotes and backslash escapes (outside single quotes).
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// validateExtraArgs rejects shell metacharacters. Arguments are passed to exec
+// directly (no shell), so these would never do what the user intended.
+func validateExtraArgs(args []string) error {
+	for _, a := range args {
+		if strings.ContainsAny(a, ";|&`$<>") {
+			return fmt.Errorf("argument %q contains shell metacharacters; arguments are passed to rclone directly, not through a shell", a)
+		}
+	}
+	return nil
+}
+
+// ErrLinkUnavailable is returned (wrapped) by CopyToAndLink when the upload
+// succeeded but no shareable link could be created, e.g. because link sharing
+// is disabled for the domain.
+var ErrLinkUnavailable = errors.New("uploaded, but no shareable link available")
+
 // CopyToAndLink copies a local file to Drive using rclone and returns a shareable link.
+// If the copy succeeds but the link can't be fetched, it returns an error
+// wrapping ErrLinkUnavailable.
 // If importFormat is non-empty (e.g. "docx" or "html"), it is passed via
 // --drive-import-formats to let Drive import the content as a native Google Doc.
 func CopyToAndLink(ctx context.Context, remoteName, folderID, srcPath, destRemote string, importFormat string) (string, error) {
 	if err := RcloneAvailable(); err != nil {
 		return "", err
 	}
+	args := copytoArgs(remoteName, folderID, srcPath, destRemote, importFormat)
+	if out, err := rcloneOutput(ctx, args...); err != nil {
+		return "", fmt.Errorf("rclone copyto failed: %w: %s", err, string(out))
+	}
+	if rcloneOpts.VerifyUploads {
+		if err := verifyUpload(ctx, true, remoteName, folderID, destRemote); err != nil {
+			return "", err
+		}
+	}
+	// Attempt to fetch a link to the uploaded file
+	linkArgs := []string{"link", fmt.Sprintf("%s:%s", remoteName, destRemote)}
+	if strings.TrimSpace(folderID) != "" {
+		linkArgs = append(linkArgs, "--drive-root-folder-id="+folderID)
+	}
+	out, err := rcloneOutput(ctx, linkArgs...)
+	if err != nil {
+		return "", fmt.Errorf("%w: rclone link: %v: %s", ErrLinkUnavailable, err, strings.TrimSpace(string(out)))
+	}
+	link := strings.TrimSpace(string(out))
+	if link == "" {
+		return "", ErrLinkUnavailable
+	}
+	return link, nil
+}
+
+// copytoArgs builds the rclone copyto arguments used by CopyToAndLink.
+func copytoArgs(remoteName, folderID, srcPath, destRemote, importFormat string) []string {
 	args := []string{"copyto", srcPath, fmt.Sprintf("%s:%s", remoteName, destRemote)}
 	if strings.TrimSpace(folderID) != "" {
 		args = append(args, "--drive-root-folder-id="+folderID)
@@ -30,19 +274,105 @@ func CopyToAndLink(ctx context.Context, remoteName, folderID, srcPath, destRemot
 	if strings.TrimSpace(importFormat) != "" {
 		args = append(args, "--drive-import-formats", importFormat)
 	}
-	cmd := exec.CommandContext(ctx, "rclone", args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("rclone copyto failed: %v: %s", err, string(out))
+	return args
+}
+
+// ImportAsGoogleDoc uploads srcPath (a file in format, e.g. "docx") and has
+// Drive convert it to a native Google Doc named docName, returning a link.
+// rclone decides whether to import from the destination's extension, so the
+// upload is sent as "docName.<format>"; Drive drops the extension on import,
+// and rclone lists the Doc under that same name, so link and verification
+// work unchanged.
+func ImportAsGoogleDoc(ctx context.Context, remoteName, folderID, srcPath, docName, format string) (string, error) {
+	ext := "." + format
+	dest := docName
+	if !strings.EqualFold(path.Ext(dest), ext) {
+		dest += ext
 	}
-	// Attempt to fetch a link to the uploaded file
-	linkArgs := []string{"link", fmt.Sprintf("%s:%s", remoteName, destRemote)}
-	if strings.TrimSpace(folderID) != "" {
-		linkArgs = append(linkArgs, "--drive-root-folder-id="+folderID)
+	return CopyToAndLink(ctx, remoteName, folderID, srcPath, dest, format)
+}
+
+// verifyUpload lists the destination folder and checks destRemote is there
+// with a nonzero size; copyto can report success while Drive rejects an
+// import. Native Google Docs are listed with an export extension (e.g.
+// "Name.docx") and size -1, so both are accepted. With drive unset the
+// remote is another backend and folderID is ignored.
+func verifyUpload(ctx context.Context, drive bool, remoteName, folderID, destRemote string) error {
+	dir, name := path.Split(destRemote)
+	args := []string{"lsf", "--files-only", "--format", "sp", "--separator", "\t", remoteName + ":" + dir}
+	if drive && strings.TrimSpace(folderID) != "" {
+		args = append(args, "--drive-root-folder-id="+folderID)
+	}
+	out, err := rcloneOutputFor(ctx, drive, args...)
+	if err != nil {
+		return fmt.Errorf("verify upload: rclone lsf failed: %w: %s", err, strings.TrimSpace(string(out)))
 	}
-	if out, err := exec.CommandContext(ctx, "rclone", linkArgs...).CombinedOutput(); err == nil {
-		return strings.TrimSpace(string(out)), nil
+	hint := ""
+	if drive {
+		hint = "; Drive may have rejected the import"
 	}
-	return "", nil
+	for _, line := range strings.Split(string(out), "\n") {
+		size, p, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || (p != name && strings.TrimSuffix(p, path.Ext(p)) != name) {
+			continue
+		}
+		if strings.TrimSpace(size) == "0" {
+			return fmt.Errorf("verify upload: %s is empty on %s%s", p, remoteName, hint)
+		}
+		return nil
+	}
+	return fmt.Errorf("verify upload: %s not found on %s after copy%s", name, remoteName, hint)
+}
+
+// objectLinkExpiry is how long links to files on non-Drive remotes stay
+// valid; S3 presigned URLs can't outlive a week.
+const objectLinkExpiry = "1w"
+
+// CopyToObjectRemote copies a local file to dir/name on a remote that isn't
+// Google Drive (e.g. S3 or MinIO), without any --drive-* flags, and returns
+// the link from `rclone link` (a presigned URL on S3). dir is a path on the
+// remote, such as "bucket/reviews". As with CopyToAndLink, a failed link
+// is reported as an error wrapping ErrLinkUnavailable.
+func CopyToObjectRemote(ctx context.Context, remoteName, dir, srcPath, name string) (string, error) {
+	if err := RcloneAvailable(); err != nil {
+		return "", err
+	}
+	dest := path.Join(strings.Trim(strings.TrimSpace(dir), "/"), name)
+	if out, err := rcloneOutputFor(ctx, false, "copyto", srcPath, remoteName+":"+dest); err != nil {
+		return "", fmt.Errorf("rclone copyto failed: %w: %s", err, string(out))
+	}
+	if rcloneOpts.VerifyUploads {
+		if err := verifyUpload(ctx, false, remoteName, "", dest); err != nil {
+			return "", err
+		}
+	}
+	out, err := rcloneOutputFor(ctx, false, "link", "--expire", objectLinkExpiry, remoteName+":"+dest)
+	if err != nil {
+		return "", fmt.Errorf("%w: rclone link: %v: %s", ErrLinkUnavailable, err, strings.TrimSpace(string(out)))
+	}
+	link := strings.TrimSpace(string(out))
+	if link == "" {
+		return "", ErrLinkUnavailable
+	}
+	return link, nil
+}
+
+// RemoteType returns the backend type of the named remote ("drive", "s3",
+// ...) as reported by `rclone config show`.
+func RemoteType(ctx context.Context, name string) (string, error) {
+	if err := RcloneAvailable(); err != nil {
+		return "", err
+	}
+	out, err := rcloneOutputFor(ctx, false, "config", "show", name)
+	if err != nil {
+		return "", fmt.Errorf("rclone config show %s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	for _, ln := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(ln, "="); ok && strings.TrimSpace(k) == "type" {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("rclone remote %q not found (run `rclone config` or `tess setup` to create it)", name)
 }
 
 // CopyByIDToFolder performs a server-side copy of a Drive file (by file ID) into the
@@ -56,40 +386,143 @@ func CopyByIDToFolder(ctx context.Context, remoteName, folderID, fileID string)
 	}
 	// Use destination fs with embedded root_folder_id to copy into the specific folder.
 	dstFs := fmt.Sprintf("%s,root_folder_id=%s:", remoteName, folderID)
+	if rcloneOpts.SharedDriveID != "" {
+		dstFs = fmt.Sprintf("%s,team_drive=%s,root_folder_id=%s:", remoteName, rcloneOpts.SharedDriveID, folderID)
+	}
 	args := []string{"backend", "copyid", remoteName + ":", fileID, dstFs, "--drive-server-side-across-configs"}
-	cmd := exec.CommandContext(ctx, "rclone", args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("rclone backend copyid failed: %v: %s", err, string(out))
+	if out, err := rcloneOutput(ctx, args...); err != nil {
+		return fmt.Errorf("rclone backend copyid failed: %w: %s", err, string(out))
 	}
 	return nil
 }
 
-// RemoteExists returns true if an rclone remote with the given name exists.
-func RemoteExists(ctx context.Context, name string) (bool, error) {
+// ListFolderFiles returns the names of the files directly inside the Drive
+// folder folderID, as rclone lists them (Google Docs carry an export
+// extension such as ".docx").
+func ListFolderFiles(ctx context.Context, remoteName, folderID string) ([]string, error) {
 	if err := RcloneAvailable(); err != nil {
-		return false, err
+		return nil, err
 	}
-	cmd := exec.CommandContext(ctx, "rclone", "listremotes")
-	out, err := cmd.Output()
+	out, err := rcloneOutput(ctx, "lsf", "--files-only", remoteName+":", "--drive-root-folder-id="+folderID)
 	if err != nil {
-		return false, fmt.Errorf("rclone listremotes failed: %w", err)
+		return nil, fmt.Errorf("rclone lsf failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// RenameInFolder renames the file from to to inside the Drive folder folderID
+// with rclone moveto (a server-side rename).
+func RenameInFolder(ctx context.Context, remoteName, folderID, from, to string) error {
+	if err := RcloneAvailable(); err != nil {
+		return err
+	}
+	args := []string{"moveto", remoteName + ":" + from, remoteName + ":" + to, "--drive-root-folder-id=" + folderID}
+	if out, err := rcloneOutput(ctx, args...); err != nil {
+		return fmt.Errorf("rclone moveto failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DriveFileInfo is the subset of rclone lsjson output we use.
+type DriveFileInfo struct {
+	Name     string `json:"Name"`
+	ID       string `json:"ID"`
+	MimeType string `json:"MimeType"`
+	IsDir    bool   `json:"IsDir"`
+}
+
+// StatFileByID checks that a Drive file ID exists and is readable with the
+// given remote, returning its metadata. It uses the file ID as the root of the
+// remote and stats it via rclone lsjson, so no files are modified.
+func StatFileByID(ctx context.Context, remoteName, fileID string) (DriveFileInfo, error) {
+	if err := RcloneAvailable(); err != nil {
+		return DriveFileInfo{}, err
+	}
+	if strings.TrimSpace(fileID) == "" {
+		return DriveFileInfo{}, fmt.Errorf("file ID is empty")
+	}
+	args := []string{"lsjson", "--stat", remoteName + ":", "--drive-root-folder-id=" + fileID}
+	out, err := rcloneOutput(ctx, args...)
+	if err != nil {
+		return DriveFileInfo{}, fmt.Errorf("rclone lsjson failed for %s: %w: %s", fileID, err, strings.TrimSpace(string(out)))
+	}
+	var info DriveFileInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return DriveFileInfo{}, fmt.Errorf("decode rclone lsjson output for %s: %w", fileID, err)
+	}
+	if info.ID == "" {
+		info.ID = fileID
+	}
+	return info, nil
+}
+
+// SharedDriveReachable lists the top level of the configured Shared Drive to
+// confirm the remote can access it.
+func SharedDriveReachable(ctx context.Context, remoteName string) error {
+	if err := RcloneAvailable(); err != nil {
+		return err
+	}
+	if rcloneOpts.SharedDriveID == "" {
+		return fmt.Errorf("no shared drive configured")
+	}
+	out, err := rcloneOutput(ctx, "lsf", "--max-depth", "1", remoteName+":")
+	if err != nil {
+		return fmt.Errorf("rclone lsf on shared drive %s failed: %w: %s", rcloneOpts.SharedDriveID, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RemoteExists returns true if an rclone remote with the given name exists.
+func RemoteExists(ctx context.Context, name string) (bool, error) {
+	remotes, err := ListRemotes(ctx)
+	if err != nil {
+		return false, err
 	}
 	target := strings.TrimSpace(name)
-	for _, ln := range strings.Split(string(out), "\n") {
-		ln = strings.TrimSpace(strings.TrimSuffix(ln, ":"))
-		if ln == target && ln != "" {
+	for _, r := range remotes {
+		if r == target {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
+// ListRemotes returns the names of the remotes in the rclone config,
+// without their trailing colons.
+func ListRemotes(ctx context.Context) ([]string, error) {
+	if err := RcloneAvailable(); err != nil {
+		return nil, err
+	}
+	release, err := acquireRclone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	out, err := runner.Output(ctx, "rclone", rcloneArgs("listremotes", "--ask-password=false")...)
+	if err = rcloneConfigError(out, err); err != nil {
+		return nil, fmt.Errorf("rclone listremotes failed: %w", err)
+	}
+	remotes := []string{}
+	for _, ln := range strings.Split(string(out), "\n") {
+		if ln = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(ln), ":")); ln != "" {
+			remotes = append(remotes, ln)
+		}
+	}
+	return remotes, nil
+}
+
 // RunRcloneConfig launches the interactive rclone config wizard attached to the current stdio.
 func RunRcloneConfig(ctx context.Context) error {
 	if err := RcloneAvailable(); err != nil {
 		return err
 	}
-	cmd := exec.CommandContext(ctx, "rclone", "config")
+	cmd := rcloneCmd(ctx, "config")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -99,7 +532,9 @@ func RunRcloneConfig(ctx context.Context) error {
 // CreateDriveRemote attempts to non-interactively create a Google Drive remote
 // with the given name and scope using rclone's config create command.
 // It may still open a browser window to complete OAuth, but avoids the menu wizard.
-func CreateDriveRemote(ctx context.Context, name string, scope string) error {
+// When serviceAccountFile is set, the remote authenticates with that service
+// account and no browser flow is needed.
+func CreateDriveRemote(ctx context.Context, name, scope, serviceAccountFile string) error {
 	if err := RcloneAvailable(); err != nil {
 		return err
 	}
@@ -108,7 +543,10 @@ func CreateDriveRemote(ctx context.Context, name string, scope string) error {
 		s = "drive"
 	}
 	args := []string{"config", "create", name, "drive", "scope=" + s}
-	cmd := exec.CommandContext(ctx, "rclone", args...)
+	if sa := strings.TrimSpace(serviceAccountFile); sa != "" {
+		args = append(args, "service_account_file="+sa, "--non-interactive")
+	}
+	cmd := rcloneCmd(ctx, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
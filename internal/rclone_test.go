@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCopytoArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name                         string
+		folderID, dest, importFormat string
+		want                         []string
+	}{
+		{"plain copy", "", "a.pdf", "", []string{"copyto", "src", "drive:a.pdf"}},
+		{"folder", "F1", "a.pdf", "", []string{"copyto", "src", "drive:a.pdf", "--drive-root-folder-id=F1"}},
+		{"import", "F1", "a.docx", "docx", []string{"copyto", "src", "drive:a.docx", "--drive-root-folder-id=F1", "--drive-import-formats", "docx"}},
+		{"blank folder", "  ", "a.html", "html", []string{"copyto", "src", "drive:a.html", "--drive-import-formats", "html"}},
+	} {
+		if got := copytoArgs("drive", tc.folderID, "src", tc.dest, tc.importFormat); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: copytoArgs = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestImportAsGoogleDocDestination(t *testing.T) {
+	fakeTools(t, "rclone")
+	for _, tc := range []struct {
+		docName, format, wantDest string
+	}{
+		{"Peer & Self Reviews", "docx", "drive:Peer & Self Reviews.docx"},
+		{"Report.docx", "docx", "drive:Report.docx"},
+		{"Report.DOCX", "docx", "drive:Report.DOCX"},
+		{"v1.2 notes", "docx", "drive:v1.2 notes.docx"},
+		{"Report.docx", "html", "drive:Report.docx.html"},
+	} {
+		f := useFakeRunner(t, func(name string, args []string) ([]byte, error) { return []byte("https://x\n"), nil })
+		if _, err := ImportAsGoogleDoc(context.Background(), "drive", "", "/tmp/src."+tc.format, tc.docName, tc.format); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"rclone", "copyto", "/tmp/src." + tc.format, tc.wantDest, "--drive-import-formats", tc.format, "--ask-password=false"}
+		if len(f.calls) == 0 || !slices.Equal(f.calls[0], want) {
+			t.Errorf("%s as %s: copyto = %q, want %q", tc.docName, tc.format, f.calls, want)
+		}
+	}
+}
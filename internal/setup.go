@@ -8,40 +8,63 @@ import (
 	"strings"
 )
 
+// SetupOptions controls RunSetup. When NonInteractive is set, values come only
+// from the other fields (or an existing config) and stdin is never read.
+type SetupOptions struct {
+	NonInteractive bool
+	APIKey         string
+	RcloneRemote   string
+	FolderID       string
+	// ConfigPath is the config file to write; empty means DefaultConfigPath.
+	ConfigPath string
+}
+
 // RunSetup is an interactive first-time configuration helper.
 // It prompts for the API key and optional rclone remote, then writes ~/.tess/config.toml.
-func RunSetup(ctx context.Context) error {
-	cfgPath, err := DefaultConfigPath()
-	if err != nil {
-		return fmt.Errorf("determine default config path: %w", err)
+func RunSetup(ctx context.Context, opts SetupOptions) error {
+	cfgPath := opts.ConfigPath
+	if cfgPath == "" {
+		var err error
+		if cfgPath, err = DefaultConfigPath(); err != nil {
+			return err
+		}
 	}
 	fmt.Printf("Tess setup\n\n")
 	fmt.Printf("Config file: %s\n", cfgPath)
 	// If a config already exists, offer to keep or overwrite minimal fields.
+	// It is read without LoadConfig's checks, so a config whose key lives in
+	// api_key_file (or that has no key yet) keeps its other settings.
 	existing := FileConfig{}
-	hadExisting := false
 	if _, err := os.Stat(cfgPath); err == nil {
-		if c, err := LoadConfig(cfgPath); err == nil {
+		if c, err := parseConfig(cfgPath); err == nil {
 			existing = c
-			hadExisting = true
 		}
 	}
 
+	if opts.NonInteractive {
+		return runSetupNonInteractive(cfgPath, existing, opts)
+	}
+
 	in := bufio.NewReader(os.Stdin)
 	// API key
 	apiKey := existing.APIKey
-	if strings.TrimSpace(apiKey) != "" {
+	keyFile := strings.TrimSpace(existing.APIKeyFile)
+	switch {
+	case keyFile != "":
+		fmt.Printf("Existing API key file detected (%s). Press Enter to keep it, or paste a new key to use instead.\n", keyFile)
+	case strings.TrimSpace(apiKey) != "":
 		fmt.Printf("Existing API key detected. Press Enter to keep, or paste a new key.\n")
-	} else {
+	default:
 		fmt.Printf("Enter your Lattice API key (paste, then Enter).\n")
 	}
 	fmt.Printf("API key: ")
 	line, _ := in.ReadString('\n')
 	line = strings.TrimSpace(line)
 	if line != "" {
-		apiKey = line
+		// api_key_file wins over api_key, so drop it for the new key to apply.
+		apiKey, keyFile = line, ""
 	}
-	if strings.TrimSpace(apiKey) == "" {
+	if strings.TrimSpace(apiKey) == "" && keyFile == "" {
 		return fmt.Errorf("no API key provided")
 	}
 
@@ -59,18 +82,15 @@ func RunSetup(ctx context.Context) error {
 	}
 
 	// Save
-	cfg := FileConfig{APIKey: apiKey, RcloneRemote: strings.TrimSpace(rremote)}
-	if hadExisting {
-		// Keep any template IDs that were already present.
-		cfg.TemplateHubID = existing.TemplateHubID
-		cfg.TemplateCoverID = existing.TemplateCoverID
-		cfg.TemplateReviewID = existing.TemplateReviewID
-	}
+	// Keep any other settings (template IDs, overrides) that were already present.
+	cfg := existing
+	cfg.APIKey, cfg.APIKeyFile = apiKey, keyFile
+	cfg.RcloneRemote = strings.TrimSpace(rremote)
 	if err := SaveConfig(cfgPath, cfg); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 
-	fmt.Printf("\n✓ Wrote config to %s\n", cfgPath)
+	fmt.Printf("\n%s Wrote config to %s\n", Glyphs.OK, cfgPath)
 	// Quick dependency hints
 	fmt.Printf("\nNext steps:\n")
 	if err := RcloneAvailable(); err != nil {
@@ -85,7 +105,7 @@ func RunSetup(ctx context.Context) error {
 			if ans == "" || ans == "y" || ans == "yes" {
 				fmt.Println()
 				// Try non-interactive creation; if it fails, fall back to full wizard.
-				if err := CreateDriveRemote(ctx, rremote, "drive"); err != nil {
+				if err := CreateDriveRemote(ctx, rremote, "drive", existing.ServiceAccountFile); err != nil {
 					fmt.Printf("Automatic creation failed (%v). Launching rclone wizard...\n", err)
 					if err := RunRcloneConfig(ctx); err != nil {
 						fmt.Printf("(rclone config exited with error: %v)\n", err)
@@ -104,3 +124,29 @@ func RunSetup(ctx context.Context) error {
 	fmt.Printf("- Run 'tess' to generate a report, or 'tess doctor' to verify your setup\n")
 	return nil
 }
+
+// runSetupNonInteractive writes the config from opts without prompting and
+// without launching the rclone remote wizard.
+func runSetupNonInteractive(cfgPath string, existing FileConfig, opts SetupOptions) error {
+	cfg := existing
+	if v := strings.TrimSpace(opts.APIKey); v != "" {
+		cfg.APIKey, cfg.APIKeyFile = v, ""
+	}
+	if strings.TrimSpace(cfg.APIKey) == "" && strings.TrimSpace(cfg.APIKeyFile) == "" {
+		return fmt.Errorf("--api-key is required with --non-interactive (no existing key in %s)", cfgPath)
+	}
+	if v := strings.TrimSpace(opts.RcloneRemote); v != "" {
+		cfg.RcloneRemote = v
+	}
+	if strings.TrimSpace(cfg.RcloneRemote) == "" {
+		cfg.RcloneRemote = "drive"
+	}
+	if v := strings.TrimSpace(opts.FolderID); v != "" {
+		cfg.RcloneFolderID = v
+	}
+	if err := SaveConfig(cfgPath, cfg); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	fmt.Printf("%s Wrote config to %s\n", Glyphs.OK, cfgPath)
+	return nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSetupNonInteractiveKeepsExistingConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		config      string
+		apiKey      string
+		wantKey     string
+		wantKeyFile string
+	}{
+		{"key file counts as the key", "api_key_file = \"/run/secrets/lattice\"\ntmp_dir = \"/scratch\"\n", "", "", "/run/secrets/lattice"},
+		{"inline key", "api_key = \"old\"\ntmp_dir = \"/scratch\"\n", "", "old", ""},
+		{"new key replaces the key file", "api_key_file = \"/run/secrets/lattice\"\ntmp_dir = \"/scratch\"\n", "new", "new", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tc.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := RunSetup(context.Background(), SetupOptions{NonInteractive: true, ConfigPath: path, APIKey: tc.apiKey}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.APIKey != tc.wantKey || got.APIKeyFile != tc.wantKeyFile {
+				t.Errorf("api_key = %q, api_key_file = %q; want %q, %q", got.APIKey, got.APIKeyFile, tc.wantKey, tc.wantKeyFile)
+			}
+			if got.TmpDir != "/scratch" || got.RcloneRemote != "drive" {
+				t.Errorf("tmp_dir = %q, rclone_remote = %q; want the old tmp_dir and the default remote", got.TmpDir, got.RcloneRemote)
+			}
+		})
+	}
+}
+
+func TestRunSetupNonInteractiveRequiresKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("tmp_dir = \"/scratch\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunSetup(context.Background(), SetupOptions{NonInteractive: true, ConfigPath: path}); err == nil {
+		t.Error("setup succeeded without any API key")
+	}
+}
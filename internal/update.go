@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latestReleaseURL is the GitHub API endpoint for the newest Tess release.
+const latestReleaseURL = "https://api.github.com/repos/vigetlabs/tess/releases/latest"
+
+// updateCheckTimeout bounds the whole update check.
+const updateCheckTimeout = 3 * time.Second
+
+// Release is the newest published release.
+type Release struct {
+	Tag string `json:"tag_name"`
+	URL string `json:"html_url"`
+}
+
+// CheckForUpdate asks GitHub for the latest release and returns it when it
+// is newer than Version. It returns nil, without an error, for development
+// builds and when Tess is up to date. The check only runs when asked for
+// (--check-updates) and gives up after updateCheckTimeout.
+func CheckForUpdate(ctx context.Context) (*Release, error) {
+	if _, ok := parseVersion(Version); !ok {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "tess/"+Version)
+	resp, err := (&http.Client{Timeout: updateCheckTimeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub releases returned %s", resp.Status)
+	}
+	var rel Release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("decode release: %w", err)
+	}
+	if !NewerVersion(rel.Tag, Version) {
+		return nil, nil
+	}
+	return &rel, nil
+}
+
+// NewerVersion reports whether version a is newer than b. Both are
+// dotted numbers with an optional "v" prefix (e.g. "v1.2.3" or "1.2");
+// anything unparsable is never newer.
+func NewerVersion(a, b string) bool {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := 0; i < max(len(va), len(vb)); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// parseVersion splits a release version into its numbers, ignoring a "v"
+// prefix and any pre-release or build suffix ("1.2.3-rc1" is 1.2.3).
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	var out []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, true
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// UploadOptions describes where and how an Uploader stores a file.
+type UploadOptions struct {
+	// Name is the destination file name.
+	Name string
+	// ImportFormat ("docx" or "html"), when set, asks the backend to convert
+	// the file to a native document named Name; backends without
+	// conversion store it as-is.
+	ImportFormat string
+}
+
+// UploadResult is what an Uploader reports for a stored file.
+type UploadResult struct {
+	// Link is a URL to the uploaded file; it may be empty, in which case
+	// Upload also returns an error wrapping ErrLinkUnavailable.
+	Link string
+}
+
+// Uploader stores finished reports somewhere outside the local machine.
+// Implementations must be safe for concurrent use (batch mode uploads from
+// several workers).
+type Uploader interface {
+	// Name identifies the backend in progress and summary lines, e.g.
+	// "rclone".
+	Name() string
+	// Destination names where files end up, e.g. "Drive" or "s3".
+	Destination() string
+	Upload(ctx context.Context, localPath string, opts UploadOptions) (UploadResult, error)
+}
+
+// UploaderNames lists the accepted --uploader values.
+var UploaderNames = []string{"rclone", "drive-api"}
+
+// NewUploader returns the named backend configured from cfg, checking that
+// what it needs (e.g. the rclone binary, or a Drive token) is available.
+// For rclone it also looks up the remote's backend type.
+func NewUploader(ctx context.Context, name string, cfg EffectiveConfig) (Uploader, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "rclone":
+		if err := RcloneAvailable(); err != nil {
+			return nil, fmt.Errorf("%v; install from https://rclone.org (or use --uploader drive-api)", err)
+		}
+		backend, err := RemoteType(ctx, cfg.RcloneRemote)
+		if err != nil {
+			return nil, err
+		}
+		return RcloneUploader{Remote: cfg.RcloneRemote, FolderID: cfg.RcloneFolderID, Backend: backend}, nil
+	case "drive-api":
+		tokenPath := strings.TrimSpace(cfg.DriveTokenFile)
+		if tokenPath == "" {
+			var err error
+			if tokenPath, err = DefaultDriveTokenPath(); err != nil {
+				return nil, err
+			}
+		}
+		return NewDriveAPI(tokenPath, cfg.RcloneFolderID)
+	default:
+		return nil, fmt.Errorf("invalid uploader %q (want one of: %s)", name, strings.Join(UploaderNames, ", "))
+	}
+}
+
+// RcloneUploader uploads through an rclone remote. On a Google Drive remote
+// FolderID is the Drive folder ID; on any other backend (S3, MinIO, ...) it
+// is a path on the remote, such as "bucket/reviews".
+type RcloneUploader struct {
+	Remote   string
+	FolderID string
+	// Backend is the remote's rclone type (see RemoteType); empty means
+	// "drive".
+	Backend string
+}
+
+func (RcloneUploader) Name() string { return "rclone" }
+
+// IsDrive reports whether the remote is a Google Drive backend.
+func (u RcloneUploader) IsDrive() bool { return u.Backend == "" || u.Backend == "drive" }
+
+func (u RcloneUploader) Destination() string {
+	if u.IsDrive() {
+		return "Drive"
+	}
+	return u.Backend
+}
+
+// Upload copies localPath into the folder, importing it as a Google Doc
+// when opts.ImportFormat is set (see ImportAsGoogleDoc). Other backends
+// can't import, so the file is stored as-is, named with its extension.
+func (u RcloneUploader) Upload(ctx context.Context, localPath string, opts UploadOptions) (UploadResult, error) {
+	var link string
+	var err error
+	if !u.IsDrive() {
+		name := opts.Name
+		if ext := "." + opts.ImportFormat; opts.ImportFormat != "" && !strings.EqualFold(path.Ext(name), ext) {
+			name += ext
+		}
+		link, err = CopyToObjectRemote(ctx, u.Remote, u.FolderID, localPath, name)
+	} else if opts.ImportFormat != "" {
+		link, err = ImportAsGoogleDoc(ctx, u.Remote, u.FolderID, localPath, opts.Name, opts.ImportFormat)
+	} else {
+		link, err = CopyToAndLink(ctx, u.Remote, u.FolderID, localPath, opts.Name, "")
+	}
+	return UploadResult{Link: link}, err
+}